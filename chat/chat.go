@@ -0,0 +1,308 @@
+// Package chat provides typed direct message conversations, messages and
+// events, and dispatches events to handlers, in the same way the notification
+// package does for notifications.
+package chat
+
+import (
+	"errors"
+	"time"
+
+	"github.com/bluesky-social/indigo/api/atproto"
+	appbsky "github.com/bluesky-social/indigo/api/bsky"
+	chatbsky "github.com/bluesky-social/indigo/api/chat"
+
+	"github.com/watzon/lining/post"
+	"github.com/watzon/lining/utils"
+)
+
+// ErrUnsupportedEmbed is returned when a post's embed can't be sent in a
+// message. Messages can only embed records, such as posts.
+var ErrUnsupportedEmbed = errors.New("messages can only embed records")
+
+// ConvoStatus is whether the account accepted a conversation
+type ConvoStatus string
+
+const (
+	// StatusRequest marks a conversation started by someone the account
+	// doesn't follow, until the account accepts it or replies
+	StatusRequest  ConvoStatus = "request"
+	StatusAccepted ConvoStatus = "accepted"
+)
+
+// ConvoView is chat.bsky.convo.defs#convoView with the fields the lexicon
+// gained after the version of indigo this module uses
+type ConvoView struct {
+	chatbsky.ConvoDefs_ConvoView
+	Status string `json:"status,omitempty"`
+}
+
+// Convo is a direct message conversation
+type Convo struct {
+	Id  string
+	Rev string
+	// Members includes the authenticated account
+	Members     []*post.Author
+	Muted       bool
+	Status      ConvoStatus
+	UnreadCount int64
+	// LastMessage is nil for conversations without messages
+	LastMessage *Message
+}
+
+// Message is a direct message
+type Message struct {
+	Id      string
+	Rev     string
+	ConvoId string
+	// Sender is the DID of the account that sent the message
+	Sender string
+	Text   string
+	Facets []post.Facet
+	// Embed is the record, such as a post, embedded in the message
+	Embed  *appbsky.EmbedRecord_View
+	SentAt string
+	// Deleted is set for messages the sender deleted. Their text is empty.
+	Deleted bool
+}
+
+// Time returns when the message was sent
+func (m *Message) Time() time.Time {
+	t, _ := time.Parse(time.RFC3339, m.SentAt)
+	return t
+}
+
+// MessageInput is a message to send
+type MessageInput struct {
+	Text   string
+	Facets []*appbsky.RichtextFacet
+	// Embed is a record, such as a post, to embed in the message
+	Embed *atproto.RepoStrongRef
+}
+
+// MessageFromPost returns a message with the text, facets and record embed of
+// a post, so that messages can be written with a post.Builder. Messages can be
+// up to 1000 graphemes and 10000 bytes long, more than posts, so create the
+// builder with post.WithMessageLimits for long messages.
+//
+// Example:
+//
+//	p, err := client.NewPostBuilder(post.WithMessageLimits(), post.WithAutoLink(true)).
+//	    AddText("Thanks for the report! Tracking it at https://example.com/issues/1").
+//	    Build()
+//	if err != nil {
+//	    return err
+//	}
+//	msg, err := chat.MessageFromPost(p)
+//	if err != nil {
+//	    return err
+//	}
+//	_, err = client.SendMessage(ctx, convo.Id, msg)
+func MessageFromPost(p appbsky.FeedPost) (MessageInput, error) {
+	msg := MessageInput{Text: p.Text, Facets: p.Facets}
+	if p.Embed != nil {
+		if p.Embed.EmbedRecord == nil || p.Embed.EmbedRecord.Record == nil {
+			return MessageInput{}, ErrUnsupportedEmbed
+		}
+		msg.Embed = p.Embed.EmbedRecord.Record
+	}
+	return msg, nil
+}
+
+// WithEmbed returns a copy of the message that embeds the record with the
+// given URI and CID
+func (m MessageInput) WithEmbed(uri, cid string) MessageInput {
+	m.Embed = &atproto.RepoStrongRef{Uri: uri, Cid: cid}
+	return m
+}
+
+// Lexicon converts the message to a chat.bsky.convo.defs#messageInput
+func (m MessageInput) Lexicon() *chatbsky.ConvoDefs_MessageInput {
+	input := &chatbsky.ConvoDefs_MessageInput{Text: m.Text, Facets: m.Facets}
+	if m.Embed != nil {
+		input.Embed = &chatbsky.ConvoDefs_MessageInput_Embed{
+			EmbedRecord: &appbsky.EmbedRecord{LexiconTypeID: "app.bsky.embed.record", Record: m.Embed},
+		}
+	}
+	return input
+}
+
+// authorFromProfileViewBasic converts a chat member's profile to an Author
+func authorFromProfileViewBasic(profile *chatbsky.ActorDefs_ProfileViewBasic) *post.Author {
+	if profile == nil {
+		return nil
+	}
+	return post.AuthorFromProfileViewBasic(&appbsky.ActorDefs_ProfileViewBasic{
+		Associated:  profile.Associated,
+		Avatar:      profile.Avatar,
+		Did:         profile.Did,
+		DisplayName: profile.DisplayName,
+		Handle:      profile.Handle,
+		Labels:      profile.Labels,
+		Viewer:      profile.Viewer,
+	})
+}
+
+// FromConvoView converts a conversation returned by the chat service. It
+// returns nil for a nil view.
+func FromConvoView(view *ConvoView) *Convo {
+	if view == nil {
+		return nil
+	}
+	convo := &Convo{
+		Id:          view.Id,
+		Rev:         view.Rev,
+		Muted:       view.Muted,
+		Status:      ConvoStatus(view.Status),
+		UnreadCount: view.UnreadCount,
+	}
+	for _, member := range view.Members {
+		if author := authorFromProfileViewBasic(member); author != nil {
+			convo.Members = append(convo.Members, author)
+		}
+	}
+	if last := view.LastMessage; last != nil {
+		convo.LastMessage = FromMessageView(view.Id, last.ConvoDefs_MessageView, last.ConvoDefs_DeletedMessageView)
+	}
+	return convo
+}
+
+// FromMessageView converts a message returned by the chat service, which is
+// either a message or a deleted message. It returns nil if both are nil.
+func FromMessageView(convoId string, view *chatbsky.ConvoDefs_MessageView, deleted *chatbsky.ConvoDefs_DeletedMessageView) *Message {
+	switch {
+	case view != nil:
+		msg := &Message{
+			Id:      view.Id,
+			Rev:     view.Rev,
+			ConvoId: convoId,
+			Text:    view.Text,
+			Facets:  post.ExtractFacetsFromFeedPost(&appbsky.FeedPost{Text: view.Text, Facets: view.Facets}),
+			SentAt:  view.SentAt,
+		}
+		if view.Sender != nil {
+			msg.Sender = view.Sender.Did
+		}
+		if view.Embed != nil {
+			msg.Embed = view.Embed.EmbedRecord_View
+		}
+		return msg
+	case deleted != nil:
+		msg := &Message{
+			Id:      deleted.Id,
+			Rev:     deleted.Rev,
+			ConvoId: convoId,
+			SentAt:  deleted.SentAt,
+			Deleted: true,
+		}
+		if deleted.Sender != nil {
+			msg.Sender = deleted.Sender.Did
+		}
+		return msg
+	}
+	return nil
+}
+
+// EventType is the kind of change an event records
+type EventType string
+
+const (
+	EventBeginConvo    EventType = "begin-convo"
+	EventLeaveConvo    EventType = "leave-convo"
+	EventCreateMessage EventType = "create-message"
+	EventDeleteMessage EventType = "delete-message"
+)
+
+// Event is a change to the account's conversations, from
+// chat.bsky.convo.getLog
+type Event struct {
+	Type    EventType
+	ConvoId string
+	Rev     string
+	// Message is set for message events
+	Message *Message
+	// Outgoing is set for messages sent by the authenticated account
+	Outgoing bool
+}
+
+// FromLogEntry converts an entry of chat.bsky.convo.getLog. It returns nil
+// for kinds of entries this package doesn't know.
+func FromLogEntry(entry *chatbsky.ConvoGetLog_Output_Logs_Elem) *Event {
+	switch {
+	case entry == nil:
+		return nil
+	case entry.ConvoDefs_LogBeginConvo != nil:
+		e := entry.ConvoDefs_LogBeginConvo
+		return &Event{Type: EventBeginConvo, ConvoId: e.ConvoId, Rev: e.Rev}
+	case entry.ConvoDefs_LogLeaveConvo != nil:
+		e := entry.ConvoDefs_LogLeaveConvo
+		return &Event{Type: EventLeaveConvo, ConvoId: e.ConvoId, Rev: e.Rev}
+	case entry.ConvoDefs_LogCreateMessage != nil:
+		e := entry.ConvoDefs_LogCreateMessage
+		event := &Event{Type: EventCreateMessage, ConvoId: e.ConvoId, Rev: e.Rev}
+		if e.Message != nil {
+			event.Message = FromMessageView(e.ConvoId, e.Message.ConvoDefs_MessageView, e.Message.ConvoDefs_DeletedMessageView)
+		}
+		return event
+	case entry.ConvoDefs_LogDeleteMessage != nil:
+		e := entry.ConvoDefs_LogDeleteMessage
+		event := &Event{Type: EventDeleteMessage, ConvoId: e.ConvoId, Rev: e.Rev}
+		if e.Message != nil {
+			event.Message = FromMessageView(e.ConvoId, e.Message.ConvoDefs_MessageView, e.Message.ConvoDefs_DeletedMessageView)
+		}
+		return event
+	}
+	return nil
+}
+
+// Filter is a function that filters events
+type Filter func(*Event) bool
+
+// MessageFilter is a function that filters new messages
+type MessageFilter func(*Message) bool
+
+// HandlerWithFilter combines an event handler with its filters
+type HandlerWithFilter struct {
+	Handler func(*Event) error
+	Filters []Filter
+}
+
+// MessageHandlerWithFilter combines a handler for new messages with its
+// filters
+type MessageHandlerWithFilter struct {
+	Handler func(*Message) error
+	Filters []MessageFilter
+}
+
+// Callbacks holds the handlers events are dispatched to. Handlers only run
+// when all of their filters return true.
+type Callbacks struct {
+	// Handlers receive every event
+	Handlers []HandlerWithFilter
+	// MessageHandlers receive the messages other members send, so that a bot
+	// doesn't answer its own messages
+	MessageHandlers []MessageHandlerWithFilter
+}
+
+// Dispatch passes an event to the matching handlers and stops at the first
+// error
+func (cb *Callbacks) Dispatch(e *Event) error {
+	for _, h := range cb.Handlers {
+		if utils.MatchesAll(e, h.Filters) {
+			if err := h.Handler(e); err != nil {
+				return err
+			}
+		}
+	}
+
+	if e.Type != EventCreateMessage || e.Outgoing || e.Message == nil || e.Message.Deleted {
+		return nil
+	}
+	for _, h := range cb.MessageHandlers {
+		if utils.MatchesAll(e.Message, h.Filters) {
+			if err := h.Handler(e.Message); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
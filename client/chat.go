@@ -0,0 +1,396 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"maps"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	chatbsky "github.com/bluesky-social/indigo/api/chat"
+	"github.com/bluesky-social/indigo/xrpc"
+
+	"github.com/watzon/lining/chat"
+)
+
+// defaultChatProxy is the Bluesky chat service, used when the config doesn't
+// set one
+const defaultChatProxy = "did:web:api.bsky.chat#bsky_chat"
+
+// chatClient returns a copy of the XRPC client whose requests the PDS proxies
+// to the chat service
+func (c *BskyClient) chatClient() *xrpc.Client {
+	proxy := c.cfg.ChatProxy
+	if proxy == "" {
+		proxy = defaultChatProxy
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	proxied := *c.client
+	proxied.Headers = make(map[string]string, len(c.client.Headers)+1)
+	maps.Copy(proxied.Headers, c.client.Headers)
+	proxied.Headers["atproto-proxy"] = proxy
+	return &proxied
+}
+
+// chatDo sends a request to the chat service. Procedures are sent as JSON.
+func (c *BskyClient) chatDo(ctx context.Context, kind xrpc.XRPCRequestType, nsid string, params map[string]any, input any, out any) error {
+	encoding := ""
+	if kind == xrpc.Procedure {
+		encoding = "application/json"
+	}
+	return c.chatClient().Do(ctx, kind, encoding, nsid, params, input, out)
+}
+
+// ListConvos returns a Paginator over the authenticated account's
+// conversations, most recently active first. An empty status lists accepted
+// conversations and requests alike.
+//
+// Example:
+//
+//	requests, err := client.ListConvos(chat.StatusRequest).Collect(ctx)
+func (c *BskyClient) ListConvos(status chat.ConvoStatus) *Paginator[*chat.Convo] {
+	return paginate(c, func(ctx context.Context, cursor string, limit int64) ([]*chat.Convo, string, error) {
+		params := map[string]any{"limit": limit}
+		if cursor != "" {
+			params["cursor"] = cursor
+		}
+		if status != "" {
+			params["status"] = string(status)
+		}
+
+		var out struct {
+			Cursor *string           `json:"cursor,omitempty"`
+			Convos []*chat.ConvoView `json:"convos"`
+		}
+		if err := c.chatDo(ctx, xrpc.Query, "chat.bsky.convo.listConvos", params, nil, &out); err != nil {
+			return nil, "", fmt.Errorf("failed to list conversations: %w", err)
+		}
+
+		convos := make([]*chat.Convo, 0, len(out.Convos))
+		for _, view := range out.Convos {
+			if convo := chat.FromConvoView(view); convo != nil {
+				convos = append(convos, convo)
+			}
+		}
+		return convos, stringValue(out.Cursor), nil
+	})
+}
+
+// convoOutput is the output of the procedures that return a conversation
+type convoOutput struct {
+	Convo *chat.ConvoView `json:"convo"`
+}
+
+// GetConvo fetches a conversation by ID
+func (c *BskyClient) GetConvo(ctx context.Context, convoId string) (*chat.Convo, error) {
+	if err := c.ensureValidSession(ctx); err != nil {
+		return nil, err
+	}
+
+	var out convoOutput
+	if err := c.chatDo(ctx, xrpc.Query, "chat.bsky.convo.getConvo", map[string]any{"convoId": convoId}, nil, &out); err != nil {
+		return nil, fmt.Errorf("failed to get conversation: %w", err)
+	}
+	return chat.FromConvoView(out.Convo), nil
+}
+
+// GetConvoForMembers returns the conversation between the authenticated
+// account and other members, given by handle or DID, and starts it if it
+// doesn't exist yet
+//
+// Example:
+//
+//	convo, err := client.GetConvoForMembers(ctx, "alice.bsky.social")
+//	if err != nil {
+//	    return err
+//	}
+//	_, err = client.SendMessage(ctx, convo.Id, chat.MessageInput{Text: "Hi Alice!"})
+func (c *BskyClient) GetConvoForMembers(ctx context.Context, members ...string) (*chat.Convo, error) {
+	if err := c.ensureValidSession(ctx); err != nil {
+		return nil, err
+	}
+
+	dids := make([]string, len(members))
+	for i, member := range members {
+		if strings.HasPrefix(member, "did:") {
+			dids[i] = member
+			continue
+		}
+		did, err := c.GetDIDForHandle(ctx, member)
+		if err != nil {
+			return nil, err
+		}
+		dids[i] = did
+	}
+
+	var out convoOutput
+	if err := c.chatDo(ctx, xrpc.Query, "chat.bsky.convo.getConvoForMembers", map[string]any{"members": dids}, nil, &out); err != nil {
+		return nil, fmt.Errorf("failed to get conversation for members: %w", err)
+	}
+	return chat.FromConvoView(out.Convo), nil
+}
+
+// GetMessages returns a Paginator over the messages of a conversation, newest
+// first
+func (c *BskyClient) GetMessages(convoId string) *Paginator[*chat.Message] {
+	return paginate(c, func(ctx context.Context, cursor string, limit int64) ([]*chat.Message, string, error) {
+		params := map[string]any{"convoId": convoId, "limit": limit}
+		if cursor != "" {
+			params["cursor"] = cursor
+		}
+
+		var out chatbsky.ConvoGetMessages_Output
+		if err := c.chatDo(ctx, xrpc.Query, "chat.bsky.convo.getMessages", params, nil, &out); err != nil {
+			return nil, "", fmt.Errorf("failed to get messages: %w", err)
+		}
+
+		messages := make([]*chat.Message, 0, len(out.Messages))
+		for _, m := range out.Messages {
+			if m == nil {
+				continue
+			}
+			if msg := chat.FromMessageView(convoId, m.ConvoDefs_MessageView, m.ConvoDefs_DeletedMessageView); msg != nil {
+				messages = append(messages, msg)
+			}
+		}
+		return messages, stringValue(out.Cursor), nil
+	})
+}
+
+// SendMessage sends a message to a conversation and returns it as stored by
+// the chat service. Use chat.MessageFromPost to write messages with a
+// post.Builder. In dry-run mode the message is logged instead.
+func (c *BskyClient) SendMessage(ctx context.Context, convoId string, msg chat.MessageInput) (*chat.Message, error) {
+	if err := c.ensureValidSession(ctx); err != nil {
+		return nil, err
+	}
+
+	input := &chatbsky.ConvoSendMessage_Input{ConvoId: convoId, Message: msg.Lexicon()}
+	if c.cfg.DryRun {
+		data, _ := json.Marshal(input.Message)
+		log.Printf("dry run: send message to convo %s: %s", convoId, data)
+		c.mu.RLock()
+		sender := c.client.Auth.Did
+		c.mu.RUnlock()
+		return chat.FromMessageView(convoId, &chatbsky.ConvoDefs_MessageView{
+			Text:   msg.Text,
+			Facets: msg.Facets,
+			Sender: &chatbsky.ConvoDefs_MessageViewSender{Did: sender},
+			SentAt: time.Now().UTC().Format(time.RFC3339),
+		}, nil), nil
+	}
+
+	var out chatbsky.ConvoDefs_MessageView
+	if err := c.chatDo(ctx, xrpc.Procedure, "chat.bsky.convo.sendMessage", nil, input, &out); err != nil {
+		return nil, fmt.Errorf("failed to send message: %w", err)
+	}
+	return chat.FromMessageView(convoId, &out, nil), nil
+}
+
+// MarkConvoRead marks the messages of a conversation up to messageId as read.
+// An empty messageId marks all of them as read.
+func (c *BskyClient) MarkConvoRead(ctx context.Context, convoId string, messageId string) error {
+	if err := c.ensureValidSession(ctx); err != nil {
+		return err
+	}
+
+	input := &chatbsky.ConvoUpdateRead_Input{ConvoId: convoId}
+	if messageId != "" {
+		input.MessageId = &messageId
+	}
+	if err := c.chatDo(ctx, xrpc.Procedure, "chat.bsky.convo.updateRead", nil, input, nil); err != nil {
+		return fmt.Errorf("failed to mark conversation as read: %w", err)
+	}
+	return nil
+}
+
+// convoProcedure calls a procedure that only takes a conversation ID
+func (c *BskyClient) convoProcedure(ctx context.Context, nsid string, convoId string) error {
+	if err := c.ensureValidSession(ctx); err != nil {
+		return err
+	}
+	return c.chatDo(ctx, xrpc.Procedure, nsid, nil, map[string]string{"convoId": convoId}, nil)
+}
+
+// MuteConvo stops notifications for a conversation
+func (c *BskyClient) MuteConvo(ctx context.Context, convoId string) error {
+	if err := c.convoProcedure(ctx, "chat.bsky.convo.muteConvo", convoId); err != nil {
+		return fmt.Errorf("failed to mute conversation: %w", err)
+	}
+	return nil
+}
+
+// UnmuteConvo resumes notifications for a conversation
+func (c *BskyClient) UnmuteConvo(ctx context.Context, convoId string) error {
+	if err := c.convoProcedure(ctx, "chat.bsky.convo.unmuteConvo", convoId); err != nil {
+		return fmt.Errorf("failed to unmute conversation: %w", err)
+	}
+	return nil
+}
+
+// LeaveConvo leaves a conversation, which also declines a request
+func (c *BskyClient) LeaveConvo(ctx context.Context, convoId string) error {
+	if err := c.convoProcedure(ctx, "chat.bsky.convo.leaveConvo", convoId); err != nil {
+		return fmt.Errorf("failed to leave conversation: %w", err)
+	}
+	return nil
+}
+
+// AcceptConvo accepts a conversation request, moving it to the account's
+// accepted conversations
+func (c *BskyClient) AcceptConvo(ctx context.Context, convoId string) error {
+	if err := c.convoProcedure(ctx, "chat.bsky.convo.acceptConvo", convoId); err != nil {
+		return fmt.Errorf("failed to accept conversation: %w", err)
+	}
+	return nil
+}
+
+// getChatLog fetches the events after cursor, oldest first
+func (c *BskyClient) getChatLog(ctx context.Context, cursor string) ([]*chat.Event, string, error) {
+	params := map[string]any{}
+	if cursor != "" {
+		params["cursor"] = cursor
+	}
+
+	var out chatbsky.ConvoGetLog_Output
+	if err := c.chatDo(ctx, xrpc.Query, "chat.bsky.convo.getLog", params, nil, &out); err != nil {
+		return nil, "", fmt.Errorf("failed to get chat log: %w", err)
+	}
+
+	events := make([]*chat.Event, 0, len(out.Logs))
+	for _, entry := range out.Logs {
+		if event := chat.FromLogEntry(entry); event != nil {
+			events = append(events, event)
+		}
+	}
+	// Revs are TIDs, which sort chronologically
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].Rev < events[j].Rev
+	})
+	return events, stringValue(out.Cursor), nil
+}
+
+// ChatPoller follows the authenticated account's chat log and dispatches new
+// events to its callbacks, oldest first.
+//
+// The first poll only finds where the log ends, so a new poller starts with
+// the events that happen after it, rather than replaying the account's
+// history. To pick up where an earlier poller left off, save its Cursor and
+// pass it to WithCursor. Handler errors are reported to OnError and not
+// retried.
+type ChatPoller struct {
+	client    *BskyClient
+	callbacks *chat.Callbacks
+	opts      PollOptions
+
+	mu      sync.Mutex
+	started bool
+	cursor  string
+}
+
+// NewChatPoller returns a poller that dispatches chat events to callbacks
+//
+// Example:
+//
+//	poller := client.NewChatPoller(&chat.Callbacks{
+//	    MessageHandlers: []chat.MessageHandlerWithFilter{{
+//	        Handler: func(m *chat.Message) error {
+//	            _, err := client.SendMessage(ctx, m.ConvoId, chat.MessageInput{Text: "You said: " + m.Text})
+//	            return err
+//	        },
+//	    }},
+//	}, client.WithPollInterval(5*time.Second))
+//	go poller.Run(ctx)
+func (c *BskyClient) NewChatPoller(callbacks *chat.Callbacks, opts ...PollOption) *ChatPoller {
+	options := DefaultPollOptions()
+	for _, opt := range opts {
+		opt(&options)
+	}
+	if callbacks == nil {
+		callbacks = &chat.Callbacks{}
+	}
+	return &ChatPoller{client: c, callbacks: callbacks, opts: options}
+}
+
+// PollChat dispatches new chat events to callbacks until ctx is cancelled.
+// It's a shortcut for NewChatPoller(...).Run(ctx).
+func (c *BskyClient) PollChat(ctx context.Context, callbacks *chat.Callbacks, opts ...PollOption) error {
+	return c.NewChatPoller(callbacks, opts...).Run(ctx)
+}
+
+// WithCursor makes the poller continue after the event a previous poller's
+// Cursor pointed to
+func (p *ChatPoller) WithCursor(cursor string) *ChatPoller {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.cursor = cursor
+	p.started = cursor != ""
+	return p
+}
+
+// Cursor returns the position in the chat log up to which events have been
+// dispatched
+func (p *ChatPoller) Cursor() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.cursor
+}
+
+// Poll fetches the events since the last poll and dispatches them. It returns
+// the number of events dispatched. Handler errors go to OnError and don't stop
+// the poll.
+func (p *ChatPoller) Poll(ctx context.Context) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if err := p.client.ensureValidSession(ctx); err != nil {
+		return 0, err
+	}
+	p.client.mu.RLock()
+	self := p.client.client.Auth.Did
+	p.client.mu.RUnlock()
+
+	dispatched := 0
+	for {
+		if err := p.client.limiter.Wait(ctx); err != nil {
+			return dispatched, fmt.Errorf("rate limit exceeded: %w", err)
+		}
+		events, next, err := p.client.getChatLog(ctx, p.cursor)
+		if err != nil {
+			return dispatched, err
+		}
+		if !p.started {
+			p.started = true
+			p.cursor = next
+			return 0, nil
+		}
+
+		for _, e := range events {
+			e.Outgoing = e.Message != nil && e.Message.Sender == self
+			if err := p.callbacks.Dispatch(e); err != nil && p.opts.OnError != nil {
+				p.opts.OnError(fmt.Errorf("failed to handle %s event in convo %s: %w", e.Type, e.ConvoId, err))
+			}
+			dispatched++
+		}
+
+		advanced := next != "" && next != p.cursor
+		if next != "" {
+			p.cursor = next
+		}
+		if !advanced || len(events) == 0 {
+			return dispatched, nil
+		}
+	}
+}
+
+// Run polls the chat log every interval until ctx is cancelled, and then
+// returns ctx.Err()
+func (p *ChatPoller) Run(ctx context.Context) error {
+	return runPoller(ctx, p.opts, p.Poll)
+}
@@ -0,0 +1,181 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/bluesky-social/indigo/api/atproto"
+	appbsky "github.com/bluesky-social/indigo/api/bsky"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/watzon/lining/chat"
+	"github.com/watzon/lining/post"
+)
+
+const testConvo = `{
+	"id": "convo1", "rev": "r1", "muted": false, "status": "request", "unreadCount": 2,
+	"members": [
+		{"did": "did:plc:test", "handle": "test.bsky.social"},
+		{"did": "did:plc:alice", "handle": "alice.test", "displayName": "Alice"}
+	],
+	"lastMessage": {
+		"$type": "chat.bsky.convo.defs#messageView",
+		"id": "m1", "rev": "r1", "text": "hi", "sender": {"did": "did:plc:alice"}, "sentAt": "2024-05-06T08:00:00Z"
+	}
+}`
+
+func chatLogEntry(rev, sender, text string) string {
+	return fmt.Sprintf(`{
+		"$type": "chat.bsky.convo.defs#logCreateMessage", "convoId": "convo1", "rev": "%s",
+		"message": {
+			"$type": "chat.bsky.convo.defs#messageView",
+			"id": "m-%s", "rev": "%s", "text": "%s", "sender": {"did": "%s"}, "sentAt": "2024-05-06T08:00:00Z"
+		}
+	}`, rev, rev, rev, text, sender)
+}
+
+func TestChat(t *testing.T) {
+	ctx := context.Background()
+	var proxies []string
+	var inputs []map[string]any
+	var query map[string][]string
+	logs := map[string]string{
+		"":   `{"cursor": "r2", "logs": [` + chatLogEntry("r2", "did:plc:alice", "history") + `]}`,
+		"r2": `{"cursor": "r4", "logs": [` + chatLogEntry("r4", "did:plc:alice", "second") + `, {"$type": "chat.bsky.convo.defs#logBeginConvo", "convoId": "convo2", "rev": "r3"}]}`,
+		"r4": `{"cursor": "r5", "logs": [` + chatLogEntry("r5", "did:plc:test", "mine") + `, {"$type": "chat.bsky.convo.defs#logSomethingNew", "rev": "r5a"}]}`,
+		"r5": `{"cursor": "r5", "logs": []}`,
+	}
+
+	chatHandler := func(respond func(w http.ResponseWriter, r *http.Request)) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			proxies = append(proxies, r.Header.Get("atproto-proxy"))
+			query = r.URL.Query()
+			if r.Method == http.MethodPost {
+				var input map[string]any
+				json.NewDecoder(r.Body).Decode(&input)
+				inputs = append(inputs, input)
+			}
+			respond(w, r)
+		}
+	}
+	ok := chatHandler(func(w http.ResponseWriter, r *http.Request) { writeJSON(w, `{}`) })
+	client, _ := newTestPDS(t, map[string]http.HandlerFunc{
+		"chat.bsky.convo.listConvos": chatHandler(func(w http.ResponseWriter, r *http.Request) {
+			writeJSON(w, `{"convos": [`+testConvo+`]}`)
+		}),
+		"chat.bsky.convo.getConvoForMembers": chatHandler(func(w http.ResponseWriter, r *http.Request) {
+			writeJSON(w, `{"convo": `+testConvo+`}`)
+		}),
+		"chat.bsky.convo.sendMessage": chatHandler(func(w http.ResponseWriter, r *http.Request) {
+			writeJSON(w, `{"id": "m2", "rev": "r2", "text": "sent", "sender": {"did": "did:plc:test"}, "sentAt": "2024-05-06T08:01:00Z"}`)
+		}),
+		"chat.bsky.convo.getLog": chatHandler(func(w http.ResponseWriter, r *http.Request) {
+			writeJSON(w, logs[r.URL.Query().Get("cursor")])
+		}),
+		"chat.bsky.convo.updateRead":  ok,
+		"chat.bsky.convo.acceptConvo": ok,
+		"chat.bsky.convo.muteConvo":   ok,
+		"chat.bsky.convo.leaveConvo":  ok,
+	})
+
+	t.Run("conversations", func(t *testing.T) {
+		convos, err := client.ListConvos(chat.StatusRequest).Collect(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"request"}, query["status"])
+		assert.Len(t, convos, 1)
+		convo := convos[0]
+		assert.Equal(t, chat.StatusRequest, convo.Status)
+		assert.Equal(t, int64(2), convo.UnreadCount)
+		assert.Equal(t, "Alice", convo.Members[1].DisplayName)
+		assert.Equal(t, "hi", convo.LastMessage.Text)
+		assert.Equal(t, "did:plc:alice", convo.LastMessage.Sender)
+
+		convo, err = client.GetConvoForMembers(ctx, "did:plc:alice")
+		assert.NoError(t, err)
+		assert.Equal(t, "convo1", convo.Id)
+		assert.Equal(t, []string{"did:plc:alice"}, query["members"])
+
+		assert.NoError(t, client.AcceptConvo(ctx, "convo1"))
+		assert.NoError(t, client.MarkConvoRead(ctx, "convo1", ""))
+		assert.NoError(t, client.MuteConvo(ctx, "convo1"))
+		assert.NoError(t, client.LeaveConvo(ctx, "convo1"))
+		for _, input := range inputs {
+			assert.Equal(t, "convo1", input["convoId"])
+			assert.NotContains(t, input, "messageId")
+		}
+	})
+
+	t.Run("sends rich messages", func(t *testing.T) {
+		inputs = nil
+		p, err := post.NewBuilder().AddText("see ").AddLink("the docs", "https://example.com").Build()
+		assert.NoError(t, err)
+		msg, err := chat.MessageFromPost(p)
+		assert.NoError(t, err)
+
+		sent, err := client.SendMessage(ctx, "convo1", msg.WithEmbed("at://did:plc:alice/app.bsky.feed.post/3k", "cid"))
+		assert.NoError(t, err)
+		assert.Equal(t, "m2", sent.Id)
+		assert.Equal(t, "convo1", sent.ConvoId)
+
+		message := inputs[0]["message"].(map[string]any)
+		assert.Equal(t, "see the docs", message["text"])
+		assert.Len(t, message["facets"], 1)
+		embed := message["embed"].(map[string]any)
+		assert.Equal(t, "app.bsky.embed.record", embed["$type"])
+		assert.Equal(t, "at://did:plc:alice/app.bsky.feed.post/3k", embed["record"].(map[string]any)["uri"])
+
+		_, err = chat.MessageFromPost(appbsky.FeedPost{Text: "pics", Embed: &appbsky.FeedPost_Embed{EmbedImages: &appbsky.EmbedImages{}}})
+		assert.ErrorIs(t, err, chat.ErrUnsupportedEmbed)
+		quote, err := chat.MessageFromPost(appbsky.FeedPost{Embed: &appbsky.FeedPost_Embed{
+			EmbedRecord: &appbsky.EmbedRecord{Record: &atproto.RepoStrongRef{Uri: "at://x", Cid: "c"}},
+		}})
+		assert.NoError(t, err)
+		assert.Equal(t, "at://x", quote.Embed.Uri)
+	})
+
+	t.Run("polls the chat log", func(t *testing.T) {
+		var events, messages []string
+		var errs []error
+		poller := client.NewChatPoller(&chat.Callbacks{
+			Handlers: []chat.HandlerWithFilter{{
+				Handler: func(e *chat.Event) error {
+					events = append(events, string(e.Type)+":"+e.Rev)
+					return nil
+				},
+			}},
+			MessageHandlers: []chat.MessageHandlerWithFilter{{
+				Handler: func(m *chat.Message) error {
+					messages = append(messages, m.Text)
+					return errors.New("handler failed")
+				},
+			}},
+		}, WithPollErrorHandler(func(err error) { errs = append(errs, err) }))
+
+		n, err := poller.Poll(ctx)
+		assert.NoError(t, err)
+		assert.Zero(t, n)
+		assert.Equal(t, "r2", poller.Cursor())
+
+		n, err = poller.Poll(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, 3, n)
+		assert.Equal(t, []string{"begin-convo:r3", "create-message:r4", "create-message:r5"}, events)
+		assert.Equal(t, []string{"second"}, messages)
+		assert.Len(t, errs, 1)
+		assert.Equal(t, "r5", poller.Cursor())
+
+		resumed := client.NewChatPoller(nil).WithCursor("r4")
+		n, err = resumed.Poll(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, n)
+	})
+
+	for _, proxy := range proxies {
+		assert.Equal(t, "did:web:api.bsky.chat#bsky_chat", proxy)
+	}
+	assert.NotEmpty(t, proxies)
+}
@@ -6,6 +6,7 @@ package client
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -17,6 +18,7 @@ import (
 	"github.com/bluesky-social/indigo/api/atproto"
 	appbsky "github.com/bluesky-social/indigo/api/bsky"
 	"github.com/bluesky-social/indigo/atproto/identity"
+	"github.com/bluesky-social/indigo/atproto/syntax"
 	lexutil "github.com/bluesky-social/indigo/lex/util"
 	"github.com/bluesky-social/indigo/xrpc"
 	"golang.org/x/time/rate"
@@ -25,6 +27,7 @@ import (
 	"github.com/watzon/lining/firehose"
 	"github.com/watzon/lining/models"
 	"github.com/watzon/lining/post"
+	"github.com/watzon/lining/utils"
 )
 
 // BskyClient implements the main interface for interacting with Bluesky.
@@ -37,6 +40,9 @@ type BskyClient struct {
 	mu       sync.RWMutex
 	cache    *identity.CacheDirectory
 	firehose *firehose.EnhancedFirehose
+	hooksMu  sync.RWMutex
+	hooks    []WriteHook
+	expiry   *expiryIndex
 }
 
 // NewClient creates a new Bluesky client with the given configuration.
@@ -73,11 +79,17 @@ func NewClient(cfg *config.Config) (*BskyClient, error) {
 		},
 	}
 
+	expiry, err := loadExpiryIndex(cfg.ExpiryIndexPath)
+	if err != nil {
+		return nil, err
+	}
+
 	client := &BskyClient{
 		cfg:     cfg,
 		client:  &xrpc.Client{Client: httpClient, Host: cfg.ServerURL},
 		limiter: limiter,
 		cache:   newIdentityCache(),
+		expiry:  expiry,
 	}
 
 	return client, nil
@@ -193,25 +205,60 @@ func (c *BskyClient) GetProfile(ctx context.Context, handle string) (*appbsky.Ac
 	return profile, nil
 }
 
+// ErrInvalidRkey is returned when a record key passed to WithRkey or
+// WithRecordKey isn't a TID
+var ErrInvalidRkey = errors.New("invalid record key")
+
+// RecordOptions configures how a record such as a like or follow is written
+type RecordOptions struct {
+	// Rkey is the record key. When set, the record is written with putRecord
+	// so that retries don't create duplicates.
+	Rkey string
+}
+
+// RecordOption is a function that configures a RecordOptions struct
+type RecordOption func(*RecordOptions)
+
+// WithRecordKey returns a RecordOption that writes the record under the given
+// key, which must be a TID
+func WithRecordKey(rkey string) RecordOption {
+	return func(opts *RecordOptions) {
+		opts.Rkey = rkey
+	}
+}
+
+// recordKey applies the options and validates the resulting record key
+func recordKey(opts []RecordOption) (string, error) {
+	var options RecordOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+	if options.Rkey != "" {
+		if _, err := syntax.ParseTID(options.Rkey); err != nil {
+			return "", fmt.Errorf("%w %q: %w", ErrInvalidRkey, options.Rkey, err)
+		}
+	}
+	return options.Rkey, nil
+}
+
 // Follow follows a user by their DID
-func (c *BskyClient) Follow(ctx context.Context, did string) error {
+func (c *BskyClient) Follow(ctx context.Context, did string, opts ...RecordOption) error {
 	if err := c.ensureValidSession(ctx); err != nil {
 		return err
 	}
 
+	rkey, err := recordKey(opts)
+	if err != nil {
+		return err
+	}
+
 	follow := &appbsky.GraphFollow{
 		LexiconTypeID: "app.bsky.graph.follow",
 		Subject:       did,
 		CreatedAt:     time.Now().Format(time.RFC3339),
 	}
 
-	input := &atproto.RepoCreateRecord_Input{
-		Collection: "app.bsky.graph.follow",
-		Repo:       c.client.Auth.Did,
-		Record:     &lexutil.LexiconTypeDecoder{Val: follow},
-	}
-
-	_, err := atproto.RepoCreateRecord(ctx, c.client, input)
+	_, _, err = c.createRecord(ctx, "app.bsky.graph.follow", rkey, &lexutil.LexiconTypeDecoder{Val: follow})
 	if err != nil {
 		return fmt.Errorf("failed to follow user: %w", err)
 	}
@@ -219,40 +266,84 @@ func (c *BskyClient) Follow(ctx context.Context, did string) error {
 	return nil
 }
 
-// Unfollow unfollows a user by their DID
-func (c *BskyClient) Unfollow(ctx context.Context, did string) error {
+// Like likes the post with the given URI and CID and returns the URI of the
+// like record
+//
+// Example:
+//
+//	likeUri, err := client.Like(ctx, post.Uri(), post.Cid)
+func (c *BskyClient) Like(ctx context.Context, uri string, cid string, opts ...RecordOption) (string, error) {
 	if err := c.ensureValidSession(ctx); err != nil {
-		return err
+		return "", err
 	}
 
-	// First, find the follow record
-	records, err := atproto.RepoListRecords(ctx, c.client, "app.bsky.graph.follow", "", 100, c.client.Auth.Did, false, "", "")
+	rkey, err := recordKey(opts)
 	if err != nil {
-		return fmt.Errorf("failed to list follow records: %w", err)
+		return "", err
+	}
+
+	like := &appbsky.FeedLike{
+		LexiconTypeID: "app.bsky.feed.like",
+		Subject:       &atproto.RepoStrongRef{Uri: uri, Cid: cid},
+		CreatedAt:     time.Now().Format(time.RFC3339),
+	}
+
+	likeUri, _, err := c.createRecord(ctx, "app.bsky.feed.like", rkey, &lexutil.LexiconTypeDecoder{Val: like})
+	if err != nil {
+		return "", fmt.Errorf("failed to like post: %w", err)
 	}
 
+	return likeUri, nil
+}
+
+// ListRecords returns a Paginator over the records of a collection in a
+// repo. An empty repo lists the authenticated user's own records.
+//
+// Example:
+//
+//	likes := client.ListRecords("app.bsky.feed.like", "")
+//	for likes.Next(ctx) {
+//	    fmt.Println(likes.Item().Uri)
+//	}
+func (c *BskyClient) ListRecords(collection string, repo string) *Paginator[*atproto.RepoListRecords_Record] {
+	return paginate(c, func(ctx context.Context, cursor string, limit int64) ([]*atproto.RepoListRecords_Record, string, error) {
+		did := repo
+		if did == "" {
+			c.mu.RLock()
+			did = c.client.Auth.Did
+			c.mu.RUnlock()
+		}
+		resp, err := atproto.RepoListRecords(ctx, c.client, collection, cursor, limit, did, false, "", "")
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to list %s records: %w", collection, err)
+		}
+		return resp.Records, stringValue(resp.Cursor), nil
+	})
+}
+
+// Unfollow unfollows a user by their DID
+func (c *BskyClient) Unfollow(ctx context.Context, did string) error {
+	// First, find the follow record
 	var rkey string
-	for _, record := range records.Records {
+	follows := c.ListRecords("app.bsky.graph.follow", "").WithPageSize(100)
+	for follows.Next(ctx) {
+		record := follows.Item()
 		follow, ok := record.Value.Val.(*appbsky.GraphFollow)
 		if ok && follow.Subject == did {
 			rkey = record.Uri[strings.LastIndex(record.Uri, "/")+1:]
 			break
 		}
 	}
+	if err := follows.Err(); err != nil {
+		return fmt.Errorf("failed to list follow records: %w", err)
+	}
 
 	if rkey == "" {
 		return fmt.Errorf("follow record not found")
 	}
 
 	// Delete the follow record
-	input := &atproto.RepoDeleteRecord_Input{
-		Collection: "app.bsky.graph.follow",
-		Repo:       c.client.Auth.Did,
-		Rkey:       rkey,
-	}
-
-	_, err = atproto.RepoDeleteRecord(ctx, c.client, input)
-	if err != nil {
+	if err := c.deleteRecord(ctx, "app.bsky.graph.follow", rkey); err != nil {
 		return fmt.Errorf("failed to unfollow user: %w", err)
 	}
 
@@ -294,6 +385,30 @@ func (c *BskyClient) UploadImage(ctx context.Context, image models.Image) (*mode
 	return uploaded, nil
 }
 
+// UploadBlob uploads arbitrary data as a blob with the given MIME type, such
+// as "video/mp4" or "text/vtt" for captions. Unlike UploadImage, which lets the
+// PDS sniff the type, the blob is stored with exactly this MIME type.
+//
+// Example:
+//
+//	blob, err := client.UploadBlob(ctx, captions, "text/vtt")
+func (c *BskyClient) UploadBlob(ctx context.Context, data []byte, mimeType string) (*lexutil.LexBlob, error) {
+	if err := c.ensureValidSession(ctx); err != nil {
+		return nil, err
+	}
+
+	var out atproto.RepoUploadBlob_Output
+	if err := c.client.Do(ctx, xrpc.Procedure, mimeType, "com.atproto.repo.uploadBlob", nil, bytes.NewReader(data), &out); err != nil {
+		return nil, fmt.Errorf("failed to upload blob: %w", err)
+	}
+
+	return &lexutil.LexBlob{
+		Ref:      out.Blob.Ref,
+		MimeType: out.Blob.MimeType,
+		Size:     out.Blob.Size,
+	}, nil
+}
+
 // UploadImageFromURL downloads an image from the given URL and uploads it to Bluesky.
 // This is a convenience method that handles both downloading and uploading.
 //
@@ -370,9 +485,73 @@ func (c *BskyClient) UploadImages(ctx context.Context, images ...models.Image) (
 	return uploads, nil
 }
 
+// PostOptions configures how PostToFeed publishes a post
+type PostOptions struct {
+	// Threadgate, if set, restricts who can reply to the post
+	Threadgate *post.Threadgate
+	// Postgate, if set, controls how the post can be embedded
+	Postgate *post.Postgate
+	// Rkey is the record key of the post. When empty, a new TID is generated.
+	Rkey string
+	// TTL, if set, is how long the post stays up before the reaper deletes it
+	TTL time.Duration
+}
+
+// PostOption is a function that configures a PostOptions struct
+type PostOption func(*PostOptions)
+
+// WithThreadgate returns a PostOption that creates a threadgate alongside the post
+func WithThreadgate(gate post.Threadgate) PostOption {
+	return func(opts *PostOptions) {
+		opts.Threadgate = &gate
+	}
+}
+
+// WithPostgate returns a PostOption that creates a postgate alongside the post
+func WithPostgate(gate post.Postgate) PostOption {
+	return func(opts *PostOptions) {
+		opts.Postgate = &gate
+	}
+}
+
+// WithRkey returns a PostOption that publishes the post under the given record
+// key, which must be a TID. Retrying PostToFeed with the same key rewrites the
+// same record instead of creating a duplicate post.
+func WithRkey(rkey string) PostOption {
+	return func(opts *PostOptions) {
+		opts.Rkey = rkey
+	}
+}
+
+// PostURI returns the URI a post published under rkey will have
+func (c *BskyClient) PostURI(rkey string) string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	did := ""
+	if c.client != nil && c.client.Auth != nil {
+		did = c.client.Auth.Did
+	}
+	return fmt.Sprintf("at://%s/app.bsky.feed.post/%s", did, rkey)
+}
+
 // PostToFeed creates a new post in the user's feed. The post parameter should be a
 // fully constructed FeedPost object, which you can create using the post.Builder.
 //
+// Options can be passed to create a threadgate or postgate record with the same
+// record key as the post. If the gates can't be created, a newly created post
+// is deleted again so it's never left published without its restrictions. A
+// post that already existed under the key passed to WithRkey is kept.
+//
+// Posts are written with putRecord under a TID record key generated by the
+// client, or the one set with WithRkey, so the URI is known up front. To make
+// a retry after a timeout safe, pass the same key and the same post: its
+// CreatedAt is kept when set.
+//
+// The post passes through the client's write hooks first, which may change or
+// reject it. In dry-run mode the post is logged instead of sent, and the
+// returned URI is made up and the CID empty.
+//
 // Returns the CID (Content Identifier) and URI of the created post.
 //
 // Example:
@@ -382,8 +561,12 @@ func (c *BskyClient) UploadImages(ctx context.Context, images ...models.Image) (
 //	    WithImages([]models.UploadedImage{*uploadedImage}).
 //	    Build()
 //
-//	cid, uri, err := client.PostToFeed(ctx, post)
-func (c *BskyClient) PostToFeed(ctx context.Context, post appbsky.FeedPost) (string, string, error) {
+//	rkey := utils.NewTID().String()
+//	cid, uri, err := client.PostToFeed(ctx, post,
+//	    client.WithRkey(rkey),
+//	    client.WithThreadgate(post.Threadgate{AllowMentioned: true}),
+//	)
+func (c *BskyClient) PostToFeed(ctx context.Context, p appbsky.FeedPost, opts ...PostOption) (string, string, error) {
 	if err := c.ensureValidSession(ctx); err != nil {
 		return "", "", err
 	}
@@ -395,37 +578,82 @@ func (c *BskyClient) PostToFeed(ctx context.Context, post appbsky.FeedPost) (str
 		return "", "", fmt.Errorf("client not connected")
 	}
 
+	if err := post.ValidateSelfLabels(&p); err != nil {
+		return "", "", err
+	}
+	if err := post.ValidateLangs(&p); err != nil {
+		return "", "", err
+	}
+
+	var options PostOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	rkey := options.Rkey
+	if rkey == "" {
+		rkey = utils.NewTID().String()
+	} else if _, err := syntax.ParseTID(rkey); err != nil {
+		return "", "", fmt.Errorf("%w %q: %w", ErrInvalidRkey, rkey, err)
+	}
+
+	createdAt := p.CreatedAt
+	if createdAt == "" {
+		createdAt = time.Now().Format(time.RFC3339)
+	}
+
 	// Create a new post object
 	newPost := &appbsky.FeedPost{
 		LexiconTypeID: "app.bsky.feed.post",
-		Text:          post.Text,
-		CreatedAt:     time.Now().Format(time.RFC3339),
-		Embed:         post.Embed,
-		Facets:        post.Facets,
-		Entities:      post.Entities,
-		Labels:        post.Labels,
-		Langs:         post.Langs,
-		Reply:         post.Reply,
-		Tags:          post.Tags,
-	}
-
-	resp, err := atproto.RepoCreateRecord(ctx, c.client, &atproto.RepoCreateRecord_Input{
-		Collection: "app.bsky.feed.post",
-		Repo:       c.client.Auth.Did,
-		Record:     &lexutil.LexiconTypeDecoder{Val: newPost},
-	})
+		Text:          p.Text,
+		CreatedAt:     createdAt,
+		Embed:         p.Embed,
+		Facets:        p.Facets,
+		Entities:      p.Entities,
+		Labels:        p.Labels,
+		Langs:         p.Langs,
+		Reply:         p.Reply,
+		Tags:          p.Tags,
+	}
+
+	// A post under a caller-chosen rkey may already exist from an earlier
+	// attempt, and must not be deleted if its gates fail this time
+	existed := false
+	if options.Rkey != "" && (options.Threadgate != nil || options.Postgate != nil) && !c.cfg.DryRun {
+		_, err := atproto.RepoGetRecord(ctx, c.client, "", "app.bsky.feed.post", c.client.Auth.Did, rkey)
+		switch {
+		case err == nil:
+			existed = true
+		case !isRecordNotFound(err):
+			return "", "", fmt.Errorf("failed to check for an existing post: %w", err)
+		}
+	}
+
+	uri, cid, err := c.createRecord(ctx, "app.bsky.feed.post", rkey, &lexutil.LexiconTypeDecoder{Val: newPost})
 	if err != nil {
 		return "", "", fmt.Errorf("failed to create post: %w", err)
 	}
 
-	return resp.Cid, resp.Uri, nil
+	if err := c.createGates(ctx, uri, options.Threadgate, options.Postgate, !existed); err != nil {
+		return "", "", err
+	}
+
+	if options.TTL > 0 && !c.cfg.DryRun {
+		if err := c.expiry.add(uri, time.Now().Add(options.TTL)); err != nil {
+			return "", "", fmt.Errorf("post %s was published but its expiry was not recorded: %w", uri, err)
+		}
+	}
+
+	return cid, uri, nil
 }
 
 // NewPostBuilder creates a new post builder with the specified options
 func (c *BskyClient) NewPostBuilder(opts ...post.BuilderOption) *post.Builder {
-	// Add the client option first, then any user-provided options
+	// Add the client, resolver and uploader options first, then any user-provided options
 	allOpts := append([]post.BuilderOption{
 		post.WithClient(c.client),
+		post.WithResolver(c),
+		post.WithUploader(c),
 	}, opts...)
 	return post.NewBuilder(allOpts...)
 }
@@ -2,13 +2,18 @@ package client
 
 import (
 	"context"
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
+	appbsky "github.com/bluesky-social/indigo/api/bsky"
+	"github.com/bluesky-social/indigo/atproto/syntax"
 	"github.com/stretchr/testify/assert"
 	"github.com/watzon/lining/config"
+	"github.com/watzon/lining/utils"
 )
 
 func TestNewClient(t *testing.T) {
@@ -143,3 +148,138 @@ func TestGetProfile(t *testing.T) {
 	assert.Equal(t, "Test User", *profile.DisplayName)
 	assert.Equal(t, "Test description", *profile.Description)
 }
+
+// newTestPDS starts a test server that handles session creation and refresh,
+// and dispatches every other XRPC method to the given handlers by NSID
+func newTestPDS(t *testing.T, handlers map[string]http.HandlerFunc) (*BskyClient, *httptest.Server) {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		nsid := strings.TrimPrefix(r.URL.Path, "/xrpc/")
+		switch nsid {
+		case "com.atproto.server.createSession", "com.atproto.server.refreshSession":
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{
+				"accessJwt": "test-access-token",
+				"refreshJwt": "test-refresh-token",
+				"handle": "test.bsky.social",
+				"did": "did:plc:test"
+			}`))
+			return
+		}
+		if handler, ok := handlers[nsid]; ok {
+			handler(w, r)
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	t.Cleanup(server.Close)
+
+	cfg := config.Default().
+		WithHandle("test.bsky.social").
+		WithAPIKey("test-key").
+		WithServerURL(server.URL).
+		WithRequestsPerMinute(6000).
+		WithBurstSize(100)
+
+	client, err := NewClient(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Connect(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	return client, server
+}
+
+// writeJSON writes v as a JSON response
+func writeJSON(w http.ResponseWriter, v string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(v))
+}
+
+func TestPostToFeedRkey(t *testing.T) {
+	var puts []map[string]any
+	client, _ := newTestPDS(t, map[string]http.HandlerFunc{
+		"com.atproto.repo.putRecord": func(w http.ResponseWriter, r *http.Request) {
+			var input map[string]any
+			json.NewDecoder(r.Body).Decode(&input)
+			puts = append(puts, input)
+			writeJSON(w, `{"uri": "at://did:plc:test/app.bsky.feed.post/`+input["rkey"].(string)+`", "cid": "cid-post"}`)
+		},
+	})
+	ctx := context.Background()
+
+	t.Run("generates a TID", func(t *testing.T) {
+		puts = nil
+		_, uri, err := client.PostToFeed(ctx, appbsky.FeedPost{Text: "hello"})
+
+		assert.NoError(t, err)
+		assert.Len(t, puts, 1)
+		rkey := puts[0]["rkey"].(string)
+		_, err = syntax.ParseTID(rkey)
+		assert.NoError(t, err)
+		assert.Equal(t, client.PostURI(rkey), uri)
+	})
+
+	t.Run("retries reuse the rkey and createdAt", func(t *testing.T) {
+		puts = nil
+		rkey := utils.NewTID().String()
+		p := appbsky.FeedPost{Text: "hello", CreatedAt: "2024-01-01T00:00:00Z"}
+
+		_, first, err := client.PostToFeed(ctx, p, WithRkey(rkey))
+		assert.NoError(t, err)
+		_, second, err := client.PostToFeed(ctx, p, WithRkey(rkey))
+		assert.NoError(t, err)
+
+		assert.Equal(t, first, second)
+		assert.Equal(t, client.PostURI(rkey), first)
+		assert.Equal(t, puts[0], puts[1])
+		assert.Equal(t, "2024-01-01T00:00:00Z", puts[0]["record"].(map[string]any)["createdAt"])
+	})
+
+	t.Run("rejects invalid rkeys", func(t *testing.T) {
+		_, _, err := client.PostToFeed(ctx, appbsky.FeedPost{Text: "hello"}, WithRkey("not-a-tid"))
+		assert.ErrorIs(t, err, ErrInvalidRkey)
+	})
+}
+
+func TestUploadBlob(t *testing.T) {
+	var contentType string
+	client, _ := newTestPDS(t, map[string]http.HandlerFunc{
+		"com.atproto.repo.uploadBlob": func(w http.ResponseWriter, r *http.Request) {
+			contentType = r.Header.Get("Content-Type")
+			writeJSON(w, `{"blob": {"$type": "blob", "ref": {"$link": "bafkreie5737gdxlw5i64vzichcalba3z2v5n6icifvx5xytvske7mr3hpm"}, "mimeType": "`+contentType+`", "size": 6}}`)
+		},
+	})
+
+	blob, err := client.UploadBlob(context.Background(), []byte("WEBVTT"), "text/vtt")
+	assert.NoError(t, err)
+	assert.Equal(t, "text/vtt", contentType)
+	assert.Equal(t, "text/vtt", blob.MimeType)
+	assert.Equal(t, int64(6), blob.Size)
+}
+
+func TestLike(t *testing.T) {
+	var put map[string]any
+	client, _ := newTestPDS(t, map[string]http.HandlerFunc{
+		"com.atproto.repo.putRecord": func(w http.ResponseWriter, r *http.Request) {
+			json.NewDecoder(r.Body).Decode(&put)
+			writeJSON(w, `{"uri": "at://did:plc:test/app.bsky.feed.like/`+put["rkey"].(string)+`", "cid": "cid-like"}`)
+		},
+	})
+
+	rkey := utils.NewTID().String()
+	uri, err := client.Like(context.Background(), "at://did:plc:a/app.bsky.feed.post/1", "cid-post", WithRecordKey(rkey))
+
+	assert.NoError(t, err)
+	assert.Equal(t, "at://did:plc:test/app.bsky.feed.like/"+rkey, uri)
+	assert.Equal(t, "app.bsky.feed.like", put["collection"])
+	subject := put["record"].(map[string]any)["subject"].(map[string]any)
+	assert.Equal(t, "at://did:plc:a/app.bsky.feed.post/1", subject["uri"])
+	assert.Equal(t, "cid-post", subject["cid"])
+
+	_, err = client.Like(context.Background(), "at://did:plc:a/app.bsky.feed.post/1", "cid-post", WithRecordKey("bad"))
+	assert.ErrorIs(t, err, ErrInvalidRkey)
+}
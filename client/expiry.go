@@ -0,0 +1,232 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/watzon/lining/utils"
+)
+
+// ExpiringPost is a post published with a TTL that hasn't been deleted yet
+type ExpiringPost struct {
+	Uri       string    `json:"uri"`
+	ExpiresAt time.Time `json:"expiresAt"`
+	// Attempts counts failed attempts to delete the post
+	Attempts  int    `json:"attempts,omitempty"`
+	LastError string `json:"lastError,omitempty"`
+}
+
+// expiryIndex tracks posts that should be deleted once they expire. When
+// path is set, the index is saved to that file after every change.
+type expiryIndex struct {
+	mu    sync.Mutex
+	path  string
+	posts map[string]*ExpiringPost
+}
+
+// loadExpiryIndex loads the index stored at path. An empty path gives an
+// in-memory index.
+func loadExpiryIndex(path string) (*expiryIndex, error) {
+	idx := &expiryIndex{path: path, posts: make(map[string]*ExpiringPost)}
+	if path == "" {
+		return idx, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return idx, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read expiry index: %w", err)
+	}
+
+	var posts []*ExpiringPost
+	if err := json.Unmarshal(data, &posts); err != nil {
+		return nil, fmt.Errorf("failed to parse expiry index: %w", err)
+	}
+	for _, p := range posts {
+		idx.posts[p.Uri] = p
+	}
+	return idx, nil
+}
+
+// save writes the index to disk. The caller must hold idx.mu.
+func (idx *expiryIndex) save() error {
+	if idx.path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(idx.sorted(), "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode expiry index: %w", err)
+	}
+	if err := utils.WriteFileAtomic(idx.path, data, 0o600); err != nil {
+		return fmt.Errorf("failed to save expiry index: %w", err)
+	}
+	return nil
+}
+
+// sorted returns the posts ordered by expiry. The caller must hold idx.mu.
+func (idx *expiryIndex) sorted() []*ExpiringPost {
+	posts := make([]*ExpiringPost, 0, len(idx.posts))
+	for _, p := range idx.posts {
+		posts = append(posts, p)
+	}
+	sort.Slice(posts, func(i, j int) bool {
+		if !posts[i].ExpiresAt.Equal(posts[j].ExpiresAt) {
+			return posts[i].ExpiresAt.Before(posts[j].ExpiresAt)
+		}
+		return posts[i].Uri < posts[j].Uri
+	})
+	return posts
+}
+
+func (idx *expiryIndex) add(uri string, expiresAt time.Time) error {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.posts[uri] = &ExpiringPost{Uri: uri, ExpiresAt: expiresAt}
+	return idx.save()
+}
+
+func (idx *expiryIndex) remove(uri string) (bool, error) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	if _, ok := idx.posts[uri]; !ok {
+		return false, nil
+	}
+	delete(idx.posts, uri)
+	return true, idx.save()
+}
+
+// WithTTL returns a PostOption that deletes the post, along with its
+// threadgate and postgate, once ttl has passed. Expired posts are deleted by
+// RunReaper or ReapExpired. Set config.Config.ExpiryIndexPath to keep track of
+// them across restarts.
+//
+// Example:
+//
+//	_, uri, err := client.PostToFeed(ctx, notice, client.WithTTL(3*time.Hour))
+func WithTTL(ttl time.Duration) PostOption {
+	return func(opts *PostOptions) {
+		opts.TTL = ttl
+	}
+}
+
+// ExpiringPosts returns the posts waiting to expire, soonest first
+func (c *BskyClient) ExpiringPosts() []ExpiringPost {
+	c.expiry.mu.Lock()
+	defer c.expiry.mu.Unlock()
+
+	sorted := c.expiry.sorted()
+	posts := make([]ExpiringPost, len(sorted))
+	for i, p := range sorted {
+		posts[i] = *p
+	}
+	return posts
+}
+
+// CancelExpiry keeps a post published with a TTL from being deleted. It
+// returns false if the post isn't waiting to expire.
+func (c *BskyClient) CancelExpiry(uri string) (bool, error) {
+	return c.expiry.remove(uri)
+}
+
+// ReapExpired deletes every post whose TTL has passed, together with its
+// threadgate and postgate, and returns the number of posts deleted. Posts that
+// were already deleted count as deleted. Posts that can't be deleted stay in
+// the index and are tried again next time; the returned error joins their
+// errors.
+func (c *BskyClient) ReapExpired(ctx context.Context) (int, error) {
+	now := time.Now()
+
+	c.expiry.mu.Lock()
+	var expired []ExpiringPost
+	for _, p := range c.expiry.sorted() {
+		if !p.ExpiresAt.After(now) {
+			expired = append(expired, *p)
+		}
+	}
+	c.expiry.mu.Unlock()
+
+	if len(expired) == 0 {
+		return 0, nil
+	}
+	if err := c.ensureValidSession(ctx); err != nil {
+		return 0, err
+	}
+
+	reaped := 0
+	var errs []error
+	for _, p := range expired {
+		if err := ctx.Err(); err != nil {
+			return reaped, err
+		}
+
+		err := c.deleteExpired(ctx, p.Uri)
+
+		c.expiry.mu.Lock()
+		if err == nil {
+			delete(c.expiry.posts, p.Uri)
+			reaped++
+		} else if stored, ok := c.expiry.posts[p.Uri]; ok {
+			stored.Attempts++
+			stored.LastError = err.Error()
+			errs = append(errs, fmt.Errorf("failed to delete expired post %s: %w", p.Uri, err))
+		}
+		if saveErr := c.expiry.save(); saveErr != nil {
+			errs = append(errs, saveErr)
+		}
+		c.expiry.mu.Unlock()
+	}
+
+	return reaped, errors.Join(errs...)
+}
+
+// deleteExpired deletes a post and its gates, treating records that are
+// already gone as deleted. The post goes first so that it's never left
+// published without its gates.
+func (c *BskyClient) deleteExpired(ctx context.Context, uri string) error {
+	rkey, err := c.ownPostRkey(uri)
+	if err != nil {
+		return err
+	}
+
+	for _, collection := range []string{"app.bsky.feed.post", "app.bsky.feed.threadgate", "app.bsky.feed.postgate"} {
+		if err := c.deleteRecord(ctx, collection, rkey); err != nil && !isRecordNotFound(err) {
+			return fmt.Errorf("failed to delete %s: %w", collection, err)
+		}
+	}
+	return nil
+}
+
+// RunReaper deletes expired posts every interval until ctx is cancelled, and
+// then returns ctx.Err(). Posts that expired while the process wasn't running
+// are deleted on the first pass. Errors from individual passes are passed to
+// onError, which may be nil.
+//
+// Example:
+//
+//	go client.RunReaper(ctx, time.Minute, func(err error) {
+//	    log.Printf("reaper: %v", err)
+//	})
+func (c *BskyClient) RunReaper(ctx context.Context, interval time.Duration, onError func(error)) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := c.ReapExpired(ctx); err != nil && ctx.Err() == nil && onError != nil {
+			onError(err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	appbsky "github.com/bluesky-social/indigo/api/bsky"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExpiringPosts(t *testing.T) {
+	var deleted []string
+	failDeletes := false
+	handlers := map[string]http.HandlerFunc{
+		"com.atproto.repo.putRecord": func(w http.ResponseWriter, r *http.Request) {
+			var input map[string]any
+			json.NewDecoder(r.Body).Decode(&input)
+			writeJSON(w, `{"uri": "at://did:plc:test/app.bsky.feed.post/`+input["rkey"].(string)+`", "cid": "cid-post"}`)
+		},
+		"com.atproto.repo.deleteRecord": func(w http.ResponseWriter, r *http.Request) {
+			if failDeletes {
+				w.WriteHeader(http.StatusInternalServerError)
+				writeJSON(w, `{"error": "InternalServerError", "message": "try again"}`)
+				return
+			}
+			var input map[string]string
+			json.NewDecoder(r.Body).Decode(&input)
+			deleted = append(deleted, input["collection"])
+			if input["collection"] == "app.bsky.feed.postgate" {
+				w.WriteHeader(http.StatusBadRequest)
+				writeJSON(w, `{"error": "RecordNotFound", "message": "no postgate"}`)
+				return
+			}
+			writeJSON(w, `{}`)
+		},
+	}
+
+	path := filepath.Join(t.TempDir(), "expiry.json")
+	client, _ := newTestPDS(t, handlers)
+	index, err := loadExpiryIndex(path)
+	assert.NoError(t, err)
+	client.expiry = index
+	ctx := context.Background()
+
+	_, uri, err := client.PostToFeed(ctx, appbsky.FeedPost{Text: "service degraded"}, WithTTL(time.Millisecond))
+	assert.NoError(t, err)
+	_, keep, err := client.PostToFeed(ctx, appbsky.FeedPost{Text: "all good"}, WithTTL(time.Hour))
+	assert.NoError(t, err)
+	assert.Len(t, client.ExpiringPosts(), 2)
+	time.Sleep(5 * time.Millisecond)
+
+	t.Run("keeps posts that fail to delete", func(t *testing.T) {
+		failDeletes = true
+		defer func() { failDeletes = false }()
+
+		n, err := client.ReapExpired(ctx)
+		assert.Error(t, err)
+		assert.Zero(t, n)
+
+		posts := client.ExpiringPosts()
+		assert.Equal(t, uri, posts[0].Uri)
+		assert.Equal(t, 1, posts[0].Attempts)
+		assert.Contains(t, posts[0].LastError, "try again")
+	})
+
+	t.Run("survives restarts", func(t *testing.T) {
+		restarted, _ := newTestPDS(t, handlers)
+		restarted.expiry, err = loadExpiryIndex(path)
+		assert.NoError(t, err)
+		assert.Len(t, restarted.ExpiringPosts(), 2)
+
+		n, err := restarted.ReapExpired(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, n)
+		assert.Equal(t, []string{"app.bsky.feed.post", "app.bsky.feed.threadgate", "app.bsky.feed.postgate"}, deleted)
+
+		posts := restarted.ExpiringPosts()
+		assert.Len(t, posts, 1)
+		assert.Equal(t, keep, posts[0].Uri)
+
+		reloaded, err := loadExpiryIndex(path)
+		assert.NoError(t, err)
+		assert.Len(t, reloaded.posts, 1)
+	})
+
+	t.Run("cancels expiry", func(t *testing.T) {
+		cancelled, err := client.CancelExpiry(keep)
+		assert.NoError(t, err)
+		assert.True(t, cancelled)
+
+		cancelled, err = client.CancelExpiry(keep)
+		assert.NoError(t, err)
+		assert.False(t, cancelled)
+	})
+}
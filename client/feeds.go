@@ -0,0 +1,240 @@
+package client
+
+import (
+	"context"
+	"fmt"
+
+	appbsky "github.com/bluesky-social/indigo/api/bsky"
+
+	"github.com/watzon/lining/post"
+)
+
+// AuthorFeedFilter selects which posts GetAuthorFeed returns
+type AuthorFeedFilter string
+
+const (
+	// FilterPostsWithReplies includes the author's posts, reposts and replies
+	FilterPostsWithReplies AuthorFeedFilter = "posts_with_replies"
+	// FilterPostsNoReplies leaves out replies
+	FilterPostsNoReplies AuthorFeedFilter = "posts_no_replies"
+	// FilterPostsWithMedia only includes posts with images or video
+	FilterPostsWithMedia AuthorFeedFilter = "posts_with_media"
+	// FilterPostsAndAuthorThreads includes replies only within the author's own threads
+	FilterPostsAndAuthorThreads AuthorFeedFilter = "posts_and_author_threads"
+)
+
+// FeedOptions configures a feed request
+type FeedOptions struct {
+	// Limit is the number of posts per page, between 1 and 100. Zero requests
+	// 50.
+	Limit int64
+	// Cursor continues from a previous page
+	Cursor string
+	// Filter applies to GetAuthorFeed and defaults to FilterPostsWithReplies
+	Filter AuthorFeedFilter
+	// IncludePins makes GetAuthorFeed start with the author's pinned post
+	IncludePins bool
+}
+
+// FeedOption is a function that configures a FeedOptions struct
+type FeedOption func(*FeedOptions)
+
+// WithFeedLimit returns a FeedOption that sets the number of posts per page
+func WithFeedLimit(limit int64) FeedOption {
+	return func(opts *FeedOptions) {
+		opts.Limit = limit
+	}
+}
+
+// WithFeedCursor returns a FeedOption that continues from a previous page
+func WithFeedCursor(cursor string) FeedOption {
+	return func(opts *FeedOptions) {
+		opts.Cursor = cursor
+	}
+}
+
+// WithAuthorFeedFilter returns a FeedOption that filters an author feed
+func WithAuthorFeedFilter(filter AuthorFeedFilter) FeedOption {
+	return func(opts *FeedOptions) {
+		opts.Filter = filter
+	}
+}
+
+// WithPinnedPost returns a FeedOption that includes the author's pinned post
+func WithPinnedPost() FeedOption {
+	return func(opts *FeedOptions) {
+		opts.IncludePins = true
+	}
+}
+
+// FeedPage is one page of a feed
+type FeedPage struct {
+	Posts []*post.Post
+	// Cursor fetches the next page; it's empty on the last page
+	Cursor string
+}
+
+// feedItems converts the items and cursor of a feed response
+func feedItems(items []*appbsky.FeedDefs_FeedViewPost, cursor *string) ([]*post.Post, string, error) {
+	posts, err := post.PostsFromFeed(items)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to convert feed: %w", err)
+	}
+	return posts, stringValue(cursor), nil
+}
+
+// stringValue returns the string s points to, or "" if s is nil
+func stringValue(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+func feedOptions(opts []FeedOption) FeedOptions {
+	var options FeedOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+	return options
+}
+
+// getFeedPage fetches the single page of a feed selected by options
+func (c *BskyClient) getFeedPage(ctx context.Context, fetch PageFetcher[*post.Post], options FeedOptions) (*FeedPage, error) {
+	if err := c.ensureValidSession(ctx); err != nil {
+		return nil, err
+	}
+	posts, cursor, err := fetch(ctx, options.Cursor, pageLimit(options.Limit))
+	if err != nil {
+		return nil, err
+	}
+	return &FeedPage{Posts: posts, Cursor: cursor}, nil
+}
+
+// feedPaginator returns a Paginator over a feed that starts at the cursor
+// and page size in options
+func (c *BskyClient) feedPaginator(fetch PageFetcher[*post.Post], options FeedOptions) *Paginator[*post.Post] {
+	return paginate(c, fetch).WithPageSize(options.Limit).WithCursor(options.Cursor)
+}
+
+func (c *BskyClient) timelineFetcher() PageFetcher[*post.Post] {
+	return func(ctx context.Context, cursor string, limit int64) ([]*post.Post, string, error) {
+		resp, err := appbsky.FeedGetTimeline(ctx, c.client, "", cursor, limit)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to get timeline: %w", err)
+		}
+		return feedItems(resp.Feed, resp.Cursor)
+	}
+}
+
+func (c *BskyClient) authorFeedFetcher(actor string, options FeedOptions) PageFetcher[*post.Post] {
+	if options.Filter == "" {
+		options.Filter = FilterPostsWithReplies
+	}
+	return func(ctx context.Context, cursor string, limit int64) ([]*post.Post, string, error) {
+		resp, err := appbsky.FeedGetAuthorFeed(ctx, c.client, actor, cursor, string(options.Filter), options.IncludePins, limit)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to get author feed: %w", err)
+		}
+		return feedItems(resp.Feed, resp.Cursor)
+	}
+}
+
+func (c *BskyClient) feedFetcher(feedUri string) PageFetcher[*post.Post] {
+	return func(ctx context.Context, cursor string, limit int64) ([]*post.Post, string, error) {
+		resp, err := appbsky.FeedGetFeed(ctx, c.client, cursor, feedUri, limit)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to get feed: %w", err)
+		}
+		return feedItems(resp.Feed, resp.Cursor)
+	}
+}
+
+func (c *BskyClient) listFeedFetcher(listUri string) PageFetcher[*post.Post] {
+	return func(ctx context.Context, cursor string, limit int64) ([]*post.Post, string, error) {
+		resp, err := appbsky.FeedGetListFeed(ctx, c.client, cursor, limit, listUri)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to get list feed: %w", err)
+		}
+		return feedItems(resp.Feed, resp.Cursor)
+	}
+}
+
+// GetTimeline returns a page of the authenticated user's home timeline.
+// Reposts carry a Reason and replies a ReplyContext.
+//
+// Example:
+//
+//	page, err := client.GetTimeline(ctx, client.WithFeedLimit(50))
+//	for _, p := range page.Posts {
+//	    if p.Reason != nil && p.Reason.RepostBy != nil {
+//	        fmt.Printf("reposted by %s: ", p.Reason.RepostBy.Handle)
+//	    }
+//	    fmt.Println(p.Author.Handle, p.Text)
+//	}
+func (c *BskyClient) GetTimeline(ctx context.Context, opts ...FeedOption) (*FeedPage, error) {
+	return c.getFeedPage(ctx, c.timelineFetcher(), feedOptions(opts))
+}
+
+// Timeline returns a Paginator over the authenticated user's home timeline.
+// WithFeedLimit sets its page size and WithFeedCursor where it starts.
+//
+// Example:
+//
+//	for p, err := range client.Timeline().WithMaxItems(300).All(ctx) {
+//	    if err != nil {
+//	        return err
+//	    }
+//	    fmt.Println(p.Author.Handle, p.Text)
+//	}
+func (c *BskyClient) Timeline(opts ...FeedOption) *Paginator[*post.Post] {
+	return c.feedPaginator(c.timelineFetcher(), feedOptions(opts))
+}
+
+// GetAuthorFeed returns a page of the posts and reposts of a user, given by
+// handle or DID
+//
+// Example:
+//
+//	page, err := client.GetAuthorFeed(ctx, "alice.bsky.social",
+//	    client.WithAuthorFeedFilter(client.FilterPostsNoReplies),
+//	)
+func (c *BskyClient) GetAuthorFeed(ctx context.Context, actor string, opts ...FeedOption) (*FeedPage, error) {
+	options := feedOptions(opts)
+	return c.getFeedPage(ctx, c.authorFeedFetcher(actor, options), options)
+}
+
+// AuthorFeed returns a Paginator over the posts and reposts of a user, given
+// by handle or DID
+func (c *BskyClient) AuthorFeed(actor string, opts ...FeedOption) *Paginator[*post.Post] {
+	options := feedOptions(opts)
+	return c.feedPaginator(c.authorFeedFetcher(actor, options), options)
+}
+
+// GetFeed returns a page of a custom feed, given the AT URI of its feed
+// generator record
+//
+// Example:
+//
+//	page, err := client.GetFeed(ctx, "at://did:plc:z72i7hdynmk6r22z27h6tvur/app.bsky.feed.generator/whats-hot")
+func (c *BskyClient) GetFeed(ctx context.Context, feedUri string, opts ...FeedOption) (*FeedPage, error) {
+	return c.getFeedPage(ctx, c.feedFetcher(feedUri), feedOptions(opts))
+}
+
+// Feed returns a Paginator over a custom feed, given the AT URI of its feed
+// generator record
+func (c *BskyClient) Feed(feedUri string, opts ...FeedOption) *Paginator[*post.Post] {
+	return c.feedPaginator(c.feedFetcher(feedUri), feedOptions(opts))
+}
+
+// GetListFeed returns a page of posts by the members of a list, given the AT
+// URI of the list
+func (c *BskyClient) GetListFeed(ctx context.Context, listUri string, opts ...FeedOption) (*FeedPage, error) {
+	return c.getFeedPage(ctx, c.listFeedFetcher(listUri), feedOptions(opts))
+}
+
+// ListFeed returns a Paginator over the posts by the members of a list, given
+// the AT URI of the list
+func (c *BskyClient) ListFeed(listUri string, opts ...FeedOption) *Paginator[*post.Post] {
+	return c.feedPaginator(c.listFeedFetcher(listUri), feedOptions(opts))
+}
@@ -0,0 +1,93 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testFeedPost = `{
+	"uri": "at://did:plc:alice/app.bsky.feed.post/3kabc",
+	"cid": "cid-alice",
+	"author": {"did": "did:plc:alice", "handle": "alice.test", "displayName": "Alice"},
+	"record": {"$type": "app.bsky.feed.post", "text": "hello", "createdAt": "2024-05-06T08:00:00Z"},
+	"indexedAt": "2024-05-06T08:00:01Z",
+	"viewer": {"like": "at://did:plc:test/app.bsky.feed.like/3klike"}
+}`
+
+func TestGetFeeds(t *testing.T) {
+	var query map[string]string
+	handler := func(feed string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			query = map[string]string{}
+			for k := range r.URL.Query() {
+				query[k] = r.URL.Query().Get(k)
+			}
+			writeJSON(w, `{"cursor": "next", "feed": `+feed+`}`)
+		}
+	}
+
+	client, _ := newTestPDS(t, map[string]http.HandlerFunc{
+		"app.bsky.feed.getTimeline": handler(`[
+			{"post": ` + testFeedPost + `, "reason": {"$type": "app.bsky.feed.defs#reasonRepost", "by": {"did": "did:plc:bob", "handle": "bob.test"}, "indexedAt": "2024-05-06T09:00:00Z"}},
+			{"post": ` + testFeedPost + `, "reply": {
+				"root": {"$type": "app.bsky.feed.defs#postView", "uri": "at://did:plc:carol/app.bsky.feed.post/3kroot", "cid": "cid-root", "author": {"did": "did:plc:carol", "handle": "carol.test"}, "record": {"$type": "app.bsky.feed.post", "text": "root", "createdAt": "2024-05-06T07:00:00Z"}, "indexedAt": "2024-05-06T07:00:00Z"},
+				"parent": {"$type": "app.bsky.feed.defs#notFoundPost", "uri": "at://did:plc:dave/app.bsky.feed.post/3kgone", "notFound": true}
+			}}
+		]`),
+		"app.bsky.feed.getAuthorFeed": handler(`[{"post": ` + testFeedPost + `, "reason": {"$type": "app.bsky.feed.defs#reasonPin"}}]`),
+		"app.bsky.feed.getFeed":       handler(`[]`),
+		"app.bsky.feed.getListFeed":   handler(`[]`),
+	})
+	ctx := context.Background()
+
+	t.Run("timeline", func(t *testing.T) {
+		page, err := client.GetTimeline(ctx, WithFeedLimit(2))
+		assert.NoError(t, err)
+		assert.Equal(t, "next", page.Cursor)
+		assert.Equal(t, "2", query["limit"])
+		assert.Len(t, page.Posts, 2)
+
+		repost := page.Posts[0]
+		assert.Equal(t, "hello", repost.Text)
+		assert.Equal(t, "alice.test", repost.Author.Handle)
+		assert.Equal(t, "Alice", repost.Author.DisplayName)
+		assert.Equal(t, "at://did:plc:test/app.bsky.feed.like/3klike", repost.Viewer.Like)
+		assert.Equal(t, "bob.test", repost.Reason.RepostBy.Handle)
+		assert.Nil(t, repost.ReplyContext)
+
+		reply := page.Posts[1]
+		assert.Nil(t, reply.Reason)
+		assert.Equal(t, "root", reply.ReplyContext.Root.Text)
+		assert.Equal(t, "carol.test", reply.ReplyContext.Root.Author.Handle)
+		assert.Nil(t, reply.ReplyContext.Parent)
+	})
+
+	t.Run("author feed", func(t *testing.T) {
+		page, err := client.GetAuthorFeed(ctx, "alice.test",
+			WithAuthorFeedFilter(FilterPostsNoReplies),
+			WithPinnedPost(),
+			WithFeedCursor("abc"),
+		)
+		assert.NoError(t, err)
+		assert.Equal(t, "alice.test", query["actor"])
+		assert.Equal(t, "posts_no_replies", query["filter"])
+		assert.Equal(t, "true", query["includePins"])
+		assert.Equal(t, "abc", query["cursor"])
+		assert.Equal(t, "50", query["limit"])
+		assert.True(t, page.Posts[0].Reason.Pinned)
+	})
+
+	t.Run("custom and list feeds", func(t *testing.T) {
+		page, err := client.GetFeed(ctx, "at://did:plc:gen/app.bsky.feed.generator/hot")
+		assert.NoError(t, err)
+		assert.Equal(t, "at://did:plc:gen/app.bsky.feed.generator/hot", query["feed"])
+		assert.Empty(t, page.Posts)
+
+		_, err = client.GetListFeed(ctx, "at://did:plc:test/app.bsky.graph.list/3klist")
+		assert.NoError(t, err)
+		assert.Equal(t, "at://did:plc:test/app.bsky.graph.list/3klist", query["list"])
+	})
+}
@@ -0,0 +1,222 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/bluesky-social/indigo/api/atproto"
+	appbsky "github.com/bluesky-social/indigo/api/bsky"
+	lexutil "github.com/bluesky-social/indigo/lex/util"
+	"github.com/bluesky-social/indigo/xrpc"
+
+	"github.com/watzon/lining/post"
+)
+
+// threadgateRecord wraps a threadgate record so that an empty allow list,
+// meaning nobody can reply, is written out instead of being omitted
+type threadgateRecord struct {
+	appbsky.FeedThreadgate
+}
+
+func (r *threadgateRecord) MarshalJSON() ([]byte, error) {
+	type plain appbsky.FeedThreadgate
+	if r.Allow == nil {
+		return json.Marshal((*plain)(&r.FeedThreadgate))
+	}
+	return json.Marshal(struct {
+		*plain
+		Allow []*appbsky.FeedThreadgate_Allow_Elem `json:"allow"`
+	}{(*plain)(&r.FeedThreadgate), r.Allow})
+}
+
+// ownPostRkey checks that uri is a post in the authenticated user's repo and
+// returns its record key
+func (c *BskyClient) ownPostRkey(uri string) (string, error) {
+	repo, collection, rkey, err := post.ParsePostURI(uri)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse post URI: %w", err)
+	}
+	if collection != "app.bsky.feed.post" {
+		return "", fmt.Errorf("not a post URI: %s", uri)
+	}
+	if repo != c.client.Auth.Did && repo != c.client.Auth.Handle {
+		return "", fmt.Errorf("post %s does not belong to the authenticated user", uri)
+	}
+	return rkey, nil
+}
+
+// createGates writes the threadgate and postgate records for a post with put
+// semantics, so that retrying a post whose gates already exist succeeds. If a
+// write fails and rollback is set, the post is deleted. Callers only set
+// rollback for posts they created for the first time, so that a retry never
+// deletes a post that was already published.
+func (c *BskyClient) createGates(ctx context.Context, postUri string, threadgate *post.Threadgate, postgate *post.Postgate, rollback bool) error {
+	if threadgate == nil && postgate == nil {
+		return nil
+	}
+
+	rkey, err := c.ownPostRkey(postUri)
+	if err != nil {
+		return err
+	}
+
+	type gate struct {
+		collection string
+		record     *lexutil.LexiconTypeDecoder
+	}
+	var gates []gate
+	if threadgate != nil {
+		gates = append(gates, gate{"app.bsky.feed.threadgate", &lexutil.LexiconTypeDecoder{Val: &threadgateRecord{*threadgate.Record(postUri)}}})
+	}
+	if postgate != nil {
+		gates = append(gates, gate{"app.bsky.feed.postgate", &lexutil.LexiconTypeDecoder{Val: postgate.Record(postUri)}})
+	}
+
+	for _, g := range gates {
+		err := c.putRecord(ctx, g.collection, rkey, g.record)
+		if err == nil {
+			continue
+		}
+		if !rollback {
+			return fmt.Errorf("failed to create post gates: %w", err)
+		}
+
+		// The rollback skips the write hooks so that no hook can keep a post
+		// without its gates published
+		_, delErr := atproto.RepoDeleteRecord(ctx, c.client, &atproto.RepoDeleteRecord_Input{
+			Collection: "app.bsky.feed.post",
+			Repo:       c.client.Auth.Did,
+			Rkey:       rkey,
+		})
+		if delErr != nil {
+			return fmt.Errorf("failed to create post gates: %w (and failed to delete post %s: %v)", err, postUri, delErr)
+		}
+		return fmt.Errorf("failed to create post gates: %w", err)
+	}
+
+	return nil
+}
+
+// putGate creates or replaces a gate record for one of the user's posts
+func (c *BskyClient) putGate(ctx context.Context, collection string, postUri string, record *lexutil.LexiconTypeDecoder) error {
+	if err := c.ensureValidSession(ctx); err != nil {
+		return err
+	}
+
+	rkey, err := c.ownPostRkey(postUri)
+	if err != nil {
+		return err
+	}
+
+	if err := c.putRecord(ctx, collection, rkey, record); err != nil {
+		return fmt.Errorf("failed to update %s: %w", collection, err)
+	}
+
+	return nil
+}
+
+// deleteGate removes a gate record from one of the user's posts
+func (c *BskyClient) deleteGate(ctx context.Context, collection string, postUri string) error {
+	if err := c.ensureValidSession(ctx); err != nil {
+		return err
+	}
+
+	rkey, err := c.ownPostRkey(postUri)
+	if err != nil {
+		return err
+	}
+
+	if err := c.deleteRecord(ctx, collection, rkey); err != nil {
+		return fmt.Errorf("failed to remove %s: %w", collection, err)
+	}
+
+	return nil
+}
+
+// UpdateThreadgate creates or replaces the threadgate on one of the user's posts,
+// changing who can reply to it.
+//
+// Example:
+//
+//	err := client.UpdateThreadgate(ctx, uri, post.Threadgate{AllowFollowing: true})
+func (c *BskyClient) UpdateThreadgate(ctx context.Context, postUri string, gate post.Threadgate) error {
+	record := &threadgateRecord{*gate.Record(postUri)}
+	return c.putGate(ctx, "app.bsky.feed.threadgate", postUri, &lexutil.LexiconTypeDecoder{Val: record})
+}
+
+// RemoveThreadgate removes the threadgate from one of the user's posts, so that
+// everyone can reply to it again
+func (c *BskyClient) RemoveThreadgate(ctx context.Context, postUri string) error {
+	return c.deleteGate(ctx, "app.bsky.feed.threadgate", postUri)
+}
+
+// UpdatePostgate creates or replaces the postgate on one of the user's posts.
+// Note that this replaces any detached quotes; use DetachQuote to add to them.
+func (c *BskyClient) UpdatePostgate(ctx context.Context, postUri string, gate post.Postgate) error {
+	return c.putGate(ctx, "app.bsky.feed.postgate", postUri, &lexutil.LexiconTypeDecoder{Val: gate.Record(postUri)})
+}
+
+// RemovePostgate removes the postgate from one of the user's posts, allowing
+// quotes again and reattaching any detached quotes
+func (c *BskyClient) RemovePostgate(ctx context.Context, postUri string) error {
+	return c.deleteGate(ctx, "app.bsky.feed.postgate", postUri)
+}
+
+// GetPostgate returns the postgate of one of the user's posts. If the post has
+// no postgate, the zero Postgate is returned.
+func (c *BskyClient) GetPostgate(ctx context.Context, postUri string) (post.Postgate, error) {
+	if err := c.ensureValidSession(ctx); err != nil {
+		return post.Postgate{}, err
+	}
+
+	rkey, err := c.ownPostRkey(postUri)
+	if err != nil {
+		return post.Postgate{}, err
+	}
+
+	resp, err := atproto.RepoGetRecord(ctx, c.client, "", "app.bsky.feed.postgate", c.client.Auth.Did, rkey)
+	if err != nil {
+		if isRecordNotFound(err) {
+			return post.Postgate{}, nil
+		}
+		return post.Postgate{}, fmt.Errorf("failed to get postgate: %w", err)
+	}
+
+	record, ok := resp.Value.Val.(*appbsky.FeedPostgate)
+	if !ok {
+		return post.Postgate{}, fmt.Errorf("unexpected record type: %T", resp.Value.Val)
+	}
+
+	return post.PostgateFromRecord(record), nil
+}
+
+// DetachQuote detaches a quote post from one of the user's posts, so the quote
+// no longer shows the embedded post. Any existing postgate rules are kept.
+//
+// Example:
+//
+//	err := client.DetachQuote(ctx, myPostUri, "at://did:plc:xyz/app.bsky.feed.post/abc")
+func (c *BskyClient) DetachQuote(ctx context.Context, postUri string, quoteUri string) error {
+	gate, err := c.GetPostgate(ctx, postUri)
+	if err != nil {
+		return err
+	}
+
+	for _, detached := range gate.DetachedQuotes {
+		if detached == quoteUri {
+			return nil
+		}
+	}
+	gate.DetachedQuotes = append(gate.DetachedQuotes, quoteUri)
+
+	return c.UpdatePostgate(ctx, postUri, gate)
+}
+
+// isRecordNotFound reports whether err is the XRPC error returned when a
+// record does not exist
+func isRecordNotFound(err error) bool {
+	var xerr *xrpc.XRPCError
+	return errors.As(err, &xerr) && xerr.ErrStr == "RecordNotFound"
+}
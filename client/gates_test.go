@@ -0,0 +1,168 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"testing"
+
+	appbsky "github.com/bluesky-social/indigo/api/bsky"
+	"github.com/stretchr/testify/assert"
+	"github.com/watzon/lining/post"
+	"github.com/watzon/lining/utils"
+)
+
+func TestPostToFeedWithGates(t *testing.T) {
+	// The fake PDS keeps its records and, like a real PDS, rejects creates of
+	// records that already exist
+	records := make(map[string]map[string]any)
+	var deleted []string
+	failGates := false
+
+	client, _ := newTestPDS(t, map[string]http.HandlerFunc{
+		"com.atproto.repo.getRecord": func(w http.ResponseWriter, r *http.Request) {
+			key := r.URL.Query().Get("collection") + "/" + r.URL.Query().Get("rkey")
+			if _, ok := records[key]; !ok {
+				w.WriteHeader(http.StatusBadRequest)
+				writeJSON(w, `{"error": "RecordNotFound", "message": "not found"}`)
+				return
+			}
+			writeJSON(w, `{"uri": "at://did:plc:test/`+key+`", "value": {"$type": "app.bsky.feed.post", "text": "gated", "createdAt": "2024-01-01T00:00:00Z"}}`)
+		},
+		"com.atproto.repo.putRecord": func(w http.ResponseWriter, r *http.Request) {
+			var input map[string]any
+			json.NewDecoder(r.Body).Decode(&input)
+			key := input["collection"].(string) + "/" + input["rkey"].(string)
+			if failGates && input["collection"] != "app.bsky.feed.post" {
+				w.WriteHeader(http.StatusBadRequest)
+				writeJSON(w, `{"error": "InvalidRequest", "message": "nope"}`)
+				return
+			}
+			records[key] = input["record"].(map[string]any)
+			writeJSON(w, `{"uri": "at://did:plc:test/`+key+`", "cid": "cid-post"}`)
+		},
+		"com.atproto.repo.applyWrites": func(w http.ResponseWriter, r *http.Request) {
+			var input struct {
+				Writes []map[string]any `json:"writes"`
+			}
+			body, _ := io.ReadAll(r.Body)
+			json.Unmarshal(body, &input)
+			for _, write := range input.Writes {
+				key := write["collection"].(string) + "/" + write["rkey"].(string)
+				if _, ok := records[key]; ok && write["$type"] == "com.atproto.repo.applyWrites#create" {
+					w.WriteHeader(http.StatusBadRequest)
+					writeJSON(w, `{"error": "InvalidRequest", "message": "record already exists"}`)
+					return
+				}
+				records[key] = write["value"].(map[string]any)
+			}
+			writeJSON(w, `{}`)
+		},
+		"com.atproto.repo.deleteRecord": func(w http.ResponseWriter, r *http.Request) {
+			var input map[string]string
+			json.NewDecoder(r.Body).Decode(&input)
+			key := input["collection"] + "/" + input["rkey"]
+			delete(records, key)
+			deleted = append(deleted, key)
+			writeJSON(w, `{}`)
+		},
+	})
+
+	ctx := context.Background()
+	feedPost := appbsky.FeedPost{Text: "gated"}
+
+	t.Run("creates gates with the post's rkey", func(t *testing.T) {
+		rkey := utils.NewTID().String()
+		_, uri, err := client.PostToFeed(ctx, feedPost,
+			WithRkey(rkey),
+			WithThreadgate(post.Threadgate{}),
+			WithPostgate(post.Postgate{DisableQuotes: true}),
+		)
+
+		assert.NoError(t, err)
+		assert.Equal(t, client.PostURI(rkey), uri)
+
+		threadgate := records["app.bsky.feed.threadgate/"+rkey]
+		assert.Equal(t, uri, threadgate["post"])
+		assert.Equal(t, []any{}, threadgate["allow"], "nobody can reply")
+
+		rules := records["app.bsky.feed.postgate/"+rkey]["embeddingRules"].([]any)
+		assert.Equal(t, "app.bsky.feed.postgate#disableRule", rules[0].(map[string]any)["$type"])
+	})
+
+	t.Run("retries with the same rkey keep the post", func(t *testing.T) {
+		deleted = nil
+		rkey := utils.NewTID().String()
+		opts := []PostOption{WithRkey(rkey), WithThreadgate(post.Threadgate{AllowMentioned: true})}
+
+		_, first, err := client.PostToFeed(ctx, feedPost, opts...)
+		assert.NoError(t, err)
+		_, second, err := client.PostToFeed(ctx, feedPost, opts...)
+		assert.NoError(t, err)
+
+		assert.Equal(t, first, second)
+		assert.Empty(t, deleted)
+		assert.Contains(t, records, "app.bsky.feed.post/"+rkey)
+
+		failGates = true
+		defer func() { failGates = false }()
+
+		_, _, err = client.PostToFeed(ctx, feedPost, opts...)
+		assert.Error(t, err)
+		assert.Empty(t, deleted, "a post published by an earlier attempt is never rolled back")
+		assert.Contains(t, records, "app.bsky.feed.post/"+rkey)
+	})
+
+	t.Run("deletes a new post if gates fail", func(t *testing.T) {
+		deleted = nil
+		failGates = true
+		defer func() { failGates = false }()
+
+		rkey := utils.NewTID().String()
+		_, _, err := client.PostToFeed(ctx, feedPost, WithRkey(rkey), WithThreadgate(post.Threadgate{AllowMentioned: true}))
+
+		assert.Error(t, err)
+		assert.Equal(t, []string{"app.bsky.feed.post/" + rkey}, deleted)
+	})
+}
+
+func TestDetachQuote(t *testing.T) {
+	var put map[string]any
+
+	client, _ := newTestPDS(t, map[string]http.HandlerFunc{
+		"com.atproto.repo.getRecord": func(w http.ResponseWriter, r *http.Request) {
+			writeJSON(w, `{
+				"uri": "at://did:plc:test/app.bsky.feed.postgate/3kabc",
+				"cid": "cid-gate",
+				"value": {
+					"$type": "app.bsky.feed.postgate",
+					"post": "at://did:plc:test/app.bsky.feed.post/3kabc",
+					"createdAt": "2024-01-01T00:00:00Z",
+					"detachedEmbeddingUris": ["at://did:plc:a/app.bsky.feed.post/1"],
+					"embeddingRules": [{"$type": "app.bsky.feed.postgate#disableRule"}]
+				}
+			}`)
+		},
+		"com.atproto.repo.putRecord": func(w http.ResponseWriter, r *http.Request) {
+			json.NewDecoder(r.Body).Decode(&put)
+			writeJSON(w, `{"uri": "at://did:plc:test/app.bsky.feed.postgate/3kabc", "cid": "cid-gate-2"}`)
+		},
+	})
+
+	ctx := context.Background()
+	err := client.DetachQuote(ctx, "at://did:plc:test/app.bsky.feed.post/3kabc", "at://did:plc:b/app.bsky.feed.post/2")
+	assert.NoError(t, err)
+
+	assert.Equal(t, "app.bsky.feed.postgate", put["collection"])
+	assert.Equal(t, "3kabc", put["rkey"])
+	record := put["record"].(map[string]any)
+	assert.Equal(t, []any{
+		"at://did:plc:a/app.bsky.feed.post/1",
+		"at://did:plc:b/app.bsky.feed.post/2",
+	}, record["detachedEmbeddingUris"])
+	assert.Len(t, record["embeddingRules"], 1)
+
+	err = client.UpdateThreadgate(ctx, "at://did:plc:someone-else/app.bsky.feed.post/3kabc", post.Threadgate{})
+	assert.Error(t, err)
+}
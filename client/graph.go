@@ -0,0 +1,68 @@
+package client
+
+import (
+	"context"
+	"fmt"
+
+	appbsky "github.com/bluesky-social/indigo/api/bsky"
+)
+
+// Followers returns a Paginator over the accounts that follow a user, given by
+// handle or DID
+//
+// Example:
+//
+//	followers, err := client.Followers("alice.bsky.social").WithPageSize(100).Collect(ctx)
+func (c *BskyClient) Followers(actor string) *Paginator[*appbsky.ActorDefs_ProfileView] {
+	return paginate(c, func(ctx context.Context, cursor string, limit int64) ([]*appbsky.ActorDefs_ProfileView, string, error) {
+		resp, err := appbsky.GraphGetFollowers(ctx, c.client, actor, cursor, limit)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to get followers: %w", err)
+		}
+		return resp.Followers, stringValue(resp.Cursor), nil
+	})
+}
+
+// Follows returns a Paginator over the accounts a user follows, given by
+// handle or DID
+func (c *BskyClient) Follows(actor string) *Paginator[*appbsky.ActorDefs_ProfileView] {
+	return paginate(c, func(ctx context.Context, cursor string, limit int64) ([]*appbsky.ActorDefs_ProfileView, string, error) {
+		resp, err := appbsky.GraphGetFollows(ctx, c.client, actor, cursor, limit)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to get follows: %w", err)
+		}
+		return resp.Follows, stringValue(resp.Cursor), nil
+	})
+}
+
+// Likes returns a Paginator over the likes of the post with the given URI
+//
+// Example:
+//
+//	for like, err := range client.Likes(uri).All(ctx) {
+//	    if err != nil {
+//	        return err
+//	    }
+//	    fmt.Println(like.Actor.Handle, "liked it at", like.CreatedAt)
+//	}
+func (c *BskyClient) Likes(uri string) *Paginator[*appbsky.FeedGetLikes_Like] {
+	return paginate(c, func(ctx context.Context, cursor string, limit int64) ([]*appbsky.FeedGetLikes_Like, string, error) {
+		resp, err := appbsky.FeedGetLikes(ctx, c.client, "", cursor, limit, uri)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to get likes: %w", err)
+		}
+		return resp.Likes, stringValue(resp.Cursor), nil
+	})
+}
+
+// RepostedBy returns a Paginator over the accounts that reposted the post with
+// the given URI
+func (c *BskyClient) RepostedBy(uri string) *Paginator[*appbsky.ActorDefs_ProfileView] {
+	return paginate(c, func(ctx context.Context, cursor string, limit int64) ([]*appbsky.ActorDefs_ProfileView, string, error) {
+		resp, err := appbsky.FeedGetRepostedBy(ctx, c.client, "", cursor, limit, uri)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to get reposts: %w", err)
+		}
+		return resp.RepostedBy, stringValue(resp.Cursor), nil
+	})
+}
@@ -0,0 +1,411 @@
+package client
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bluesky-social/indigo/api/atproto"
+	appbsky "github.com/bluesky-social/indigo/api/bsky"
+	lexutil "github.com/bluesky-social/indigo/lex/util"
+
+	"github.com/watzon/lining/post"
+	"github.com/watzon/lining/utils"
+)
+
+// ErrWriteRejected is returned when a write hook rejects a record write. The
+// hook's own error is wrapped alongside it.
+var ErrWriteRejected = errors.New("write rejected")
+
+// ErrBlockedKeyword is returned by the BlockKeywords hook
+var ErrBlockedKeyword = errors.New("post contains a blocked keyword")
+
+// ErrDuplicatePost is returned by the RejectDuplicates hook
+var ErrDuplicatePost = errors.New("duplicate post")
+
+// WriteOp is the kind of change a Write makes to a repo
+type WriteOp string
+
+const (
+	WriteCreate WriteOp = "create"
+	WriteUpdate WriteOp = "update"
+	WriteDelete WriteOp = "delete"
+)
+
+// Write is a record write about to be sent to the PDS. Write hooks can modify
+// the record in place, annotate the write, or reject it by returning an error.
+type Write struct {
+	Op         WriteOp
+	Repo       string
+	Collection string
+	// Rkey is the record key, or empty when the PDS will generate one
+	Rkey string
+	// Record is the record being written; nil for deletes
+	Record *lexutil.LexiconTypeDecoder
+	// Annotations are notes attached by hooks, for example for audit logging
+	Annotations map[string]string
+	// DryRun is true when the write will be logged instead of sent
+	DryRun bool
+
+	onResult []func(uri string, err error)
+}
+
+// Post returns the record as a post, or nil if the write isn't a post
+func (w *Write) Post() *appbsky.FeedPost {
+	if w.Record == nil {
+		return nil
+	}
+	p, _ := w.Record.Val.(*appbsky.FeedPost)
+	return p
+}
+
+// Annotate attaches a note to the write
+func (w *Write) Annotate(key, value string) {
+	if w.Annotations == nil {
+		w.Annotations = make(map[string]string)
+	}
+	w.Annotations[key] = value
+}
+
+// OnResult registers a function to call once the write has been sent, was
+// rejected or failed. uri is the URI of the written record when err is nil.
+func (w *Write) OnResult(fn func(uri string, err error)) {
+	w.onResult = append(w.onResult, fn)
+}
+
+// uri returns the AT URI of the record, if its key is known
+func (w *Write) uri() string {
+	if w.Rkey == "" {
+		return ""
+	}
+	return fmt.Sprintf("at://%s/%s/%s", w.Repo, w.Collection, w.Rkey)
+}
+
+func (w *Write) finish(uri string, err error) {
+	for _, fn := range w.onResult {
+		fn(uri, err)
+	}
+}
+
+// WriteHook is middleware run before every record write made by the client.
+// Returning an error rejects the write.
+type WriteHook func(ctx context.Context, w *Write) error
+
+// AddWriteHook registers hooks that run, in the order they were added, before
+// every record the client creates, updates or deletes. Hooks run for posts,
+// gates, follows and any other record.
+//
+// Example:
+//
+//	client.AddWriteHook(
+//	    client.BlockKeywords("crypto giveaway"),
+//	    client.RejectDuplicates(time.Hour),
+//	    client.AuditLog(os.Stderr),
+//	)
+func (c *BskyClient) AddWriteHook(hooks ...WriteHook) {
+	c.hooksMu.Lock()
+	defer c.hooksMu.Unlock()
+	c.hooks = append(c.hooks, hooks...)
+}
+
+// runWriteHooks runs every hook on each of the writes. If any write is
+// rejected, the whole batch is.
+func (c *BskyClient) runWriteHooks(ctx context.Context, writes ...*Write) error {
+	c.hooksMu.RLock()
+	hooks := c.hooks
+	c.hooksMu.RUnlock()
+
+	for _, w := range writes {
+		w.DryRun = c.cfg.DryRun
+		for _, hook := range hooks {
+			if err := hook(ctx, w); err != nil {
+				err = fmt.Errorf("%w: %s %s: %w", ErrWriteRejected, w.Op, w.Collection, err)
+				for _, w := range writes {
+					w.finish("", err)
+				}
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// logDryRun logs a write the client didn't send
+func logDryRun(w *Write) {
+	record := []byte("null")
+	if w.Record != nil {
+		if data, err := json.Marshal(w.Record); err == nil {
+			record = data
+		}
+	}
+	log.Printf("dry run: %s %s/%s/%s: %s", w.Op, w.Repo, w.Collection, w.Rkey, record)
+}
+
+// createRecord runs the write hooks and creates a record, returning its URI
+// and CID. When rkey is set the record is written with putRecord, so sending
+// it again is idempotent. In dry-run mode the record is logged instead and
+// gets a made-up URI and an empty CID.
+func (c *BskyClient) createRecord(ctx context.Context, collection string, rkey string, record *lexutil.LexiconTypeDecoder) (string, string, error) {
+	w := &Write{Op: WriteCreate, Repo: c.client.Auth.Did, Collection: collection, Rkey: rkey, Record: record}
+	if err := c.runWriteHooks(ctx, w); err != nil {
+		return "", "", err
+	}
+
+	if w.DryRun {
+		if w.Rkey == "" {
+			w.Rkey = utils.NewTID().String()
+		}
+		logDryRun(w)
+		w.finish(w.uri(), nil)
+		return w.uri(), "", nil
+	}
+
+	var uri, cid string
+	if w.Rkey != "" {
+		resp, err := atproto.RepoPutRecord(ctx, c.client, &atproto.RepoPutRecord_Input{
+			Collection: collection,
+			Repo:       w.Repo,
+			Rkey:       w.Rkey,
+			Record:     record,
+		})
+		if err != nil {
+			w.finish("", err)
+			return "", "", err
+		}
+		uri, cid = resp.Uri, resp.Cid
+	} else {
+		resp, err := atproto.RepoCreateRecord(ctx, c.client, &atproto.RepoCreateRecord_Input{
+			Collection: collection,
+			Repo:       w.Repo,
+			Record:     record,
+		})
+		if err != nil {
+			w.finish("", err)
+			return "", "", err
+		}
+		uri, cid = resp.Uri, resp.Cid
+	}
+	w.finish(uri, nil)
+	return uri, cid, nil
+}
+
+// putRecord runs the write hooks and creates or replaces a record
+func (c *BskyClient) putRecord(ctx context.Context, collection string, rkey string, record *lexutil.LexiconTypeDecoder) error {
+	w := &Write{Op: WriteUpdate, Repo: c.client.Auth.Did, Collection: collection, Rkey: rkey, Record: record}
+	return c.sendWrite(ctx, w, func() error {
+		_, err := atproto.RepoPutRecord(ctx, c.client, &atproto.RepoPutRecord_Input{
+			Collection: collection,
+			Repo:       w.Repo,
+			Rkey:       rkey,
+			Record:     record,
+		})
+		return err
+	})
+}
+
+// deleteRecord runs the write hooks and deletes a record
+func (c *BskyClient) deleteRecord(ctx context.Context, collection string, rkey string) error {
+	w := &Write{Op: WriteDelete, Repo: c.client.Auth.Did, Collection: collection, Rkey: rkey}
+	return c.sendWrite(ctx, w, func() error {
+		_, err := atproto.RepoDeleteRecord(ctx, c.client, &atproto.RepoDeleteRecord_Input{
+			Collection: collection,
+			Repo:       w.Repo,
+			Rkey:       rkey,
+		})
+		return err
+	})
+}
+
+// sendWrite runs the write hooks and, unless in dry-run mode, calls send
+func (c *BskyClient) sendWrite(ctx context.Context, w *Write, send func() error) error {
+	if err := c.runWriteHooks(ctx, w); err != nil {
+		return err
+	}
+	if w.DryRun {
+		logDryRun(w)
+		w.finish(w.uri(), nil)
+		return nil
+	}
+	if err := send(); err != nil {
+		w.finish("", err)
+		return err
+	}
+	w.finish(w.uri(), nil)
+	return nil
+}
+
+// PostHook adapts a function that inspects posts into a WriteHook. The
+// function only runs for posts being created or updated.
+//
+// Example:
+//
+//	client.AddWriteHook(client.PostHook(func(ctx context.Context, p *appbsky.FeedPost, w *client.Write) error {
+//	    if strings.Contains(p.Text, "TODO") {
+//	        return errors.New("post still contains a TODO")
+//	    }
+//	    return nil
+//	}))
+func PostHook(fn func(ctx context.Context, p *appbsky.FeedPost, w *Write) error) WriteHook {
+	return func(ctx context.Context, w *Write) error {
+		p := w.Post()
+		if p == nil || w.Op == WriteDelete {
+			return nil
+		}
+		return fn(ctx, p, w)
+	}
+}
+
+// BlockKeywords returns a WriteHook that rejects posts whose text or tags
+// contain any of the keywords as whole words or phrases, ignoring case.
+func BlockKeywords(keywords ...string) WriteHook {
+	quoted := make([]string, 0, len(keywords))
+	for _, keyword := range keywords {
+		if keyword = strings.TrimSpace(keyword); keyword != "" {
+			quoted = append(quoted, regexp.QuoteMeta(keyword))
+		}
+	}
+	if len(quoted) == 0 {
+		return func(ctx context.Context, w *Write) error { return nil }
+	}
+	pattern := regexp.MustCompile(`(?i)(?:^|[^\pL\pN_])(` + strings.Join(quoted, "|") + `)(?:[^\pL\pN_]|$)`)
+
+	return PostHook(func(ctx context.Context, p *appbsky.FeedPost, w *Write) error {
+		for _, text := range append([]string{p.Text}, p.Tags...) {
+			if m := pattern.FindStringSubmatch(text); m != nil {
+				return fmt.Errorf("%w: %q", ErrBlockedKeyword, m[1])
+			}
+		}
+		return nil
+	})
+}
+
+// RejectDuplicates returns a WriteHook that rejects a post if the client
+// already published one with the same text and embed within window. Only
+// posts that were actually written count.
+func RejectDuplicates(window time.Duration) WriteHook {
+	var mu sync.Mutex
+	recent := make(map[string]time.Time)
+	inFlight := make(map[string]bool)
+
+	return PostHook(func(ctx context.Context, p *appbsky.FeedPost, w *Write) error {
+		if w.Op != WriteCreate {
+			return nil
+		}
+		key := duplicateKey(p)
+
+		mu.Lock()
+		defer mu.Unlock()
+		now := time.Now()
+		for k, at := range recent {
+			if now.Sub(at) > window {
+				delete(recent, k)
+			}
+		}
+		if _, ok := recent[key]; ok || inFlight[key] {
+			return fmt.Errorf("%w: an identical post was published in the last %s", ErrDuplicatePost, window)
+		}
+
+		inFlight[key] = true
+		w.OnResult(func(uri string, err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			delete(inFlight, key)
+			if err == nil {
+				recent[key] = time.Now()
+			}
+		})
+		return nil
+	})
+}
+
+// duplicateKey hashes the parts of a post that make it a duplicate
+func duplicateKey(p *appbsky.FeedPost) string {
+	h := sha256.New()
+	h.Write([]byte(strings.TrimSpace(p.Text)))
+	if p.Embed != nil {
+		if data, err := json.Marshal(p.Embed); err == nil {
+			h.Write([]byte{0})
+			h.Write(data)
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// AddSelfLabels returns a WriteHook that adds the self-labels to every post
+// that doesn't have them yet. Labels must be well-formed label values, such
+// as post.LabelGraphicMedia.
+func AddSelfLabels(labels ...string) WriteHook {
+	return PostHook(func(ctx context.Context, p *appbsky.FeedPost, w *Write) error {
+		if p.Labels == nil || p.Labels.LabelDefs_SelfLabels == nil {
+			p.Labels = &appbsky.FeedPost_Labels{
+				LabelDefs_SelfLabels: &atproto.LabelDefs_SelfLabels{LexiconTypeID: "com.atproto.label.defs#selfLabels"},
+			}
+		}
+		self := p.Labels.LabelDefs_SelfLabels
+		for _, label := range labels {
+			present := false
+			for _, existing := range self.Values {
+				if existing.Val == label {
+					present = true
+					break
+				}
+			}
+			if !present {
+				self.Values = append(self.Values, &atproto.LabelDefs_SelfLabel{Val: label})
+			}
+		}
+		return post.ValidateSelfLabels(p)
+	})
+}
+
+// auditEntry is a line written by the AuditLog hook
+type auditEntry struct {
+	Time        time.Time         `json:"time"`
+	Op          WriteOp           `json:"op"`
+	Repo        string            `json:"repo"`
+	Collection  string            `json:"collection"`
+	Rkey        string            `json:"rkey,omitempty"`
+	Uri         string            `json:"uri,omitempty"`
+	DryRun      bool              `json:"dryRun,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+	Error       string            `json:"error,omitempty"`
+}
+
+// AuditLog returns a WriteHook that writes one JSON line to out for every
+// write once it has been sent, rejected or failed, including the annotations
+// left by other hooks. Register it first so it sees rejections by later hooks.
+func AuditLog(out io.Writer) WriteHook {
+	var mu sync.Mutex
+	return func(ctx context.Context, w *Write) error {
+		w.OnResult(func(uri string, err error) {
+			entry := auditEntry{
+				Time:        time.Now().UTC(),
+				Op:          w.Op,
+				Repo:        w.Repo,
+				Collection:  w.Collection,
+				Rkey:        w.Rkey,
+				Uri:         uri,
+				DryRun:      w.DryRun,
+				Annotations: w.Annotations,
+			}
+			if err != nil {
+				entry.Error = err.Error()
+			}
+			data, _ := json.Marshal(entry)
+
+			mu.Lock()
+			defer mu.Unlock()
+			out.Write(append(data, '\n'))
+		})
+		return nil
+	}
+}
@@ -0,0 +1,161 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	appbsky "github.com/bluesky-social/indigo/api/bsky"
+	"github.com/stretchr/testify/assert"
+	"github.com/watzon/lining/post"
+)
+
+func TestWriteHooks(t *testing.T) {
+	var created []map[string]any
+	client, _ := newTestPDS(t, map[string]http.HandlerFunc{
+		"com.atproto.repo.putRecord": func(w http.ResponseWriter, r *http.Request) {
+			var input map[string]any
+			json.NewDecoder(r.Body).Decode(&input)
+			created = append(created, input)
+			writeJSON(w, `{"uri": "at://did:plc:test/app.bsky.feed.post/3kabc", "cid": "cid-post"}`)
+		},
+		"com.atproto.repo.listRecords": func(w http.ResponseWriter, r *http.Request) {
+			writeJSON(w, `{"records": [{"uri": "at://did:plc:test/app.bsky.graph.follow/3kfollow", "cid": "cid-follow", "value": {"$type": "app.bsky.graph.follow", "subject": "did:plc:friend", "createdAt": "2024-01-01T00:00:00Z"}}]}`)
+		},
+		"com.atproto.repo.deleteRecord": func(w http.ResponseWriter, r *http.Request) {
+			writeJSON(w, `{}`)
+		},
+	})
+	ctx := context.Background()
+
+	var audit bytes.Buffer
+	client.AddWriteHook(
+		AuditLog(&audit),
+		BlockKeywords("giveaway"),
+		AddSelfLabels(post.LabelGraphicMedia),
+		PostHook(func(ctx context.Context, p *appbsky.FeedPost, w *Write) error {
+			w.Annotate("linted", "true")
+			return nil
+		}),
+	)
+
+	t.Run("modifies and annotates posts", func(t *testing.T) {
+		created, audit = nil, bytes.Buffer{}
+
+		_, uri, err := client.PostToFeed(ctx, appbsky.FeedPost{Text: "hello"})
+
+		assert.NoError(t, err)
+		assert.Equal(t, "at://did:plc:test/app.bsky.feed.post/3kabc", uri)
+		assert.Len(t, created, 1)
+		labels := created[0]["record"].(map[string]any)["labels"].(map[string]any)
+		assert.Equal(t, "graphic-media", labels["values"].([]any)[0].(map[string]any)["val"])
+
+		var entry auditEntry
+		assert.NoError(t, json.Unmarshal(audit.Bytes(), &entry))
+		assert.Equal(t, WriteCreate, entry.Op)
+		assert.Equal(t, uri, entry.Uri)
+		assert.Equal(t, map[string]string{"linted": "true"}, entry.Annotations)
+	})
+
+	t.Run("rejects blocked keywords", func(t *testing.T) {
+		created, audit = nil, bytes.Buffer{}
+
+		_, _, err := client.PostToFeed(ctx, appbsky.FeedPost{Text: "Huge GIVEAWAY today!"})
+
+		assert.ErrorIs(t, err, ErrWriteRejected)
+		assert.ErrorIs(t, err, ErrBlockedKeyword)
+		assert.Empty(t, created)
+		assert.Contains(t, audit.String(), "blocked keyword")
+	})
+
+	t.Run("only matches whole words", func(t *testing.T) {
+		created = nil
+
+		_, _, err := client.PostToFeed(ctx, appbsky.FeedPost{Text: "giveaways are fine"})
+
+		assert.NoError(t, err)
+		assert.Len(t, created, 1)
+	})
+
+	t.Run("runs on other records", func(t *testing.T) {
+		audit = bytes.Buffer{}
+
+		assert.NoError(t, client.Unfollow(ctx, "did:plc:friend"))
+
+		var entry auditEntry
+		assert.NoError(t, json.Unmarshal(audit.Bytes(), &entry))
+		assert.Equal(t, WriteDelete, entry.Op)
+		assert.Equal(t, "app.bsky.graph.follow", entry.Collection)
+		assert.Equal(t, "3kfollow", entry.Rkey)
+	})
+}
+
+func TestRejectDuplicates(t *testing.T) {
+	fail := false
+	client, _ := newTestPDS(t, map[string]http.HandlerFunc{
+		"com.atproto.repo.putRecord": func(w http.ResponseWriter, r *http.Request) {
+			if fail {
+				w.WriteHeader(http.StatusInternalServerError)
+				writeJSON(w, `{"error": "InternalServerError"}`)
+				return
+			}
+			writeJSON(w, `{"uri": "at://did:plc:test/app.bsky.feed.post/3kabc", "cid": "cid-post"}`)
+		},
+	})
+	client.AddWriteHook(RejectDuplicates(time.Hour))
+	ctx := context.Background()
+
+	t.Run("failed writes don't count", func(t *testing.T) {
+		fail = true
+		_, _, err := client.PostToFeed(ctx, appbsky.FeedPost{Text: "once"})
+		assert.Error(t, err)
+		assert.False(t, errors.Is(err, ErrDuplicatePost))
+		fail = false
+
+		_, _, err = client.PostToFeed(ctx, appbsky.FeedPost{Text: "once"})
+		assert.NoError(t, err)
+	})
+
+	t.Run("rejects a repeated post", func(t *testing.T) {
+		_, _, err := client.PostToFeed(ctx, appbsky.FeedPost{Text: "once"})
+		assert.ErrorIs(t, err, ErrDuplicatePost)
+
+		_, _, err = client.PostToFeed(ctx, appbsky.FeedPost{Text: "twice"})
+		assert.NoError(t, err)
+	})
+}
+
+func TestDryRun(t *testing.T) {
+	sent := 0
+	client, _ := newTestPDS(t, map[string]http.HandlerFunc{
+		"com.atproto.repo.putRecord": func(w http.ResponseWriter, r *http.Request) {
+			sent++
+			writeJSON(w, `{"uri": "at://did:plc:test/app.bsky.feed.post/3kabc", "cid": "cid-post"}`)
+		},
+	})
+	client.GetConfig().WithDryRun(true)
+
+	var audit bytes.Buffer
+	client.AddWriteHook(AuditLog(&audit))
+
+	cid, uri, err := client.PostToFeed(context.Background(), appbsky.FeedPost{Text: "not really"},
+		WithThreadgate(post.Threadgate{AllowFollowing: true}),
+	)
+
+	assert.NoError(t, err)
+	assert.Zero(t, sent)
+	assert.Empty(t, cid)
+	assert.True(t, strings.HasPrefix(uri, "at://did:plc:test/app.bsky.feed.post/"))
+
+	lines := strings.Split(strings.TrimSpace(audit.String()), "\n")
+	assert.Len(t, lines, 2)
+	var entry auditEntry
+	assert.NoError(t, json.Unmarshal([]byte(lines[1]), &entry))
+	assert.True(t, entry.DryRun)
+	assert.Equal(t, "app.bsky.feed.threadgate", entry.Collection)
+}
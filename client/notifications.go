@@ -0,0 +1,285 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	appbsky "github.com/bluesky-social/indigo/api/bsky"
+	"github.com/bluesky-social/indigo/xrpc"
+
+	"github.com/watzon/lining/notification"
+)
+
+// listNotifications fetches a page of notifications and the time the account
+// last marked them as seen
+func (c *BskyClient) listNotifications(ctx context.Context, cursor string, limit int64) ([]*notification.Notification, string, time.Time, error) {
+	params := map[string]any{"limit": limit}
+	if cursor != "" {
+		params["cursor"] = cursor
+	}
+
+	var out appbsky.NotificationListNotifications_Output
+	if err := c.client.Do(ctx, xrpc.Query, "", "app.bsky.notification.listNotifications", params, nil, &out); err != nil {
+		return nil, "", time.Time{}, fmt.Errorf("failed to list notifications: %w", err)
+	}
+
+	notifications := make([]*notification.Notification, 0, len(out.Notifications))
+	for _, n := range out.Notifications {
+		converted, err := notification.FromListNotifications(n)
+		if err != nil {
+			return nil, "", time.Time{}, err
+		}
+		notifications = append(notifications, converted)
+	}
+
+	var seenAt time.Time
+	if out.SeenAt != nil {
+		seenAt, _ = time.Parse(time.RFC3339, *out.SeenAt)
+	}
+	return notifications, stringValue(out.Cursor), seenAt, nil
+}
+
+// ListNotifications returns a Paginator over the authenticated account's
+// notifications, newest first
+//
+// Example:
+//
+//	for n, err := range client.ListNotifications().WithMaxItems(100).All(ctx) {
+//	    if err != nil {
+//	        return err
+//	    }
+//	    fmt.Println(n.Reason, n.Author.Handle)
+//	}
+func (c *BskyClient) ListNotifications() *Paginator[*notification.Notification] {
+	return paginate(c, func(ctx context.Context, cursor string, limit int64) ([]*notification.Notification, string, error) {
+		notifications, next, _, err := c.listNotifications(ctx, cursor, limit)
+		return notifications, next, err
+	})
+}
+
+// UnreadNotificationCount returns the number of notifications that arrived
+// since the account last marked them as seen
+func (c *BskyClient) UnreadNotificationCount(ctx context.Context) (int64, error) {
+	if err := c.ensureValidSession(ctx); err != nil {
+		return 0, err
+	}
+
+	var out appbsky.NotificationGetUnreadCount_Output
+	if err := c.client.Do(ctx, xrpc.Query, "", "app.bsky.notification.getUnreadCount", nil, nil, &out); err != nil {
+		return 0, fmt.Errorf("failed to get unread count: %w", err)
+	}
+	return out.Count, nil
+}
+
+// UpdateSeen marks the notifications that arrived up to seenAt as seen
+func (c *BskyClient) UpdateSeen(ctx context.Context, seenAt time.Time) error {
+	if err := c.ensureValidSession(ctx); err != nil {
+		return err
+	}
+
+	input := &appbsky.NotificationUpdateSeen_Input{SeenAt: seenAt.UTC().Format(time.RFC3339Nano)}
+	if err := appbsky.NotificationUpdateSeen(ctx, c.client, input); err != nil {
+		return fmt.Errorf("failed to update seen: %w", err)
+	}
+	return nil
+}
+
+// PollOptions configures a NotificationPoller
+type PollOptions struct {
+	// Interval is the time between polls
+	Interval time.Duration
+	// OnError receives handler errors and errors from individual polls. It
+	// may be nil.
+	OnError func(error)
+}
+
+// PollOption is a function that configures a PollOptions struct
+type PollOption func(*PollOptions)
+
+// WithPollInterval returns a PollOption that sets the time between polls
+func WithPollInterval(interval time.Duration) PollOption {
+	return func(opts *PollOptions) {
+		opts.Interval = interval
+	}
+}
+
+// WithPollErrorHandler returns a PollOption that receives the errors of
+// handlers and polls
+func WithPollErrorHandler(fn func(error)) PollOption {
+	return func(opts *PollOptions) {
+		opts.OnError = fn
+	}
+}
+
+// DefaultPollOptions returns the default options of a NotificationPoller
+func DefaultPollOptions() PollOptions {
+	return PollOptions{Interval: 30 * time.Second}
+}
+
+// NotificationPoller checks the authenticated account's notifications and
+// dispatches new ones to its callbacks, oldest first.
+//
+// The poller tracks the account's seenAt: after each poll it marks the
+// notifications it handled as seen, and on startup it picks up from where
+// the account's seenAt was left, so a notification is only handled once,
+// even across restarts. An account that has never marked its notifications
+// as seen starts with all of them. A notification whose handler fails is
+// reported to OnError and not retried, so that it can't hold up the ones
+// after it.
+type NotificationPoller struct {
+	client    *BskyClient
+	callbacks *notification.Callbacks
+	opts      PollOptions
+
+	mu      sync.Mutex
+	started bool
+	seenAt  time.Time
+	// unsaved is set while the account's seenAt lags behind seenAt
+	unsaved bool
+	// handled holds the URIs of the notifications indexed at seenAt that
+	// were handled
+	handled map[string]bool
+}
+
+// NewNotificationPoller returns a poller that dispatches notifications to
+// callbacks
+//
+// Example:
+//
+//	poller := client.NewNotificationPoller(&notification.Callbacks{
+//	    MentionHandlers: []notification.PostHandlerWithFilter{{
+//	        Handler: func(p *post.Post) error {
+//	            log.Printf("%s mentioned us: %s", p.Author.Handle, p.Text)
+//	            return nil
+//	        },
+//	    }},
+//	}, client.WithPollInterval(time.Minute))
+//	go poller.Run(ctx)
+func (c *BskyClient) NewNotificationPoller(callbacks *notification.Callbacks, opts ...PollOption) *NotificationPoller {
+	options := DefaultPollOptions()
+	for _, opt := range opts {
+		opt(&options)
+	}
+	if callbacks == nil {
+		callbacks = &notification.Callbacks{}
+	}
+	return &NotificationPoller{client: c, callbacks: callbacks, opts: options, handled: make(map[string]bool)}
+}
+
+// PollNotifications dispatches new notifications to callbacks until ctx is
+// cancelled. It's a shortcut for NewNotificationPoller(...).Run(ctx).
+func (c *BskyClient) PollNotifications(ctx context.Context, callbacks *notification.Callbacks, opts ...PollOption) error {
+	return c.NewNotificationPoller(callbacks, opts...).Run(ctx)
+}
+
+// SeenAt returns the time up to which notifications have been handled
+func (p *NotificationPoller) SeenAt() time.Time {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.seenAt
+}
+
+// Poll fetches the notifications that arrived since the last poll, dispatches
+// them and marks them as seen. It returns the number of notifications
+// dispatched. Handler errors go to OnError and don't stop the poll.
+func (p *NotificationPoller) Poll(ctx context.Context) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if err := p.client.ensureValidSession(ctx); err != nil {
+		return 0, err
+	}
+
+	var fresh []*notification.Notification
+	cursor := ""
+	for {
+		if err := p.client.limiter.Wait(ctx); err != nil {
+			return 0, fmt.Errorf("rate limit exceeded: %w", err)
+		}
+		page, next, serverSeenAt, err := p.client.listNotifications(ctx, cursor, maxPageSize)
+		if err != nil {
+			return 0, err
+		}
+		if !p.started {
+			p.started = true
+			p.seenAt = serverSeenAt
+		}
+
+		older := false
+		for _, n := range page {
+			if p.isNew(n) {
+				fresh = append(fresh, n)
+			} else if n.Time().Before(p.seenAt) {
+				older = true
+			}
+		}
+		if older || next == "" || next == cursor {
+			break
+		}
+		cursor = next
+	}
+	if len(fresh) == 0 && !p.unsaved {
+		return 0, nil
+	}
+
+	sort.SliceStable(fresh, func(i, j int) bool {
+		return fresh[i].Time().Before(fresh[j].Time())
+	})
+	for _, n := range fresh {
+		if err := p.callbacks.Dispatch(n); err != nil && p.opts.OnError != nil {
+			p.opts.OnError(fmt.Errorf("failed to handle %s notification %s: %w", n.Reason, n.Uri, err))
+		}
+		if at := n.Time(); at.After(p.seenAt) {
+			p.seenAt = at
+			clear(p.handled)
+		}
+		p.handled[n.Uri] = true
+		p.unsaved = true
+	}
+
+	if err := p.client.UpdateSeen(ctx, p.seenAt); err != nil {
+		return len(fresh), err
+	}
+	p.unsaved = false
+	return len(fresh), nil
+}
+
+// isNew reports whether a notification hasn't been handled yet. The caller
+// must hold p.mu.
+func (p *NotificationPoller) isNew(n *notification.Notification) bool {
+	at := n.Time()
+	if at.After(p.seenAt) {
+		return true
+	}
+	// Notifications indexed at the account's seenAt from before the poller
+	// started were handled by an earlier run
+	return at.Equal(p.seenAt) && len(p.handled) > 0 && !p.handled[n.Uri]
+}
+
+// Run polls for notifications every interval until ctx is cancelled, and
+// then returns ctx.Err()
+func (p *NotificationPoller) Run(ctx context.Context) error {
+	return runPoller(ctx, p.opts, p.Poll)
+}
+
+// runPoller calls poll every interval until ctx is cancelled, and then
+// returns ctx.Err()
+func runPoller(ctx context.Context, opts PollOptions, poll func(context.Context) (int, error)) error {
+	ticker := time.NewTicker(opts.Interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := poll(ctx); err != nil && ctx.Err() == nil && opts.OnError != nil {
+			opts.OnError(err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
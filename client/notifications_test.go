@@ -0,0 +1,181 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/watzon/lining/interaction"
+	"github.com/watzon/lining/notification"
+	"github.com/watzon/lining/post"
+)
+
+// fakeNotifications serves a list of notifications, newest first, and keeps
+// track of the account's seenAt
+type fakeNotifications struct {
+	mu     sync.Mutex
+	items  []string
+	seenAt string
+}
+
+func (f *fakeNotifications) add(reason string, minute int, record string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	rkey := fmt.Sprintf("3k%s%02d", reason, minute)
+	collection := "app.bsky.feed.post"
+	subject := ""
+	switch reason {
+	case "like":
+		collection = "app.bsky.feed.like"
+		subject = `"reasonSubject": "at://did:plc:test/app.bsky.feed.post/3kmine",`
+	case "follow":
+		collection = "app.bsky.graph.follow"
+	case "reply", "quote":
+		subject = `"reasonSubject": "at://did:plc:test/app.bsky.feed.post/3kmine",`
+	}
+	item := fmt.Sprintf(`{
+		"uri": "at://did:plc:alice/%s/%s", "cid": "cid-%s",
+		"author": {"did": "did:plc:alice", "handle": "alice.test"},
+		"reason": "%s", %s
+		"record": %s,
+		"isRead": false,
+		"indexedAt": "2024-05-06T08:%02d:00.000Z"
+	}`, collection, rkey, rkey, reason, subject, record, minute)
+	f.items = append([]string{item}, f.items...)
+}
+
+func (f *fakeNotifications) handlers() map[string]http.HandlerFunc {
+	return map[string]http.HandlerFunc{
+		"app.bsky.notification.listNotifications": func(w http.ResponseWriter, r *http.Request) {
+			f.mu.Lock()
+			defer f.mu.Unlock()
+			// Two notifications per page
+			start := 0
+			fmt.Sscan(r.URL.Query().Get("cursor"), &start)
+			end := min(start+2, len(f.items))
+			cursor := ""
+			if end < len(f.items) {
+				cursor = fmt.Sprintf(`"cursor": "%d",`, end)
+			}
+			seenAt := ""
+			if f.seenAt != "" {
+				seenAt = fmt.Sprintf(`"seenAt": "%s",`, f.seenAt)
+			}
+			writeJSON(w, `{`+cursor+seenAt+`"notifications": [`+strings.Join(f.items[start:end], ",")+`]}`)
+		},
+		"app.bsky.notification.updateSeen": func(w http.ResponseWriter, r *http.Request) {
+			f.mu.Lock()
+			defer f.mu.Unlock()
+			var input map[string]string
+			json.NewDecoder(r.Body).Decode(&input)
+			f.seenAt = input["seenAt"]
+			w.WriteHeader(http.StatusOK)
+		},
+		"app.bsky.notification.getUnreadCount": func(w http.ResponseWriter, r *http.Request) {
+			writeJSON(w, `{"count": 3}`)
+		},
+	}
+}
+
+func postRecord(text string) string {
+	return `{"$type": "app.bsky.feed.post", "text": "` + text + `", "createdAt": "2024-05-06T08:00:00Z"}`
+}
+
+func TestNotifications(t *testing.T) {
+	ctx := context.Background()
+	server := &fakeNotifications{seenAt: "2024-05-06T08:01:00.000Z"}
+	server.add("mention", 0, postRecord("old"))
+	server.add("mention", 1, postRecord("seen"))
+	server.add("follow", 2, `{"$type": "app.bsky.graph.follow", "subject": "did:plc:test", "createdAt": "2024-05-06T08:02:00Z"}`)
+	server.add("mention", 3, postRecord("@test.bsky.social help"))
+	server.add("like", 4, `{"$type": "app.bsky.feed.like", "subject": {"uri": "at://did:plc:test/app.bsky.feed.post/3kmine", "cid": "c"}, "createdAt": "2024-05-06T08:04:00Z"}`)
+	server.add("reply", 5, postRecord("nice"))
+
+	client, _ := newTestPDS(t, server.handlers())
+
+	var events []string
+	var errs []error
+	callbacks := &notification.Callbacks{
+		MentionHandlers: []notification.PostHandlerWithFilter{{
+			Handler: func(p *post.Post) error {
+				events = append(events, "mention:"+p.Text)
+				return nil
+			},
+			Filters: []notification.PostFilter{func(p *post.Post) bool { return strings.Contains(p.Text, "help") }},
+		}},
+		ReplyHandlers: []notification.PostHandlerWithFilter{{
+			Handler: func(p *post.Post) error {
+				events = append(events, "reply:"+p.Text)
+				return errors.New("reply failed")
+			},
+		}},
+		FollowHandlers: []interaction.FollowHandlerWithFilter{{
+			Handler: func(f *interaction.Follow) error {
+				events = append(events, "follow:"+f.Actor)
+				return nil
+			},
+		}},
+		LikeHandlers: []interaction.LikeHandlerWithFilter{{
+			Handler: func(l *interaction.Like) error {
+				events = append(events, "like:"+l.Uri)
+				return nil
+			},
+		}},
+	}
+	onError := WithPollErrorHandler(func(err error) { errs = append(errs, err) })
+
+	t.Run("lists and counts", func(t *testing.T) {
+		all, err := client.ListNotifications().Collect(ctx)
+		assert.NoError(t, err)
+		assert.Len(t, all, 6)
+		assert.Equal(t, notification.ReasonReply, all[0].Reason)
+		assert.Equal(t, "nice", all[0].Post.Text)
+		assert.Equal(t, "alice.test", all[0].Post.Author.Handle)
+
+		count, err := client.UnreadNotificationCount(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(3), count)
+	})
+
+	t.Run("dispatches new notifications oldest first", func(t *testing.T) {
+		poller := client.NewNotificationPoller(callbacks, onError)
+		n, err := poller.Poll(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, 4, n)
+		assert.Equal(t, []string{
+			"follow:did:plc:alice",
+			"mention:@test.bsky.social help",
+			"like:at://did:plc:test/app.bsky.feed.post/3kmine",
+			"reply:nice",
+		}, events)
+		assert.Len(t, errs, 1)
+		assert.ErrorContains(t, errs[0], "reply failed")
+		assert.Equal(t, "2024-05-06T08:05:00Z", server.seenAt)
+
+		events = nil
+		n, err = poller.Poll(ctx)
+		assert.NoError(t, err)
+		assert.Zero(t, n)
+
+		server.add("mention", 5, postRecord("same minute, help"))
+		n, err = poller.Poll(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, n)
+		assert.Equal(t, []string{"mention:same minute, help"}, events)
+	})
+
+	t.Run("restarts where the account left off", func(t *testing.T) {
+		events = nil
+		n, err := client.NewNotificationPoller(callbacks).Poll(ctx)
+		assert.NoError(t, err)
+		assert.Zero(t, n)
+		assert.Empty(t, events)
+	})
+}
@@ -0,0 +1,258 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"iter"
+	"net/http"
+	"time"
+
+	"github.com/bluesky-social/indigo/xrpc"
+)
+
+// maxPageSize is the largest page most list endpoints accept
+const maxPageSize = 100
+
+// defaultPageSize is the page size the client requests when none is set. The
+// generated XRPC functions always send a limit, and the AppView rejects zero.
+const defaultPageSize = 50
+
+// pageLimit returns limit, or defaultPageSize if it's zero
+func pageLimit(limit int64) int64 {
+	if limit <= 0 {
+		return defaultPageSize
+	}
+	return limit
+}
+
+// PageFetcher fetches the page of a list that starts at cursor and returns its
+// items and the cursor of the next page. An empty cursor fetches the first
+// page, and an empty next cursor means there are no more pages. A limit of
+// zero leaves the page size up to the fetcher.
+type PageFetcher[T any] func(ctx context.Context, cursor string, limit int64) ([]T, string, error)
+
+// Paginator walks a cursor-paginated list one item at a time, fetching pages
+// as it goes. Use Next and Item in a loop, or range over All.
+//
+// Requests that are rate limited by the server are retried once the limit
+// resets. A paginator is not safe for concurrent use.
+//
+// Example:
+//
+//	followers := client.Followers("alice.bsky.social").WithMaxItems(500)
+//	for followers.Next(ctx) {
+//	    fmt.Println(followers.Item().Handle)
+//	}
+//	if err := followers.Err(); err != nil {
+//	    log.Printf("stopped at %q: %v", followers.Cursor(), err)
+//	}
+type Paginator[T any] struct {
+	fetch PageFetcher[T]
+	// wait is called before every request
+	wait       func(ctx context.Context, first bool) error
+	pageSize   int64
+	maxItems   int
+	maxRetries int
+
+	cursor     string // cursor of the next page to fetch
+	pageCursor string // cursor the buffered page was fetched with
+	buf        []T
+	item       T
+	count      int
+	fetched    bool
+	done       bool
+	err        error
+}
+
+// NewPaginator returns a Paginator over the pages returned by fetch
+func NewPaginator[T any](fetch PageFetcher[T]) *Paginator[T] {
+	return &Paginator[T]{fetch: fetch, maxRetries: 3}
+}
+
+// paginate returns a Paginator that authenticates before the first page and
+// waits for the client's rate limiter before every page
+func paginate[T any](c *BskyClient, fetch PageFetcher[T]) *Paginator[T] {
+	p := NewPaginator(func(ctx context.Context, cursor string, limit int64) ([]T, string, error) {
+		return fetch(ctx, cursor, pageLimit(limit))
+	})
+	p.maxRetries = c.cfg.RetryAttempts
+	p.wait = func(ctx context.Context, first bool) error {
+		if first {
+			if err := c.ensureValidSession(ctx); err != nil {
+				return err
+			}
+		}
+		return c.limiter.Wait(ctx)
+	}
+	return p
+}
+
+// WithPageSize sets the number of items to request per page and returns the
+// paginator. Zero leaves it up to the list; the client's own lists then
+// request 50 items per page.
+func (p *Paginator[T]) WithPageSize(size int64) *Paginator[T] {
+	p.pageSize = size
+	return p
+}
+
+// WithMaxItems stops the paginator after n items and returns it. Zero means
+// no limit.
+func (p *Paginator[T]) WithMaxItems(n int) *Paginator[T] {
+	p.maxItems = n
+	return p
+}
+
+// WithCursor starts the paginator at a cursor saved from Cursor and returns
+// it
+func (p *Paginator[T]) WithCursor(cursor string) *Paginator[T] {
+	p.cursor = cursor
+	return p
+}
+
+// WithMaxRetries sets how many times a rate-limited request is retried before
+// the paginator gives up, and returns the paginator
+func (p *Paginator[T]) WithMaxRetries(n int) *Paginator[T] {
+	p.maxRetries = n
+	return p
+}
+
+// Next advances to the next item, fetching the next page when needed. It
+// returns false when the list is exhausted, the item limit is reached or an
+// error occurs; check Err to tell them apart.
+func (p *Paginator[T]) Next(ctx context.Context) bool {
+	if p.maxItems > 0 && p.count >= p.maxItems {
+		// The server may return more than the requested limit, so the rest
+		// of the page is dropped
+		p.done = true
+		return false
+	}
+	for len(p.buf) == 0 {
+		if p.done || p.err != nil {
+			return false
+		}
+		if p.fetched && p.cursor == "" {
+			p.done = true
+			return false
+		}
+		p.fetchPage(ctx)
+	}
+
+	p.item, p.buf = p.buf[0], p.buf[1:]
+	p.count++
+	return true
+}
+
+// fetchPage fetches the page at p.cursor into p.buf, retrying requests that
+// are rate limited
+func (p *Paginator[T]) fetchPage(ctx context.Context) {
+	limit := p.pageSize
+	if remaining := p.maxItems - p.count; p.maxItems > 0 && remaining <= maxPageSize && (limit == 0 || int64(remaining) < limit) {
+		limit = int64(remaining)
+	}
+
+	for attempt := 0; ; attempt++ {
+		if p.wait != nil {
+			if err := p.wait(ctx, !p.fetched && attempt == 0); err != nil {
+				p.err = err
+				return
+			}
+		}
+
+		items, next, err := p.fetch(ctx, p.cursor, limit)
+		if err == nil {
+			// A server that hands back the same cursor would loop forever
+			if next == p.cursor {
+				next = ""
+			}
+			p.fetched = true
+			p.pageCursor, p.cursor = p.cursor, next
+			p.buf = items
+			return
+		}
+
+		delay, limited := rateLimitDelay(err, attempt)
+		if !limited || attempt >= p.maxRetries {
+			p.err = err
+			return
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			p.err = ctx.Err()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+// rateLimitDelay reports whether err means the request was rate limited and,
+// if so, how long to wait before trying again
+func rateLimitDelay(err error, attempt int) (time.Duration, bool) {
+	var xerr *xrpc.Error
+	if !errors.As(err, &xerr) || xerr.StatusCode != http.StatusTooManyRequests {
+		return 0, false
+	}
+	if xerr.Ratelimit != nil {
+		if wait := time.Until(xerr.Ratelimit.Reset); wait > 0 {
+			return wait, true
+		}
+	}
+	return time.Second << attempt, true
+}
+
+// Item returns the current item
+func (p *Paginator[T]) Item() T {
+	return p.item
+}
+
+// Err returns the error that stopped the paginator, if any
+func (p *Paginator[T]) Err() error {
+	return p.err
+}
+
+// Cursor returns a cursor to resume from with WithCursor, for example after
+// an error or a restart. Resuming never skips items, but it may repeat items
+// from the page that was being read. An empty cursor resumes from the start of
+// the list, so check that the paginator didn't simply run out of items.
+func (p *Paginator[T]) Cursor() string {
+	if len(p.buf) > 0 {
+		return p.pageCursor
+	}
+	return p.cursor
+}
+
+// All returns an iterator over the remaining items. An error ends the
+// iteration and is yielded with the zero value of T.
+//
+// Example:
+//
+//	for p, err := range client.Timeline().WithMaxItems(200).All(ctx) {
+//	    if err != nil {
+//	        return err
+//	    }
+//	    fmt.Println(p.Text)
+//	}
+func (p *Paginator[T]) All(ctx context.Context) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		for p.Next(ctx) {
+			if !yield(p.item, nil) {
+				return
+			}
+		}
+		if p.err != nil {
+			var zero T
+			yield(zero, p.err)
+		}
+	}
+}
+
+// Collect returns the remaining items. On error it returns the items read so
+// far along with the error.
+func (p *Paginator[T]) Collect(ctx context.Context) ([]T, error) {
+	var items []T
+	for p.Next(ctx) {
+		items = append(items, p.item)
+	}
+	return items, p.err
+}
@@ -0,0 +1,184 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/bluesky-social/indigo/xrpc"
+	"github.com/stretchr/testify/assert"
+)
+
+// numberPages serves the numbers 0 to total-1 in pages of pageSize, using the
+// next number as the cursor
+func numberPages(total int, pageSize int, limits *[]int64) PageFetcher[int] {
+	return func(ctx context.Context, cursor string, limit int64) ([]int, string, error) {
+		if limits != nil {
+			*limits = append(*limits, limit)
+		}
+		start := 0
+		if cursor != "" {
+			start, _ = strconv.Atoi(cursor)
+		}
+		size := pageSize
+		if limit > 0 && int(limit) < size {
+			size = int(limit)
+		}
+		var items []int
+		for i := start; i < total && i < start+size; i++ {
+			items = append(items, i)
+		}
+		next := ""
+		if end := start + len(items); end < total {
+			next = strconv.Itoa(end)
+		}
+		return items, next, nil
+	}
+}
+
+func TestPaginator(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("walks every page", func(t *testing.T) {
+		items, err := NewPaginator(numberPages(7, 3, nil)).Collect(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, []int{0, 1, 2, 3, 4, 5, 6}, items)
+	})
+
+	t.Run("limits items and page size", func(t *testing.T) {
+		var limits []int64
+		items, err := NewPaginator(numberPages(100, 50, &limits)).WithPageSize(4).WithMaxItems(6).Collect(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, []int{0, 1, 2, 3, 4, 5}, items)
+		assert.Equal(t, []int64{4, 2}, limits)
+	})
+
+	t.Run("limits items when a page is larger than asked for", func(t *testing.T) {
+		ignoresLimit := func(ctx context.Context, cursor string, limit int64) ([]int, string, error) {
+			return numberPages(20, 10, nil)(ctx, cursor, 0)
+		}
+		items, err := NewPaginator(ignoresLimit).WithMaxItems(3).Collect(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, []int{0, 1, 2}, items)
+	})
+
+	t.Run("resumes from a cursor", func(t *testing.T) {
+		p := NewPaginator(numberPages(10, 4, nil)).WithMaxItems(5)
+		_, err := p.Collect(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, "5", p.Cursor())
+
+		items, err := NewPaginator(numberPages(10, 4, nil)).WithCursor(p.Cursor()).Collect(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, []int{5, 6, 7, 8, 9}, items)
+	})
+
+	t.Run("resuming mid-page repeats the page", func(t *testing.T) {
+		p := NewPaginator(numberPages(10, 4, nil))
+		for i := 0; i < 6; i++ {
+			p.Next(ctx)
+		}
+		assert.Equal(t, 5, p.Item())
+		assert.Equal(t, "4", p.Cursor())
+
+		items, err := NewPaginator(numberPages(10, 4, nil)).WithCursor(p.Cursor()).Collect(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, []int{4, 5, 6, 7, 8, 9}, items)
+	})
+
+	t.Run("stops on a repeated cursor", func(t *testing.T) {
+		calls := 0
+		items, err := NewPaginator(func(ctx context.Context, cursor string, limit int64) ([]int, string, error) {
+			calls++
+			return []int{calls}, "same", nil
+		}).Collect(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, []int{1, 2}, items)
+	})
+
+	t.Run("retries rate-limited pages", func(t *testing.T) {
+		calls := 0
+		fetch := numberPages(3, 2, nil)
+		p := NewPaginator(func(ctx context.Context, cursor string, limit int64) ([]int, string, error) {
+			calls++
+			if calls == 2 {
+				return nil, "", fmt.Errorf("failed to list: %w", &xrpc.Error{
+					StatusCode: http.StatusTooManyRequests,
+					Ratelimit:  &xrpc.RatelimitInfo{Reset: time.Now().Add(10 * time.Millisecond)},
+				})
+			}
+			return fetch(ctx, cursor, limit)
+		})
+
+		items, err := p.Collect(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, []int{0, 1, 2}, items)
+		assert.Equal(t, 3, calls)
+	})
+
+	t.Run("yields errors from All", func(t *testing.T) {
+		failure := errors.New("upstream failure")
+		fetch := numberPages(10, 2, nil)
+		p := NewPaginator(func(ctx context.Context, cursor string, limit int64) ([]int, string, error) {
+			if cursor == "4" {
+				return nil, "", failure
+			}
+			return fetch(ctx, cursor, limit)
+		})
+
+		var items []int
+		var errs []error
+		for item, err := range p.All(ctx) {
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			items = append(items, item)
+		}
+		assert.Equal(t, []int{0, 1, 2, 3}, items)
+		assert.Equal(t, []error{failure}, errs)
+		assert.Equal(t, "4", p.Cursor())
+	})
+
+	t.Run("breaking out of All keeps the position", func(t *testing.T) {
+		p := NewPaginator(numberPages(10, 4, nil))
+		for item := range p.All(ctx) {
+			if item == 1 {
+				break
+			}
+		}
+		assert.True(t, p.Next(ctx))
+		assert.Equal(t, 2, p.Item())
+	})
+}
+
+func TestFollowers(t *testing.T) {
+	var cursors, limits []string
+	client, _ := newTestPDS(t, map[string]http.HandlerFunc{
+		"app.bsky.graph.getFollowers": func(w http.ResponseWriter, r *http.Request) {
+			cursor := r.URL.Query().Get("cursor")
+			cursors = append(cursors, cursor)
+			limits = append(limits, r.URL.Query().Get("limit"))
+			if cursor == "" {
+				writeJSON(w, `{"subject": {"did": "did:plc:alice", "handle": "alice.test"}, "cursor": "page2",
+					"followers": [{"did": "did:plc:bob", "handle": "bob.test"}]}`)
+				return
+			}
+			writeJSON(w, `{"subject": {"did": "did:plc:alice", "handle": "alice.test"},
+				"followers": [{"did": "did:plc:carol", "handle": "carol.test"}]}`)
+		},
+	})
+
+	var handles []string
+	for follower, err := range client.Followers("alice.test").All(context.Background()) {
+		assert.NoError(t, err)
+		handles = append(handles, follower.Handle)
+	}
+	assert.Equal(t, []string{"bob.test", "carol.test"}, handles)
+	assert.Equal(t, []string{"", "page2"}, cursors)
+	assert.Equal(t, []string{"50", "50"}, limits)
+}
@@ -2,9 +2,13 @@ package client
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strings"
+	"sync"
 
 	"github.com/bluesky-social/indigo/api/bsky"
+	"github.com/bluesky-social/indigo/atproto/syntax"
 	"github.com/watzon/lining/post"
 )
 
@@ -43,8 +47,74 @@ func (c *BskyClient) GetPost(ctx context.Context, uri string) (*post.Post, error
 	return post.PostFromFeedDefs_PostView(resp.Thread.FeedDefs_ThreadViewPost.Post)
 }
 
-// GetPosts retrieves multiple posts by their URIs. This is more efficient than
-// making multiple GetPost calls when you need to fetch several posts at once.
+// GetThread retrieves the thread around a post: up to parentHeight ancestors
+// and up to depth levels of replies. It returns the node of the requested
+// post; use Root to get to the top of the thread. Deleted and blocked posts
+// appear as placeholder nodes.
+//
+// Example:
+//
+//	thread, err := client.GetThread(ctx, uri, 6, 80)
+//	if err != nil {
+//	    return err
+//	}
+//	for _, p := range thread.Root().Flatten() {
+//	    fmt.Println(p.Author.Handle, p.Text)
+//	}
+func (c *BskyClient) GetThread(ctx context.Context, uri string, depth int64, parentHeight int64) (*post.Thread, error) {
+	if err := c.ensureValidSession(ctx); err != nil {
+		return nil, err
+	}
+
+	resp, err := bsky.FeedGetPostThread(ctx, c.client, depth, parentHeight, uri)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get thread: %w", err)
+	}
+
+	thread, err := post.ThreadFromPostThread(resp.Thread)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert thread: %w", err)
+	}
+	if thread == nil {
+		return nil, fmt.Errorf("got nil response or post data")
+	}
+	return thread, nil
+}
+
+// getPostsChunkSize is the most URIs app.bsky.feed.getPosts accepts at once
+const getPostsChunkSize = 25
+
+// getPostsConcurrency is how many chunks GetPosts fetches at the same time
+const getPostsConcurrency = 4
+
+// ErrPostNotFound is matched by the error GetPosts returns when some posts
+// couldn't be found
+var ErrPostNotFound = errors.New("post not found")
+
+// MissingPostsError lists the posts GetPosts couldn't find, because they were
+// deleted, are blocked, or never existed
+type MissingPostsError struct {
+	Uris []string
+}
+
+func (e *MissingPostsError) Error() string {
+	return fmt.Sprintf("%d posts not found: %s", len(e.Uris), strings.Join(e.Uris, ", "))
+}
+
+// Is makes errors.Is(err, ErrPostNotFound) match a MissingPostsError
+func (e *MissingPostsError) Is(target error) bool {
+	return target == ErrPostNotFound
+}
+
+// GetPosts retrieves multiple posts by their URIs with app.bsky.feed.getPosts,
+// fetching up to 25 posts per request and several requests at a time.
+//
+// The returned slice matches uris: the post for uris[i] is at index i, or nil
+// if it couldn't be retrieved. Posts that don't exist are reported with a
+// *MissingPostsError, and the posts that were found are still returned along
+// with it and with the errors of any requests that failed. URIs that name the
+// repo by handle are resolved to DIDs first, since the AppView only looks up
+// posts by DID.
 //
 // Example:
 //
@@ -52,19 +122,140 @@ func (c *BskyClient) GetPost(ctx context.Context, uri string) (*post.Post, error
 //	    "at://did:plc:xyz/app.bsky.feed.post/123",
 //	    "at://did:plc:xyz/app.bsky.feed.post/456",
 //	)
+//	var missing *client.MissingPostsError
+//	if errors.As(err, &missing) {
+//	    log.Printf("skipping deleted posts: %v", missing.Uris)
+//	}
+//	for _, p := range posts {
+//	    if p != nil {
+//	        fmt.Println(p.Text, p.Likes)
+//	    }
+//	}
 func (c *BskyClient) GetPosts(ctx context.Context, uris ...string) ([]*post.Post, error) {
+	var unique []string
+	seen := make(map[string]bool, len(uris))
+	for _, uri := range uris {
+		repo, _, _, err := post.ParsePostURI(uri)
+		if err == nil {
+			_, err = syntax.ParseAtIdentifier(repo)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse post URI %s: %w", uri, err)
+		}
+		if !seen[uri] {
+			seen[uri] = true
+			unique = append(unique, uri)
+		}
+	}
+	if len(unique) == 0 {
+		return []*post.Post{}, nil
+	}
+
 	if err := c.ensureValidSession(ctx); err != nil {
 		return nil, err
 	}
 
-	var posts []*post.Post
-	for _, uri := range uris {
-		p, err := c.GetPost(ctx, uri)
+	var (
+		mu     sync.Mutex
+		found  = make(map[string]*post.Post, len(unique))
+		failed = make(map[string]bool)
+		errs   []error
+		wg     sync.WaitGroup
+		sem    = make(chan struct{}, getPostsConcurrency)
+	)
+
+	// resolved maps every URI to the URI requested from the AppView
+	resolved := make(map[string]string, len(unique))
+	requested := make(map[string]bool, len(unique))
+	var requests []string
+	for _, uri := range unique {
+		didUri, err := c.didPostURI(ctx, uri)
 		if err != nil {
-			return nil, fmt.Errorf("failed to get post %s: %w", uri, err)
+			errs = append(errs, err)
+			failed[uri] = true
+			continue
+		}
+		resolved[uri] = didUri
+		if !requested[didUri] {
+			requested[didUri] = true
+			requests = append(requests, didUri)
+		}
+	}
+
+	for start := 0; start < len(requests); start += getPostsChunkSize {
+		chunk := requests[start:min(start+getPostsChunkSize, len(requests))]
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			posts, err := c.getPostsChunk(ctx, chunk)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				errs = append(errs, err)
+				for _, uri := range chunk {
+					failed[uri] = true
+				}
+			}
+			for _, p := range posts {
+				found[p.Uri()] = p
+			}
+		}()
+	}
+	wg.Wait()
+
+	posts := make([]*post.Post, len(uris))
+	var missing []string
+	for i, uri := range uris {
+		posts[i] = found[resolved[uri]]
+	}
+	for _, uri := range unique {
+		if found[resolved[uri]] == nil && !failed[uri] && !failed[resolved[uri]] {
+			missing = append(missing, uri)
 		}
-		posts = append(posts, p)
+	}
+	if len(missing) > 0 {
+		errs = append(errs, &MissingPostsError{Uris: missing})
+	}
+
+	return posts, errors.Join(errs...)
+}
+
+// didPostURI returns the URI with its repo named by DID, resolving the handle
+// if it names the repo by handle
+func (c *BskyClient) didPostURI(ctx context.Context, uri string) (string, error) {
+	repo, collection, rkey, err := post.ParsePostURI(uri)
+	if err != nil {
+		return "", err
+	}
+	if strings.HasPrefix(repo, "did:") {
+		return uri, nil
+	}
+
+	ident, err := c.cache.LookupHandle(ctx, syntax.Handle(repo))
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve handle %s: %w", repo, err)
+	}
+	return "at://" + ident.DID.String() + "/" + collection + "/" + rkey, nil
+}
+
+// getPostsChunk fetches up to getPostsChunkSize posts in one request
+func (c *BskyClient) getPostsChunk(ctx context.Context, uris []string) ([]*post.Post, error) {
+	if err := c.limiter.Wait(ctx); err != nil {
+		return nil, fmt.Errorf("rate limit exceeded: %w", err)
+	}
+
+	resp, err := bsky.FeedGetPosts(ctx, c.client, uris)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get posts: %w", err)
 	}
 
+	posts, err := post.PostsFromGetPostsResponse(resp)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert posts: %w", err)
+	}
 	return posts, nil
 }
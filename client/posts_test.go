@@ -0,0 +1,112 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bluesky-social/indigo/atproto/identity"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetPosts(t *testing.T) {
+	postUri := func(i int) string {
+		return fmt.Sprintf("at://did:plc:alice/app.bsky.feed.post/3kpost%02d", i)
+	}
+
+	var mu sync.Mutex
+	var chunkSizes []int
+	client, _ := newTestPDS(t, map[string]http.HandlerFunc{
+		"app.bsky.feed.getPosts": func(w http.ResponseWriter, r *http.Request) {
+			uris := r.URL.Query()["uris"]
+			mu.Lock()
+			chunkSizes = append(chunkSizes, len(uris))
+			mu.Unlock()
+
+			var views []string
+			for _, uri := range uris {
+				// Every seventh post has been deleted
+				if strings.HasSuffix(uri, "07") || strings.HasSuffix(uri, "14") {
+					continue
+				}
+				views = append(views, `{
+					"uri": "`+uri+`", "cid": "cid",
+					"author": {"did": "did:plc:alice", "handle": "alice.test"},
+					"record": {"$type": "app.bsky.feed.post", "text": "`+uri[len(uri)-2:]+`", "createdAt": "2024-05-06T08:00:00Z"},
+					"indexedAt": "2024-05-06T08:00:00Z",
+					"likeCount": 3, "replyCount": 2, "repostCount": 1, "quoteCount": 4
+				}`)
+			}
+			writeJSON(w, `{"posts": [`+strings.Join(views, ",")+`]}`)
+		},
+	})
+	ctx := context.Background()
+
+	t.Run("batches and keeps order", func(t *testing.T) {
+		var uris []string
+		for i := 30; i > 0; i-- {
+			uris = append(uris, postUri(i))
+		}
+		uris = append(uris, postUri(30))
+
+		posts, err := client.GetPosts(ctx, uris...)
+		assert.ErrorIs(t, err, ErrPostNotFound)
+		var missing *MissingPostsError
+		assert.True(t, errors.As(err, &missing))
+		assert.Equal(t, []string{postUri(14), postUri(7)}, missing.Uris)
+
+		assert.ElementsMatch(t, []int{25, 5}, chunkSizes)
+		assert.Len(t, posts, 31)
+		assert.Equal(t, "30", posts[0].Text)
+		assert.Equal(t, "29", posts[1].Text)
+		assert.Nil(t, posts[16])
+		assert.Equal(t, "30", posts[30].Text)
+
+		p := posts[0]
+		assert.Equal(t, int64(3), p.Likes)
+		assert.Equal(t, int64(2), p.Replies)
+		assert.Equal(t, int64(1), p.Reposts)
+		assert.Equal(t, int64(4), p.Quotes)
+		assert.Equal(t, "alice.test", p.Author.Handle)
+	})
+
+	t.Run("resolves handles", func(t *testing.T) {
+		dir := identity.NewMockDirectory()
+		dir.Insert(identity.Identity{DID: "did:plc:alice", Handle: "alice.test", AlsoKnownAs: []string{"at://alice.test"}})
+		cache := identity.NewCacheDirectory(&dir, 10, time.Minute, time.Minute, time.Minute)
+		client.cache = &cache
+		chunkSizes = nil
+
+		posts, err := client.GetPosts(ctx,
+			"at://alice.test/app.bsky.feed.post/3kpost01",
+			postUri(1),
+			"at://nobody.test/app.bsky.feed.post/3kpost02",
+		)
+		assert.ErrorIs(t, err, identity.ErrHandleNotFound)
+		assert.NotErrorIs(t, err, ErrPostNotFound)
+		assert.Equal(t, []int{1}, chunkSizes)
+		assert.Len(t, posts, 3)
+		assert.Equal(t, "01", posts[0].Text)
+		assert.Equal(t, postUri(1), posts[0].Uri())
+		assert.Same(t, posts[0], posts[1])
+		assert.Nil(t, posts[2])
+	})
+
+	t.Run("rejects invalid URIs", func(t *testing.T) {
+		_, err := client.GetPosts(ctx, "https://bsky.app/profile/alice.test")
+		assert.Error(t, err)
+		_, err = client.GetPosts(ctx, "at://not a handle/app.bsky.feed.post/1")
+		assert.Error(t, err)
+	})
+
+	t.Run("no URIs", func(t *testing.T) {
+		posts, err := client.GetPosts(ctx)
+		assert.NoError(t, err)
+		assert.Empty(t, posts)
+	})
+}
@@ -0,0 +1,253 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	appbsky "github.com/bluesky-social/indigo/api/bsky"
+	"github.com/bluesky-social/indigo/xrpc"
+
+	"github.com/watzon/lining/post"
+)
+
+// SearchSort orders post search results
+type SearchSort string
+
+const (
+	// SortLatest returns the newest posts first. It's the server's default.
+	SortLatest SearchSort = "latest"
+	// SortTop returns the most relevant and popular posts first
+	SortTop SearchSort = "top"
+)
+
+// SearchOptions narrows down a post search. Empty fields aren't sent.
+type SearchOptions struct {
+	// Author only matches posts by this handle or DID
+	Author string
+	// Mentions only matches posts mentioning this handle or DID
+	Mentions string
+	// Lang only matches posts in this language
+	Lang string
+	// Domain only matches posts linking to this domain
+	Domain string
+	// URL only matches posts linking to this URL
+	URL string
+	// Tags only matches posts with all of these hashtags, without the #
+	Tags []string
+	// Since and Until bound when posts were created
+	Since time.Time
+	Until time.Time
+	Sort  SearchSort
+	// Limit is the number of results per page. Zero requests 50.
+	Limit int64
+	// Cursor continues a previous search
+	Cursor string
+}
+
+// SearchOption is a function that configures a SearchOptions struct
+type SearchOption func(*SearchOptions)
+
+// WithSearchAuthor returns a SearchOption that only matches posts by a user
+func WithSearchAuthor(actor string) SearchOption {
+	return func(opts *SearchOptions) {
+		opts.Author = actor
+	}
+}
+
+// WithSearchMentions returns a SearchOption that only matches posts
+// mentioning a user
+func WithSearchMentions(actor string) SearchOption {
+	return func(opts *SearchOptions) {
+		opts.Mentions = actor
+	}
+}
+
+// WithSearchLang returns a SearchOption that only matches posts in a language
+func WithSearchLang(lang string) SearchOption {
+	return func(opts *SearchOptions) {
+		opts.Lang = lang
+	}
+}
+
+// WithSearchDomain returns a SearchOption that only matches posts linking to
+// a domain
+func WithSearchDomain(domain string) SearchOption {
+	return func(opts *SearchOptions) {
+		opts.Domain = domain
+	}
+}
+
+// WithSearchURL returns a SearchOption that only matches posts linking to a
+// URL
+func WithSearchURL(url string) SearchOption {
+	return func(opts *SearchOptions) {
+		opts.URL = url
+	}
+}
+
+// WithSearchTags returns a SearchOption that only matches posts with all of
+// the given hashtags
+func WithSearchTags(tags ...string) SearchOption {
+	return func(opts *SearchOptions) {
+		opts.Tags = append(opts.Tags, tags...)
+	}
+}
+
+// WithSearchSince returns a SearchOption that only matches posts created at or
+// after t
+func WithSearchSince(t time.Time) SearchOption {
+	return func(opts *SearchOptions) {
+		opts.Since = t
+	}
+}
+
+// WithSearchUntil returns a SearchOption that only matches posts created
+// before t
+func WithSearchUntil(t time.Time) SearchOption {
+	return func(opts *SearchOptions) {
+		opts.Until = t
+	}
+}
+
+// WithSearchSort returns a SearchOption that sets the order of the results
+func WithSearchSort(sort SearchSort) SearchOption {
+	return func(opts *SearchOptions) {
+		opts.Sort = sort
+	}
+}
+
+// WithSearchLimit returns a SearchOption that sets the number of results per
+// page
+func WithSearchLimit(limit int64) SearchOption {
+	return func(opts *SearchOptions) {
+		opts.Limit = limit
+	}
+}
+
+// WithSearchCursor returns a SearchOption that continues a previous search
+func WithSearchCursor(cursor string) SearchOption {
+	return func(opts *SearchOptions) {
+		opts.Cursor = cursor
+	}
+}
+
+// params returns the query parameters of a post search, leaving out empty
+// fields, which the AppView would reject
+func (o SearchOptions) params(query string) map[string]any {
+	params := map[string]any{"q": query}
+	set := func(key, value string) {
+		if value != "" {
+			params[key] = value
+		}
+	}
+	set("author", o.Author)
+	set("mentions", o.Mentions)
+	set("lang", o.Lang)
+	set("domain", o.Domain)
+	set("url", o.URL)
+	set("sort", string(o.Sort))
+	if len(o.Tags) > 0 {
+		params["tag"] = o.Tags
+	}
+	if !o.Since.IsZero() {
+		params["since"] = o.Since.UTC().Format(time.RFC3339)
+	}
+	if !o.Until.IsZero() {
+		params["until"] = o.Until.UTC().Format(time.RFC3339)
+	}
+	return params
+}
+
+// SearchPosts returns a Paginator over the posts matching a query. The query
+// uses the same syntax as the Bluesky app, and the options narrow it down.
+// Search results can only be paged through so far; narrow down long
+// backfills with WithSearchSince and WithSearchUntil.
+//
+// Example:
+//
+//	// Catch up on mentions missed while the bot was offline
+//	results := client.SearchPosts("*",
+//	    client.WithSearchMentions("mybot.bsky.social"),
+//	    client.WithSearchSince(lastSeen),
+//	    client.WithSearchSort(client.SortLatest),
+//	)
+//	for p, err := range results.All(ctx) {
+//	    if err != nil {
+//	        return err
+//	    }
+//	    handle(p)
+//	}
+func (c *BskyClient) SearchPosts(query string, opts ...SearchOption) *Paginator[*post.Post] {
+	var options SearchOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	return paginate(c, func(ctx context.Context, cursor string, limit int64) ([]*post.Post, string, error) {
+		params := options.params(query)
+		params["limit"] = limit
+		if cursor != "" {
+			params["cursor"] = cursor
+		}
+
+		var out appbsky.FeedSearchPosts_Output
+		if err := c.client.Do(ctx, xrpc.Query, "", "app.bsky.feed.searchPosts", params, nil, &out); err != nil {
+			return nil, "", fmt.Errorf("failed to search posts: %w", err)
+		}
+
+		posts := make([]*post.Post, 0, len(out.Posts))
+		for _, view := range out.Posts {
+			p, err := post.PostFromFeedDefs_PostView(view)
+			if err != nil {
+				return nil, "", fmt.Errorf("failed to convert search result: %w", err)
+			}
+			posts = append(posts, p)
+		}
+		return posts, stringValue(out.Cursor), nil
+	}).WithPageSize(options.Limit).WithCursor(options.Cursor)
+}
+
+// SearchActors returns a Paginator over the accounts matching a query, by
+// handle, display name and description
+//
+// Example:
+//
+//	actors, err := client.SearchActors("golang").WithMaxItems(20).Collect(ctx)
+func (c *BskyClient) SearchActors(query string) *Paginator[*post.Author] {
+	return paginate(c, func(ctx context.Context, cursor string, limit int64) ([]*post.Author, string, error) {
+		resp, err := appbsky.ActorSearchActors(ctx, c.client, cursor, limit, query, "")
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to search actors: %w", err)
+		}
+
+		actors := make([]*post.Author, 0, len(resp.Actors))
+		for _, actor := range resp.Actors {
+			actors = append(actors, post.AuthorFromProfileView(actor))
+		}
+		return actors, stringValue(resp.Cursor), nil
+	})
+}
+
+// SearchActorsTypeahead returns up to limit accounts whose handle or display
+// name starts with a prefix, for autocompletion. A limit of zero returns up
+// to 10.
+func (c *BskyClient) SearchActorsTypeahead(ctx context.Context, prefix string, limit int64) ([]*post.Author, error) {
+	if err := c.ensureValidSession(ctx); err != nil {
+		return nil, err
+	}
+	if limit <= 0 {
+		limit = 10
+	}
+
+	resp, err := appbsky.ActorSearchActorsTypeahead(ctx, c.client, limit, prefix, "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to search actors: %w", err)
+	}
+
+	actors := make([]*post.Author, 0, len(resp.Actors))
+	for _, actor := range resp.Actors {
+		actors = append(actors, post.AuthorFromProfileViewBasic(actor))
+	}
+	return actors, nil
+}
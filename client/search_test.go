@@ -0,0 +1,73 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSearch(t *testing.T) {
+	var query url.Values
+	client, _ := newTestPDS(t, map[string]http.HandlerFunc{
+		"app.bsky.feed.searchPosts": func(w http.ResponseWriter, r *http.Request) {
+			query = r.URL.Query()
+			if query.Get("cursor") == "" {
+				writeJSON(w, `{"cursor": "2", "posts": [`+testFeedPost+`]}`)
+				return
+			}
+			writeJSON(w, `{"posts": []}`)
+		},
+		"app.bsky.actor.searchActors": func(w http.ResponseWriter, r *http.Request) {
+			query = r.URL.Query()
+			writeJSON(w, `{"actors": [{"did": "did:plc:alice", "handle": "alice.test", "description": "gopher"}]}`)
+		},
+		"app.bsky.actor.searchActorsTypeahead": func(w http.ResponseWriter, r *http.Request) {
+			query = r.URL.Query()
+			writeJSON(w, `{"actors": [{"did": "did:plc:alice", "handle": "alice.test"}]}`)
+		},
+	})
+	ctx := context.Background()
+
+	t.Run("posts", func(t *testing.T) {
+		since := time.Date(2024, 5, 6, 10, 0, 0, 0, time.FixedZone("CEST", 2*60*60))
+		posts, err := client.SearchPosts("outage",
+			WithSearchMentions("mybot.test"),
+			WithSearchLang("en"),
+			WithSearchTags("status", "ops"),
+			WithSearchSince(since),
+			WithSearchSort(SortLatest),
+		).Collect(ctx)
+		assert.NoError(t, err)
+		assert.Len(t, posts, 1)
+		assert.Equal(t, "alice.test", posts[0].Author.Handle)
+
+		assert.Equal(t, "outage", query.Get("q"))
+		assert.Equal(t, "mybot.test", query.Get("mentions"))
+		assert.Equal(t, "en", query.Get("lang"))
+		assert.Equal(t, []string{"status", "ops"}, query["tag"])
+		assert.Equal(t, "2024-05-06T08:00:00Z", query.Get("since"))
+		assert.Equal(t, "latest", query.Get("sort"))
+		assert.Equal(t, "2", query.Get("cursor"))
+		assert.False(t, query.Has("author"))
+		assert.False(t, query.Has("until"))
+	})
+
+	t.Run("actors", func(t *testing.T) {
+		actors, err := client.SearchActors("gopher").Collect(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, "gopher", query.Get("q"))
+		assert.Equal(t, "gopher", actors[0].Description)
+	})
+
+	t.Run("typeahead", func(t *testing.T) {
+		actors, err := client.SearchActorsTypeahead(ctx, "ali", 0)
+		assert.NoError(t, err)
+		assert.Equal(t, "ali", query.Get("q"))
+		assert.Equal(t, "10", query.Get("limit"))
+		assert.Equal(t, "alice.test", actors[0].Handle)
+	})
+}
@@ -0,0 +1,683 @@
+// Package command routes "@bot /command args" posts to handlers, for bots that
+// respond to commands. Posts come from mention and reply notifications or from
+// the firehose, and handlers answer in the thread of the post that invoked
+// them.
+package command
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	appbsky "github.com/bluesky-social/indigo/api/bsky"
+
+	"github.com/watzon/lining/client"
+	"github.com/watzon/lining/firehose"
+	"github.com/watzon/lining/notification"
+	"github.com/watzon/lining/post"
+)
+
+// ErrUnknownCommand is passed to the rejection reply when a post invokes a
+// command that isn't registered
+var ErrUnknownCommand = errors.New("unknown command")
+
+// ErrPermissionDenied is returned by permissions that deny a command
+var ErrPermissionDenied = errors.New("permission denied")
+
+// ErrCooldown is matched by CooldownError
+var ErrCooldown = errors.New("command on cooldown")
+
+// ErrInvalidCommand is returned when a command can't be registered
+var ErrInvalidCommand = errors.New("invalid command")
+
+// CooldownError is passed to the rejection reply when a user invokes a
+// command again before its cooldown has passed
+type CooldownError struct {
+	Command   string
+	Remaining time.Duration
+}
+
+func (e *CooldownError) Error() string {
+	return fmt.Sprintf("command %s on cooldown for another %s", e.Command, e.Remaining.Round(time.Second))
+}
+
+// Is makes errors.Is(err, ErrCooldown) match a CooldownError
+func (e *CooldownError) Is(target error) bool {
+	return target == ErrCooldown
+}
+
+// Client publishes replies and looks up the authors of posts that don't carry
+// their profile. *client.BskyClient satisfies it.
+type Client interface {
+	PostToFeed(ctx context.Context, p appbsky.FeedPost, opts ...client.PostOption) (string, string, error)
+	GetProfile(ctx context.Context, handle string) (*appbsky.ActorDefs_ProfileViewDetailed, error)
+}
+
+// Handler runs a command
+type Handler func(ctx context.Context, req *Request) error
+
+// Permission decides whether a request may run a command. It denies the
+// request by returning an error that wraps ErrPermissionDenied; any other
+// error fails the request.
+type Permission func(ctx context.Context, req *Request) error
+
+// Command is a command a bot responds to
+type Command struct {
+	// Name is what users type after the prefix, such as "roll" for "/roll".
+	// Names and aliases are matched case-insensitively.
+	Name    string
+	Aliases []string
+	// Usage describes the arguments, such as "<sides> [count]"
+	Usage string
+	// Help is a one-line description shown by the help command
+	Help string
+	// Cooldown is how long a user has to wait before invoking the command
+	// again
+	Cooldown time.Duration
+	// Permissions must all allow a request for the command to run
+	Permissions []Permission
+	// Hidden commands work but aren't listed by the help command
+	Hidden  bool
+	Handler Handler
+}
+
+// Request is a command invoked by a post
+type Request struct {
+	Post    *post.Post
+	Command *Command
+	// Name is the name or alias the command was invoked with, without the
+	// prefix
+	Name string
+	// Args are the arguments split on whitespace, with quoted arguments kept
+	// together
+	Args []string
+	// RawArgs is the text after the command name
+	RawArgs string
+
+	router *Router
+}
+
+// Sender returns the DID of the user who invoked the command
+func (req *Request) Sender() string {
+	return req.Post.Repo
+}
+
+// Reply posts text in reply to the post that invoked the command and returns
+// the URI of the reply
+func (req *Request) Reply(ctx context.Context, text string) (string, error) {
+	return req.ReplyWith(ctx, func(b *post.Builder) *post.Builder {
+		return b.AddText(text)
+	})
+}
+
+// ReplyWith builds a reply to the post that invoked the command, for replies
+// with mentions, links or embeds, and returns the URI of the reply. The reply
+// refs are set after build is called.
+//
+// Example:
+//
+//	uri, err := req.ReplyWith(ctx, func(b *post.Builder) *post.Builder {
+//	    return b.AddText("Docs: ").AddURLLink("https://example.com/docs")
+//	})
+func (req *Request) ReplyWith(ctx context.Context, build func(*post.Builder) *post.Builder) (string, error) {
+	b := build(req.router.opts.NewBuilder()).WithReplyToPost(req.Post)
+	reply, err := b.BuildContext(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to build reply: %w", err)
+	}
+	_, uri, err := req.router.client.PostToFeed(ctx, reply)
+	if err != nil {
+		return "", fmt.Errorf("failed to post reply: %w", err)
+	}
+	return uri, nil
+}
+
+// Options configures a Router
+type Options struct {
+	// Prefix starts a command, as in "/roll". An empty prefix treats the
+	// first word after the mention as the command. Without a prefix nothing
+	// sets commands apart from conversation, so posts whose first word isn't
+	// a command are ignored rather than rejected with ErrUnknownCommand.
+	Prefix string
+	// Handle is the bot's handle. It lets the router recognize mentions of
+	// the bot in posts without mention facets.
+	Handle string
+	// Help enables the built-in help command, unless a command named "help"
+	// is registered
+	Help bool
+	// NewBuilder creates the builders replies are built with
+	NewBuilder func(opts ...post.BuilderOption) *post.Builder
+	// RejectReply returns the reply to a request that was rejected with
+	// ErrUnknownCommand, ErrPermissionDenied or a CooldownError. An empty
+	// reply rejects the request silently.
+	RejectReply func(req *Request, err error) string
+}
+
+// Option is a function that configures an Options struct
+type Option func(*Options)
+
+// WithPrefix returns an Option that sets the command prefix. With an empty
+// prefix, posts that don't start with a known command are ignored.
+func WithPrefix(prefix string) Option {
+	return func(opts *Options) {
+		opts.Prefix = prefix
+	}
+}
+
+// WithHandle returns an Option that sets the bot's handle
+func WithHandle(handle string) Option {
+	return func(opts *Options) {
+		opts.Handle = strings.TrimPrefix(handle, "@")
+	}
+}
+
+// WithHelp returns an Option that enables or disables the built-in help
+// command
+func WithHelp(enabled bool) Option {
+	return func(opts *Options) {
+		opts.Help = enabled
+	}
+}
+
+// WithBuilder returns an Option that sets how reply builders are created.
+// Pass client.NewPostBuilder to resolve mentions in replies.
+func WithBuilder(newBuilder func(opts ...post.BuilderOption) *post.Builder) Option {
+	return func(opts *Options) {
+		opts.NewBuilder = newBuilder
+	}
+}
+
+// WithRejectReply returns an Option that sets the replies to rejected
+// requests
+func WithRejectReply(fn func(req *Request, err error) string) Option {
+	return func(opts *Options) {
+		opts.RejectReply = fn
+	}
+}
+
+// DefaultOptions returns the default Options. Unknown commands and denied
+// permissions get a short reply, and cooldowns are silent so that users
+// can't make the bot spam a thread.
+func DefaultOptions() Options {
+	return Options{
+		Prefix:      "/",
+		Help:        true,
+		NewBuilder:  post.NewBuilder,
+		RejectReply: defaultRejectReply,
+	}
+}
+
+func defaultRejectReply(req *Request, err error) string {
+	prefix := req.router.opts.Prefix
+	switch {
+	case errors.Is(err, ErrUnknownCommand):
+		if req.router.lookup("help") != nil {
+			return fmt.Sprintf("I don't know %s%s. Try %shelp.", prefix, req.Name, prefix)
+		}
+		return fmt.Sprintf("I don't know %s%s.", prefix, req.Name)
+	case errors.Is(err, ErrPermissionDenied):
+		return fmt.Sprintf("Sorry, you can't use %s%s.", prefix, req.Name)
+	}
+	return ""
+}
+
+// maxCooldowns is the number of cooldowns tracked before expired ones are
+// dropped
+const maxCooldowns = 1024
+
+// Router parses commands out of posts addressed to a bot and runs their
+// handlers. A post is addressed to the bot when it mentions the bot or
+// replies to one of its posts; the command follows the mention, as in
+// "@bot /roll 2d6", or starts a reply. It is safe for concurrent use.
+//
+// Example:
+//
+//	router := command.NewRouter(client, botDid, command.WithBuilder(client.NewPostBuilder))
+//	err := router.Register(command.Command{
+//	    Name:     "roll",
+//	    Aliases:  []string{"dice"},
+//	    Usage:    "[sides]",
+//	    Help:     "Rolls a die",
+//	    Cooldown: 10 * time.Second,
+//	    Handler: func(ctx context.Context, req *command.Request) error {
+//	        _, err := req.Reply(ctx, fmt.Sprintf("You rolled a %d", rand.IntN(6)+1))
+//	        return err
+//	    },
+//	})
+//	if err != nil {
+//	    return err
+//	}
+//	return client.PollNotifications(ctx, router.Callbacks(ctx))
+type Router struct {
+	client Client
+	did    string
+	opts   Options
+
+	mu        sync.Mutex
+	commands  []*Command
+	byName    map[string]*Command
+	cooldowns map[string]time.Time
+	now       func() time.Time
+}
+
+// NewRouter returns a router for the bot with the given DID that replies
+// through c
+func NewRouter(c Client, did string, opts ...Option) *Router {
+	options := DefaultOptions()
+	for _, opt := range opts {
+		opt(&options)
+	}
+	if options.NewBuilder == nil {
+		options.NewBuilder = post.NewBuilder
+	}
+
+	return &Router{
+		client:    c,
+		did:       did,
+		opts:      options,
+		byName:    make(map[string]*Command),
+		cooldowns: make(map[string]time.Time),
+		now:       time.Now,
+	}
+}
+
+// Register adds commands to the router. It fails without registering any of
+// them if a command has no name or handler, or if a name or alias is taken.
+func (r *Router) Register(cmds ...Command) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	added := make(map[string]*Command)
+	for i := range cmds {
+		cmd := cmds[i]
+		if cmd.Name == "" || cmd.Handler == nil {
+			return fmt.Errorf("%w: a command needs a name and a handler", ErrInvalidCommand)
+		}
+		for _, name := range append([]string{cmd.Name}, cmd.Aliases...) {
+			key := strings.ToLower(name)
+			if key == "" || strings.IndexFunc(key, unicode.IsSpace) >= 0 {
+				return fmt.Errorf("%w: %q is not a valid name", ErrInvalidCommand, name)
+			}
+			if r.byName[key] != nil || added[key] != nil {
+				return fmt.Errorf("%w: %q is already registered", ErrInvalidCommand, name)
+			}
+			added[key] = &cmd
+		}
+	}
+
+	for i := range cmds {
+		r.commands = append(r.commands, added[strings.ToLower(cmds[i].Name)])
+	}
+	for key, cmd := range added {
+		r.byName[key] = cmd
+	}
+	return nil
+}
+
+// Commands returns the registered commands in the order they were registered
+func (r *Router) Commands() []Command {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	cmds := make([]Command, 0, len(r.commands))
+	for _, cmd := range r.commands {
+		cmds = append(cmds, *cmd)
+	}
+	return cmds
+}
+
+// lookup returns the command with a name or alias, falling back to the
+// built-in help command
+func (r *Router) lookup(name string) *Command {
+	r.mu.Lock()
+	cmd := r.byName[strings.ToLower(name)]
+	r.mu.Unlock()
+
+	if cmd == nil && r.opts.Help && strings.EqualFold(name, "help") {
+		return &Command{
+			Name:    "help",
+			Usage:   "[command]",
+			Help:    "Lists commands or explains one",
+			Handler: r.help,
+		}
+	}
+	return cmd
+}
+
+// Matches reports whether a post invokes a command of the router's bot. It
+// can be used as a filter for handlers other than the router's.
+func (r *Router) Matches(p *post.Post) bool {
+	_, _, ok := r.parse(p)
+	return ok
+}
+
+// HandlePost runs the command a post invokes. Posts that aren't addressed to
+// the bot, or don't start with the prefix, are ignored. Rejected requests get
+// the rejection reply and return nil; errors from permissions, handlers and
+// replies are returned.
+//
+// Posts from the firehose don't carry their author's profile, so for commands
+// with permissions HandlePost looks it up and stores it in p.Author.
+func (r *Router) HandlePost(ctx context.Context, p *post.Post) error {
+	name, rawArgs, ok := r.parse(p)
+	if !ok {
+		return nil
+	}
+
+	req := &Request{
+		Post:    p,
+		Name:    name,
+		Args:    splitArgs(rawArgs),
+		RawArgs: rawArgs,
+		router:  r,
+	}
+	cmd := r.lookup(name)
+	if cmd == nil {
+		return r.reject(ctx, req, fmt.Errorf("%w: %s", ErrUnknownCommand, name))
+	}
+	req.Command = cmd
+
+	if len(cmd.Permissions) > 0 && p.Author == nil {
+		profile, err := r.client.GetProfile(ctx, p.Repo)
+		if err != nil {
+			return fmt.Errorf("failed to look up author of %s: %w", p.Uri(), err)
+		}
+		p.Author = post.AuthorFromProfileViewDetailed(profile)
+	}
+	for _, permission := range cmd.Permissions {
+		if err := permission(ctx, req); err != nil {
+			if errors.Is(err, ErrPermissionDenied) {
+				return r.reject(ctx, req, err)
+			}
+			return fmt.Errorf("failed to check permissions of %s: %w", cmd.Name, err)
+		}
+	}
+
+	if remaining := r.startCooldown(cmd, p.Repo); remaining > 0 {
+		return r.reject(ctx, req, &CooldownError{Command: cmd.Name, Remaining: remaining})
+	}
+
+	if err := cmd.Handler(ctx, req); err != nil {
+		return fmt.Errorf("command %s failed: %w", cmd.Name, err)
+	}
+	return nil
+}
+
+// reject sends the rejection reply to a request, if there is one
+func (r *Router) reject(ctx context.Context, req *Request, err error) error {
+	if r.opts.RejectReply == nil {
+		return nil
+	}
+	text := r.opts.RejectReply(req, err)
+	if text == "" {
+		return nil
+	}
+	_, replyErr := req.Reply(ctx, text)
+	return replyErr
+}
+
+// startCooldown starts a user's cooldown for a command, unless one is
+// already running, in which case it returns the time left
+func (r *Router) startCooldown(cmd *Command, did string) time.Duration {
+	if cmd.Cooldown <= 0 {
+		return 0
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := r.now()
+	key := strings.ToLower(cmd.Name) + "\x00" + did
+	if until, ok := r.cooldowns[key]; ok && now.Before(until) {
+		return until.Sub(now)
+	}
+
+	if len(r.cooldowns) >= maxCooldowns {
+		for k, until := range r.cooldowns {
+			if !now.Before(until) {
+				delete(r.cooldowns, k)
+			}
+		}
+	}
+	r.cooldowns[key] = now.Add(cmd.Cooldown)
+	return 0
+}
+
+// help is the handler of the built-in help command
+func (r *Router) help(ctx context.Context, req *Request) error {
+	prefix := r.opts.Prefix
+	if len(req.Args) > 0 {
+		name := strings.TrimPrefix(req.Args[0], prefix)
+		cmd := r.lookup(name)
+		if cmd == nil {
+			_, err := req.Reply(ctx, fmt.Sprintf("I don't know %s%s.", prefix, name))
+			return err
+		}
+		_, err := req.Reply(ctx, describe(prefix, cmd, true))
+		return err
+	}
+
+	lines := []string{"Commands:"}
+	for _, cmd := range r.Commands() {
+		if !cmd.Hidden {
+			lines = append(lines, describe(prefix, &cmd, false))
+		}
+	}
+	if len(lines) == 1 {
+		lines = []string{"I don't have any commands yet."}
+	}
+	_, err := req.Reply(ctx, strings.Join(lines, "\n"))
+	return err
+}
+
+// describe returns the help line of a command, with its aliases if detailed
+func describe(prefix string, cmd *Command, detailed bool) string {
+	line := prefix + cmd.Name
+	if cmd.Usage != "" {
+		line += " " + cmd.Usage
+	}
+	if cmd.Help != "" {
+		line += " - " + cmd.Help
+	}
+	if detailed && len(cmd.Aliases) > 0 {
+		aliases := make([]string, len(cmd.Aliases))
+		for i, alias := range cmd.Aliases {
+			aliases[i] = prefix + alias
+		}
+		sort.Strings(aliases)
+		line += "\nAliases: " + strings.Join(aliases, ", ")
+	}
+	return line
+}
+
+// parse returns the command name and arguments of a post addressed to the
+// bot
+func (r *Router) parse(p *post.Post) (string, string, bool) {
+	if p == nil || p.Repo == r.did {
+		return "", "", false
+	}
+	text, ok := r.addressed(p)
+	if !ok {
+		return "", "", false
+	}
+
+	text = strings.TrimSpace(text)
+	if !strings.HasPrefix(text, r.opts.Prefix) {
+		return "", "", false
+	}
+	text = text[len(r.opts.Prefix):]
+
+	name, rest := text, ""
+	if i := strings.IndexFunc(text, unicode.IsSpace); i >= 0 {
+		name, rest = text[:i], text[i:]
+	}
+	if name == "" {
+		return "", "", false
+	}
+	// Without a prefix, an unknown word is more likely a reply in the
+	// conversation than a mistyped command
+	if r.opts.Prefix == "" && r.lookup(name) == nil {
+		return "", "", false
+	}
+	return strings.ToLower(name), strings.TrimSpace(rest), true
+}
+
+// addressed returns the text following the bot's mention in a post, or all
+// of the text of a reply to one of the bot's posts
+func (r *Router) addressed(p *post.Post) (string, bool) {
+	for _, facet := range p.Facets {
+		mention := facet.Type.FacetTypeMention
+		if mention == nil || mention.Did != r.did {
+			continue
+		}
+		if end := facet.Index.ByteEnd; end >= 0 && end <= int64(len(p.Text)) {
+			return p.Text[end:], true
+		}
+	}
+
+	if r.opts.Handle != "" {
+		if end := mentionEnd(p.Text, "@"+r.opts.Handle); end >= 0 {
+			return p.Text[end:], true
+		}
+	}
+
+	if p.ReplyRef != nil && p.ReplyRef.Parent != nil && strings.HasPrefix(p.ReplyRef.Parent.Uri, "at://"+r.did+"/") {
+		return p.Text, true
+	}
+	return "", false
+}
+
+// mentionEnd returns the byte offset after the first mention of a handle in
+// text, or -1 if there is none
+func mentionEnd(text, mention string) int {
+	for i := 0; i+len(mention) <= len(text); i++ {
+		if !strings.EqualFold(text[i:i+len(mention)], mention) {
+			continue
+		}
+		end := i + len(mention)
+		// Don't match a longer handle that starts with this one, but allow a
+		// full stop after the mention
+		next := end
+		if next < len(text) && text[next] == '.' {
+			next++
+		}
+		if next < len(text) && isHandleByte(text[next]) {
+			continue
+		}
+		return end
+	}
+	return -1
+}
+
+func isHandleByte(b byte) bool {
+	return b == '.' || b == '-' || b >= '0' && b <= '9' || b >= 'a' && b <= 'z' || b >= 'A' && b <= 'Z'
+}
+
+// splitArgs splits arguments on whitespace. Quotes, including the curly
+// quotes mobile keyboards insert, keep an argument together when they start
+// it.
+func splitArgs(s string) []string {
+	var args []string
+	var current strings.Builder
+	inArg := false
+	var closing rune
+	for _, c := range s {
+		switch {
+		case closing != 0:
+			if c == closing {
+				closing = 0
+			} else {
+				current.WriteRune(c)
+			}
+		case !inArg && (c == '"' || c == '\''):
+			closing = c
+			inArg = true
+		case !inArg && c == '“':
+			closing = '”'
+			inArg = true
+		case unicode.IsSpace(c):
+			if inArg {
+				args = append(args, current.String())
+				current.Reset()
+				inArg = false
+			}
+		default:
+			current.WriteRune(c)
+			inArg = true
+		}
+	}
+	if inArg {
+		args = append(args, current.String())
+	}
+	return args
+}
+
+// OnlyFollowers returns a Permission that only allows users who follow the
+// bot
+func OnlyFollowers() Permission {
+	return func(ctx context.Context, req *Request) error {
+		author := req.Post.Author
+		if author == nil || author.Relationship == nil || author.Relationship.FollowedBy == "" {
+			return fmt.Errorf("%w: only followers can use %s", ErrPermissionDenied, req.Command.Name)
+		}
+		return nil
+	}
+}
+
+// OnlyUsers returns a Permission that only allows the users with the given
+// DIDs, such as the bot's operators
+func OnlyUsers(dids ...string) Permission {
+	allowed := make(map[string]bool, len(dids))
+	for _, did := range dids {
+		allowed[did] = true
+	}
+	return func(ctx context.Context, req *Request) error {
+		if !allowed[req.Sender()] {
+			return fmt.Errorf("%w: %s is restricted", ErrPermissionDenied, req.Command.Name)
+		}
+		return nil
+	}
+}
+
+// Callbacks returns notification callbacks that pass mentions and replies to
+// the router
+//
+// Example:
+//
+//	client.PollNotifications(ctx, router.Callbacks(ctx))
+func (r *Router) Callbacks(ctx context.Context) *notification.Callbacks {
+	handler := r.NotificationHandler(ctx)
+	return &notification.Callbacks{
+		MentionHandlers: []notification.PostHandlerWithFilter{handler},
+		ReplyHandlers:   []notification.PostHandlerWithFilter{handler},
+	}
+}
+
+// NotificationHandler returns a handler for mention and reply notifications,
+// to combine the router with other notification callbacks
+func (r *Router) NotificationHandler(ctx context.Context) notification.PostHandlerWithFilter {
+	return notification.PostHandlerWithFilter{
+		Handler: func(p *post.Post) error { return r.HandlePost(ctx, p) },
+		Filters: []notification.PostFilter{r.Matches},
+	}
+}
+
+// FirehoseHandler returns a firehose post handler that passes the posts
+// invoking the bot's commands to the router
+//
+// Example:
+//
+//	client.SubscribeToFirehose(ctx, &firehose.EnhancedFirehoseCallbacks{
+//	    PostHandlers: []firehose.PostHandlerWithFilter{router.FirehoseHandler(ctx)},
+//	})
+func (r *Router) FirehoseHandler(ctx context.Context) firehose.PostHandlerWithFilter {
+	return firehose.PostHandlerWithFilter{
+		Handler: func(p *post.Post) error { return r.HandlePost(ctx, p) },
+		Filters: []firehose.PostFilter{r.Matches},
+	}
+}
@@ -0,0 +1,243 @@
+package command
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bluesky-social/indigo/api/atproto"
+	appbsky "github.com/bluesky-social/indigo/api/bsky"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/watzon/lining/client"
+	"github.com/watzon/lining/post"
+)
+
+const botDid = "did:plc:bot"
+
+// fakeClient records replies and serves profiles of followers
+type fakeClient struct {
+	replies   []appbsky.FeedPost
+	followers map[string]bool
+	lookups   int
+}
+
+func (c *fakeClient) PostToFeed(ctx context.Context, p appbsky.FeedPost, opts ...client.PostOption) (string, string, error) {
+	c.replies = append(c.replies, p)
+	return "cid", "at://did:plc:bot/app.bsky.feed.post/reply", nil
+}
+
+func (c *fakeClient) GetProfile(ctx context.Context, handle string) (*appbsky.ActorDefs_ProfileViewDetailed, error) {
+	c.lookups++
+	viewer := &appbsky.ActorDefs_ViewerState{}
+	if c.followers[handle] {
+		follow := "at://" + handle + "/app.bsky.graph.follow/1"
+		viewer.FollowedBy = &follow
+	}
+	return &appbsky.ActorDefs_ProfileViewDetailed{Did: handle, Handle: "user.test", Viewer: viewer}, nil
+}
+
+func (c *fakeClient) texts() []string {
+	texts := make([]string, len(c.replies))
+	for i, reply := range c.replies {
+		texts[i] = reply.Text
+	}
+	return texts
+}
+
+// mention returns a post by did that mentions the bot with a facet
+func mention(did, text string) *post.Post {
+	const handle = "@bot.test"
+	start := strings.Index(text, handle)
+	p := &post.Post{Repo: did, Rkey: "3kpost", Cid: "cid-post", Text: text}
+	if start >= 0 {
+		p.Facets = []post.Facet{{
+			Type:  post.FacetType{Type: "app.bsky.richtext.facet#mention", FacetTypeMention: &post.FacetTypeMention{Did: botDid}},
+			Index: post.FacetByteSlice{ByteStart: int64(start), ByteEnd: int64(start + len(handle))},
+			Text:  handle,
+		}}
+	}
+	return p
+}
+
+func TestRouter(t *testing.T) {
+	ctx := context.Background()
+
+	newRouter := func(opts ...Option) (*Router, *fakeClient, *Request) {
+		c := &fakeClient{followers: map[string]bool{"did:plc:fan": true}}
+		r := NewRouter(c, botDid, opts...)
+		var last Request
+		err := r.Register(
+			Command{
+				Name:    "echo",
+				Aliases: []string{"say"},
+				Usage:   "<text>",
+				Help:    "Repeats the text",
+				Handler: func(ctx context.Context, req *Request) error {
+					last = *req
+					_, err := req.Reply(ctx, strings.Join(req.Args, "|"))
+					return err
+				},
+			},
+			Command{
+				Name:        "vip",
+				Help:        "For followers",
+				Permissions: []Permission{OnlyFollowers()},
+				Handler: func(ctx context.Context, req *Request) error {
+					_, err := req.Reply(ctx, "welcome")
+					return err
+				},
+			},
+			Command{
+				Name:     "slow",
+				Cooldown: time.Minute,
+				Hidden:   true,
+				Handler: func(ctx context.Context, req *Request) error {
+					_, err := req.Reply(ctx, "done")
+					return err
+				},
+			},
+		)
+		assert.NoError(t, err)
+		return r, c, &last
+	}
+
+	t.Run("parses commands after the mention", func(t *testing.T) {
+		r, c, last := newRouter()
+		p := mention("did:plc:alice", `hey @bot.test /SAY hello "big world" “curly quotes” don't`)
+		p.ReplyRef = &appbsky.FeedPost_ReplyRef{
+			Root:   &atproto.RepoStrongRef{Uri: "at://did:plc:carol/app.bsky.feed.post/3kroot", Cid: "cid-root"},
+			Parent: &atproto.RepoStrongRef{Uri: "at://did:plc:carol/app.bsky.feed.post/3kparent", Cid: "cid-parent"},
+		}
+		assert.True(t, r.Matches(p))
+		assert.NoError(t, r.HandlePost(ctx, p))
+
+		assert.Equal(t, "say", last.Name)
+		assert.Equal(t, "echo", last.Command.Name)
+		assert.Equal(t, `hello "big world" “curly quotes” don't`, last.RawArgs)
+		assert.Equal(t, []string{"hello|big world|curly quotes|don't"}, c.texts())
+
+		reply := c.replies[0].Reply
+		assert.Equal(t, "at://did:plc:carol/app.bsky.feed.post/3kroot", reply.Root.Uri)
+		assert.Equal(t, "at://did:plc:alice/app.bsky.feed.post/3kpost", reply.Parent.Uri)
+		assert.Equal(t, "cid-post", reply.Parent.Cid)
+	})
+
+	t.Run("ignores posts that aren't commands for the bot", func(t *testing.T) {
+		r, c, _ := newRouter()
+		for _, p := range []*post.Post{
+			mention("did:plc:alice", "@bot.test thanks!"),
+			mention("did:plc:alice", "/echo not addressed"),
+			mention(botDid, "@bot.test /echo talking to myself"),
+		} {
+			assert.False(t, r.Matches(p), p.Text)
+			assert.NoError(t, r.HandlePost(ctx, p))
+		}
+		assert.Empty(t, c.replies)
+	})
+
+	t.Run("recognizes handles and replies to the bot", func(t *testing.T) {
+		r, c, _ := newRouter(WithHandle("@bot.test"))
+		assert.False(t, r.Matches(&post.Post{Repo: "did:plc:alice", Text: "@bot.test.evil /echo hi"}))
+		assert.True(t, r.Matches(&post.Post{Repo: "did:plc:alice", Text: "hey @BOT.test /echo hi"}))
+		assert.NoError(t, r.HandlePost(ctx, &post.Post{Repo: "did:plc:alice", Rkey: "1", Cid: "c", Text: "@Bot.Test /echo a"}))
+
+		reply := &post.Post{Repo: "did:plc:alice", Rkey: "2", Cid: "c", Text: "/echo b"}
+		reply.ReplyRef = &appbsky.FeedPost_ReplyRef{
+			Root:   &atproto.RepoStrongRef{Uri: "at://did:plc:bot/app.bsky.feed.post/3kroot", Cid: "c"},
+			Parent: &atproto.RepoStrongRef{Uri: "at://did:plc:bot/app.bsky.feed.post/3kroot", Cid: "c"},
+		}
+		assert.NoError(t, r.HandlePost(ctx, reply))
+		assert.Equal(t, []string{"a", "b"}, c.texts())
+	})
+
+	t.Run("help", func(t *testing.T) {
+		r, c, _ := newRouter()
+		assert.NoError(t, r.HandlePost(ctx, mention("did:plc:alice", "@bot.test /help")))
+		assert.NoError(t, r.HandlePost(ctx, mention("did:plc:alice", "@bot.test /help /say")))
+		assert.Equal(t, []string{
+			"Commands:\n/echo <text> - Repeats the text\n/vip - For followers",
+			"/echo <text> - Repeats the text\nAliases: /say",
+		}, c.texts())
+	})
+
+	t.Run("unknown commands", func(t *testing.T) {
+		r, c, _ := newRouter()
+		assert.NoError(t, r.HandlePost(ctx, mention("did:plc:alice", "@bot.test /dance")))
+
+		silent, silentClient, _ := newRouter(WithRejectReply(func(*Request, error) string { return "" }))
+		assert.NoError(t, silent.HandlePost(ctx, mention("did:plc:alice", "@bot.test /dance")))
+
+		assert.Equal(t, []string{"I don't know /dance. Try /help."}, c.texts())
+		assert.Empty(t, silentClient.replies)
+	})
+
+	t.Run("unknown words without a prefix", func(t *testing.T) {
+		r, c, _ := newRouter(WithPrefix(""))
+		reply := &post.Post{Repo: "did:plc:alice", Rkey: "2", Cid: "c", Text: "nice post!"}
+		reply.ReplyRef = &appbsky.FeedPost_ReplyRef{
+			Root:   &atproto.RepoStrongRef{Uri: "at://did:plc:bot/app.bsky.feed.post/3kroot", Cid: "c"},
+			Parent: &atproto.RepoStrongRef{Uri: "at://did:plc:bot/app.bsky.feed.post/3kroot", Cid: "c"},
+		}
+		assert.False(t, r.Matches(reply))
+		assert.NoError(t, r.HandlePost(ctx, reply))
+		assert.NoError(t, r.HandlePost(ctx, mention("did:plc:alice", "@bot.test thanks!")))
+		assert.Empty(t, c.replies)
+
+		assert.NoError(t, r.HandlePost(ctx, mention("did:plc:alice", "@bot.test echo hi")))
+		assert.Equal(t, []string{"hi"}, c.texts())
+	})
+
+	t.Run("per-user cooldowns", func(t *testing.T) {
+		r, c, _ := newRouter()
+		now := time.Date(2024, 5, 6, 8, 0, 0, 0, time.UTC)
+		r.now = func() time.Time { return now }
+
+		var rejected []error
+		r.opts.RejectReply = func(req *Request, err error) string {
+			rejected = append(rejected, err)
+			return ""
+		}
+
+		assert.NoError(t, r.HandlePost(ctx, mention("did:plc:alice", "@bot.test /slow")))
+		now = now.Add(20 * time.Second)
+		assert.NoError(t, r.HandlePost(ctx, mention("did:plc:alice", "@bot.test /slow")))
+		assert.NoError(t, r.HandlePost(ctx, mention("did:plc:bob", "@bot.test /slow")))
+		now = now.Add(time.Minute)
+		assert.NoError(t, r.HandlePost(ctx, mention("did:plc:alice", "@bot.test /slow")))
+
+		assert.Equal(t, []string{"done", "done", "done"}, c.texts())
+		assert.Len(t, rejected, 1)
+		var cooldown *CooldownError
+		assert.True(t, errors.As(rejected[0], &cooldown))
+		assert.ErrorIs(t, rejected[0], ErrCooldown)
+		assert.Equal(t, 40*time.Second, cooldown.Remaining)
+	})
+
+	t.Run("permissions", func(t *testing.T) {
+		r, c, _ := newRouter()
+		assert.NoError(t, r.HandlePost(ctx, mention("did:plc:fan", "@bot.test /vip")))
+		assert.NoError(t, r.HandlePost(ctx, mention("did:plc:alice", "@bot.test /vip")))
+		assert.Equal(t, 2, c.lookups)
+
+		// Posts from notifications already carry the relationship
+		hydrated := mention("did:plc:alice", "@bot.test /vip")
+		hydrated.Author = &post.Author{Did: "did:plc:alice", Relationship: &post.Relationship{FollowedBy: "at://x"}}
+		assert.NoError(t, r.HandlePost(ctx, hydrated))
+		assert.Equal(t, 2, c.lookups)
+
+		assert.Equal(t, []string{"welcome", "Sorry, you can't use /vip.", "welcome"}, c.texts())
+	})
+
+	t.Run("rejects conflicting registrations", func(t *testing.T) {
+		r, _, _ := newRouter()
+		noop := func(context.Context, *Request) error { return nil }
+		err := r.Register(Command{Name: "new", Handler: noop}, Command{Name: "other", Aliases: []string{"ECHO"}, Handler: noop})
+		assert.ErrorIs(t, err, ErrInvalidCommand)
+		assert.ErrorIs(t, r.Register(Command{Name: "two words", Handler: noop}), ErrInvalidCommand)
+		assert.ErrorIs(t, r.Register(Command{Name: "nohandler"}), ErrInvalidCommand)
+		assert.Len(t, r.Commands(), 3)
+	})
+}
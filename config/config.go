@@ -31,6 +31,19 @@ type Config struct {
 
 	// Logging
 	Debug bool
+
+	// DryRun makes the client log record writes and direct messages instead
+	// of sending them
+	DryRun bool
+
+	// ExpiryIndexPath is the file where posts published with a TTL are
+	// tracked until they are deleted. When empty, they are only tracked in
+	// memory and forgotten on restart.
+	ExpiryIndexPath string
+
+	// ChatProxy is the service direct message requests are proxied to by the
+	// PDS, as a DID and service ID
+	ChatProxy string
 }
 
 // DefaultConfig returns a Config with sensible defaults
@@ -48,6 +61,8 @@ func Default() *Config {
 		FirehoseReconnectDelay: 5 * time.Second,
 		FirehoseBufferSize:     1000,
 		Debug:                  false,
+		DryRun:                 false,
+		ChatProxy:              "did:web:api.bsky.chat#bsky_chat",
 	}
 }
 
@@ -141,11 +156,33 @@ func (c *Config) WithDebug(debug bool) *Config {
 	return c
 }
 
+// WithDryRun sets the dry-run mode and returns the config
+func (c *Config) WithDryRun(dryRun bool) *Config {
+	c.DryRun = dryRun
+	return c
+}
+
+// WithExpiryIndexPath sets the expiry index path and returns the config
+func (c *Config) WithExpiryIndexPath(path string) *Config {
+	c.ExpiryIndexPath = path
+	return c
+}
+
+// WithChatProxy sets the chat service proxy and returns the config
+func (c *Config) WithChatProxy(proxy string) *Config {
+	c.ChatProxy = proxy
+	return c
+}
+
 func (c *Config) String() string {
 	debug := "false"
 	if c.Debug {
 		debug = "true"
 	}
+	dryRun := "false"
+	if c.DryRun {
+		dryRun = "true"
+	}
 
 	return "Config{" +
 		"Handle: " + c.Handle + ", " +
@@ -162,6 +199,9 @@ func (c *Config) String() string {
 		"FirehoseURL: " + c.FirehoseURL + ", " +
 		"FirehoseReconnectDelay: " + c.FirehoseReconnectDelay.String() + ", " +
 		"FirehoseBufferSize: " + strconv.Itoa(c.FirehoseBufferSize) + ", " +
-		"Debug: " + debug +
+		"Debug: " + debug + ", " +
+		"DryRun: " + dryRun + ", " +
+		"ExpiryIndexPath: " + c.ExpiryIndexPath + ", " +
+		"ChatProxy: " + c.ChatProxy +
 		"}"
 }
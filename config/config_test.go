@@ -18,6 +18,8 @@ func TestDefaultConfig(t *testing.T) {
 	assert.Equal(t, 60, cfg.RequestsPerMinute)
 	assert.Equal(t, 5, cfg.BurstSize)
 	assert.False(t, cfg.Debug)
+	assert.False(t, cfg.DryRun)
+	assert.Equal(t, "did:web:api.bsky.chat#bsky_chat", cfg.ChatProxy)
 }
 
 func TestConfigChaining(t *testing.T) {
@@ -32,7 +34,10 @@ func TestConfigChaining(t *testing.T) {
 		WithIdleConnTimeout(240 * time.Second).
 		WithRequestsPerMinute(120).
 		WithBurstSize(10).
-		WithDebug(true)
+		WithDebug(true).
+		WithDryRun(true).
+		WithExpiryIndexPath("/tmp/expiry.json").
+		WithChatProxy("did:web:chat.example.com#bsky_chat")
 
 	assert.Equal(t, "test.bsky.social", cfg.Handle)
 	assert.Equal(t, "https://example.com", cfg.ServerURL)
@@ -45,6 +50,9 @@ func TestConfigChaining(t *testing.T) {
 	assert.Equal(t, 120, cfg.RequestsPerMinute)
 	assert.Equal(t, 10, cfg.BurstSize)
 	assert.True(t, cfg.Debug)
+	assert.True(t, cfg.DryRun)
+	assert.Equal(t, "/tmp/expiry.json", cfg.ExpiryIndexPath)
+	assert.Equal(t, "did:web:chat.example.com#bsky_chat", cfg.ChatProxy)
 }
 
 func TestConfigString(t *testing.T) {
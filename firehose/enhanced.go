@@ -283,6 +283,7 @@ func PostFromCommitEvent(evt CommitEvent) (*post.Post, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed to convert post: %w", err)
 	}
+	newPost.Cid = op.Cid
 
 	return newPost, nil
 }
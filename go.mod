@@ -1,6 +1,6 @@
 module github.com/watzon/lining
 
-go 1.22
+go 1.23
 
 toolchain go1.23.3
 
@@ -9,6 +9,7 @@ require (
 	github.com/gorilla/websocket v1.5.3
 	github.com/ipld/go-car v0.6.1-0.20230509095817-92d28eb23ba4
 	github.com/joho/godotenv v1.5.1
+	github.com/rivo/uniseg v0.4.7
 	github.com/stretchr/testify v1.9.0
 )
 
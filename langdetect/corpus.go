@@ -0,0 +1,101 @@
+package langdetect
+
+// corpus holds the sample text the n-gram profiles are trained on. Every
+// sample says roughly the same thing so that the profiles differ by language
+// rather than by topic.
+var corpus = map[string]string{
+	"en": `The weather was cold this morning, so I stayed at home and read a book about the history of the city.
+In the afternoon my friends came over and we cooked dinner together. We talked about work, music, and the
+places we want to visit next year. I think that the best part of the day is the evening, when everything is
+quiet and the streets are empty. Have you seen the new movie that everyone is talking about? It is a story
+about a family that moves to a small town near the sea. They have to learn how to live with their neighbours
+and find out what really matters. This is just a quick update on the project: we have fixed most of the bugs
+and the next release will be ready soon. Thank you for all of your feedback, it helps us make things better
+for everyone. If you have any questions, please let me know and I will do my best to answer them. Good
+morning! What are you doing this weekend? I would love to go for a walk in the park if it does not rain.`,
+
+	"es": `Esta mañana hacía mucho frío, así que me quedé en casa y leí un libro sobre la historia de la ciudad.
+Por la tarde vinieron mis amigos y preparamos la cena juntos. Hablamos del trabajo, de la música y de los
+lugares que queremos visitar el próximo año. Creo que la mejor parte del día es la noche, cuando todo está
+tranquilo y las calles están vacías. ¿Has visto la nueva película de la que todos hablan? Es la historia de
+una familia que se muda a un pueblo pequeño cerca del mar. Tienen que aprender a vivir con sus vecinos y
+descubrir lo que realmente importa. Esto es solo una actualización rápida sobre el proyecto: hemos corregido
+la mayoría de los errores y la próxima versión estará lista pronto. Gracias por todos sus comentarios, nos
+ayudan a mejorar las cosas para todos. Si tienes alguna pregunta, por favor avísame y haré lo posible por
+responderla. ¡Buenos días! ¿Qué vas a hacer este fin de semana? Me encantaría dar un paseo por el parque si
+no llueve.`,
+
+	"fr": `Ce matin il faisait très froid, alors je suis resté à la maison et j'ai lu un livre sur l'histoire de
+la ville. L'après-midi, mes amis sont venus et nous avons préparé le dîner ensemble. Nous avons parlé du
+travail, de la musique et des endroits que nous voulons visiter l'année prochaine. Je pense que le meilleur
+moment de la journée est le soir, quand tout est calme et que les rues sont vides. As-tu vu le nouveau film
+dont tout le monde parle ? C'est l'histoire d'une famille qui s'installe dans un petit village près de la
+mer. Ils doivent apprendre à vivre avec leurs voisins et découvrir ce qui compte vraiment. Voici une petite
+mise à jour sur le projet : nous avons corrigé la plupart des bogues et la prochaine version sera bientôt
+prête. Merci pour tous vos commentaires, ils nous aident à améliorer les choses pour tout le monde. Si vous
+avez des questions, n'hésitez pas à me le dire et je ferai de mon mieux pour y répondre. Bonjour ! Qu'est-ce
+que tu fais ce week-end ? J'aimerais bien me promener dans le parc s'il ne pleut pas.`,
+
+	"de": `Heute Morgen war es sehr kalt, deshalb bin ich zu Hause geblieben und habe ein Buch über die
+Geschichte der Stadt gelesen. Am Nachmittag kamen meine Freunde vorbei und wir haben zusammen das Abendessen
+gekocht. Wir haben über die Arbeit, über Musik und über die Orte gesprochen, die wir nächstes Jahr besuchen
+wollen. Ich glaube, der schönste Teil des Tages ist der Abend, wenn alles ruhig ist und die Straßen leer
+sind. Hast du den neuen Film gesehen, über den alle reden? Es ist die Geschichte einer Familie, die in eine
+kleine Stadt am Meer zieht. Sie müssen lernen, mit ihren Nachbarn zu leben, und herausfinden, was wirklich
+wichtig ist. Hier ist ein kurzes Update zum Projekt: Wir haben die meisten Fehler behoben und die nächste
+Version wird bald fertig sein. Vielen Dank für euer Feedback, es hilft uns, die Dinge für alle besser zu
+machen. Wenn ihr Fragen habt, sagt mir bitte Bescheid und ich werde mein Bestes tun, um sie zu beantworten.
+Guten Morgen! Was machst du am Wochenende? Ich würde gerne im Park spazieren gehen, wenn es nicht regnet.`,
+
+	"pt": `Esta manhã estava muito frio, então fiquei em casa e li um livro sobre a história da cidade. À tarde
+os meus amigos vieram e preparamos o jantar juntos. Falamos sobre o trabalho, a música e os lugares que
+queremos visitar no próximo ano. Acho que a melhor parte do dia é a noite, quando tudo está tranquilo e as
+ruas estão vazias. Você já viu o novo filme de que todo mundo está falando? É a história de uma família que
+se muda para uma pequena cidade perto do mar. Eles precisam aprender a conviver com os vizinhos e descobrir o
+que realmente importa. Esta é apenas uma atualização rápida sobre o projeto: corrigimos a maioria dos erros e
+a próxima versão ficará pronta em breve. Obrigado por todos os comentários, eles nos ajudam a melhorar as
+coisas para todos. Se você tiver alguma dúvida, por favor me avise e farei o possível para responder. Bom
+dia! O que você vai fazer neste fim de semana? Eu adoraria dar um passeio no parque se não chover.`,
+
+	"it": `Stamattina faceva molto freddo, quindi sono rimasto a casa e ho letto un libro sulla storia della
+città. Nel pomeriggio sono venuti i miei amici e abbiamo preparato la cena insieme. Abbiamo parlato del
+lavoro, della musica e dei posti che vogliamo visitare il prossimo anno. Penso che la parte migliore della
+giornata sia la sera, quando tutto è tranquillo e le strade sono vuote. Hai visto il nuovo film di cui
+parlano tutti? È la storia di una famiglia che si trasferisce in un piccolo paese vicino al mare. Devono
+imparare a vivere con i loro vicini e scoprire che cosa conta davvero. Questo è solo un breve aggiornamento
+sul progetto: abbiamo corretto la maggior parte degli errori e la prossima versione sarà pronta presto.
+Grazie per tutti i vostri commenti, ci aiutano a migliorare le cose per tutti. Se avete domande, fatemelo
+sapere e farò del mio meglio per rispondere. Buongiorno! Che cosa fai questo fine settimana? Mi piacerebbe
+fare una passeggiata nel parco se non piove.`,
+
+	"nl": `Vanochtend was het erg koud, dus ik ben thuis gebleven en heb een boek gelezen over de geschiedenis
+van de stad. In de middag kwamen mijn vrienden langs en hebben we samen gekookt. We hebben gepraat over het
+werk, over muziek en over de plaatsen die we volgend jaar willen bezoeken. Ik denk dat het mooiste deel van
+de dag de avond is, wanneer alles rustig is en de straten leeg zijn. Heb je de nieuwe film gezien waar
+iedereen het over heeft? Het is het verhaal van een gezin dat naar een klein dorp aan zee verhuist. Ze
+moeten leren samenleven met hun buren en ontdekken wat er echt belangrijk is. Dit is een korte update over
+het project: we hebben de meeste fouten opgelost en de volgende versie is binnenkort klaar. Bedankt voor al
+jullie feedback, het helpt ons om dingen voor iedereen beter te maken. Als je vragen hebt, laat het me dan
+weten en ik zal mijn best doen om ze te beantwoorden. Goedemorgen! Wat ga jij dit weekend doen? Ik zou
+graag een wandeling maken in het park als het niet regent.`,
+
+	"ru": `Сегодня утром было очень холодно, поэтому я остался дома и читал книгу об истории города. Днём
+пришли мои друзья, и мы вместе приготовили ужин. Мы говорили о работе, о музыке и о местах, которые хотим
+посетить в следующем году. Я думаю, что лучшая часть дня — это вечер, когда всё спокойно и улицы пустые.
+Ты видел новый фильм, о котором все говорят? Это история семьи, которая переезжает в маленький город у
+моря. Им нужно научиться жить со своими соседями и понять, что действительно важно. Это короткое
+обновление о проекте: мы исправили большинство ошибок, и следующая версия скоро будет готова. Спасибо за
+все ваши отзывы, они помогают нам делать вещи лучше для всех. Если у вас есть вопросы, пожалуйста, дайте
+мне знать, и я постараюсь на них ответить. Доброе утро! Что ты делаешь в эти выходные? Я бы с
+удовольствием погулял в парке, если не будет дождя.`,
+
+	"uk": `Сьогодні вранці було дуже холодно, тому я залишився вдома і читав книжку про історію міста. Вдень
+прийшли мої друзі, і ми разом приготували вечерю. Ми говорили про роботу, про музику і про місця, які
+хочемо відвідати наступного року. Я думаю, що найкраща частина дня — це вечір, коли все спокійно і вулиці
+порожні. Ти бачив новий фільм, про який усі говорять? Це історія родини, яка переїжджає до маленького
+містечка біля моря. Їм треба навчитися жити зі своїми сусідами і зрозуміти, що справді важливо. Це коротке
+оновлення про проєкт: ми виправили більшість помилок, і наступна версія незабаром буде готова. Дякуємо за
+всі ваші відгуки, вони допомагають нам робити речі кращими для всіх. Якщо у вас є питання, будь ласка,
+дайте мені знати, і я постараюся на них відповісти. Доброго ранку! Що ти робиш у ці вихідні? Я б із
+задоволенням погуляв у парку, якщо не буде дощу.`,
+}
@@ -0,0 +1,360 @@
+// Package langdetect guesses the languages of short texts such as posts,
+// entirely offline. Languages with their own script (Japanese, Korean,
+// Arabic, ...) are recognized by script; languages sharing the Latin or
+// Cyrillic script are told apart using character trigram profiles. Text
+// written only in Han characters could be Chinese or Japanese, so it is only
+// reported as Chinese when Japanese isn't among the allowed languages.
+package langdetect
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// Options configures a Detector
+type Options struct {
+	// Languages restricts detection to these language codes. When empty, every
+	// supported language can be detected.
+	Languages []string
+	// MinLetters is the number of letters a sentence needs before its language
+	// is guessed; shorter sentences are too ambiguous to classify
+	MinLetters int
+	// MinShare is the fraction of the text's letters a language must account
+	// for to be reported
+	MinShare float64
+	// MaxLanguages caps the number of languages returned by Detect
+	MaxLanguages int
+}
+
+// Option is a function that configures an Options struct
+type Option func(*Options)
+
+// WithLanguages returns an Option that restricts detection to the given languages
+func WithLanguages(langs ...string) Option {
+	return func(opts *Options) {
+		opts.Languages = langs
+	}
+}
+
+// WithMinLetters returns an Option that sets the minimum sentence length, in letters
+func WithMinLetters(n int) Option {
+	return func(opts *Options) {
+		opts.MinLetters = n
+	}
+}
+
+// WithMinShare returns an Option that sets the minimum share of the text a
+// language must account for
+func WithMinShare(share float64) Option {
+	return func(opts *Options) {
+		opts.MinShare = share
+	}
+}
+
+// WithMaxLanguages returns an Option that caps the number of detected languages
+func WithMaxLanguages(n int) Option {
+	return func(opts *Options) {
+		opts.MaxLanguages = n
+	}
+}
+
+// DefaultOptions returns the default Options. MaxLanguages matches the
+// number of languages a Bluesky post can declare.
+func DefaultOptions() Options {
+	return Options{
+		MinLetters:   10,
+		MinShare:     0.2,
+		MaxLanguages: 3,
+	}
+}
+
+// Detector guesses the languages of a text. It is safe for concurrent use.
+//
+// Example:
+//
+//	detector := langdetect.New()
+//	langs := detector.Detect("Good morning everyone!\n¡Buenos días a todos!")
+//	// langs == []string{"en", "es"}
+type Detector struct {
+	options Options
+	allowed map[string]bool
+}
+
+// New creates a Detector with the specified options
+func New(opts ...Option) *Detector {
+	options := DefaultOptions()
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	d := &Detector{options: options}
+	if len(options.Languages) > 0 {
+		d.allowed = make(map[string]bool, len(options.Languages))
+		for _, lang := range options.Languages {
+			d.allowed[lang] = true
+		}
+	}
+	return d
+}
+
+// SupportedLanguages returns the codes of every language the detector knows
+func SupportedLanguages() []string {
+	langs := make([]string, 0, len(corpus)+len(scriptLanguages)+2)
+	langs = append(langs, "ja", "zh")
+	for lang := range corpus {
+		langs = append(langs, lang)
+	}
+	for _, sl := range scriptLanguages {
+		langs = append(langs, sl.lang)
+	}
+	sort.Strings(langs)
+	return langs
+}
+
+// Detect returns the languages of text, most prominent first. Each line or
+// sentence is classified on its own, so posts written in several languages
+// report all of them. It returns nil when no language can be determined with
+// confidence, for example when the text is too short.
+func (d *Detector) Detect(text string) []string {
+	letters := make(map[string]int)
+	total := 0
+	for _, sentence := range splitSentences(text) {
+		lang, n := d.classify(sentence)
+		if lang != "" {
+			letters[lang] += n
+			total += n
+		}
+	}
+
+	// Sentences may all be too short on their own but long enough together
+	if total == 0 {
+		if lang, n := d.classify(text); lang != "" {
+			letters[lang] += n
+			total += n
+		}
+	}
+	if total == 0 {
+		return nil
+	}
+
+	langs := make([]string, 0, len(letters))
+	for lang, n := range letters {
+		if float64(n)/float64(total) >= d.options.MinShare {
+			langs = append(langs, lang)
+		}
+	}
+	sort.Slice(langs, func(i, j int) bool {
+		if letters[langs[i]] != letters[langs[j]] {
+			return letters[langs[i]] > letters[langs[j]]
+		}
+		return langs[i] < langs[j]
+	})
+	if d.options.MaxLanguages > 0 && len(langs) > d.options.MaxLanguages {
+		langs = langs[:d.options.MaxLanguages]
+	}
+	return langs
+}
+
+// splitSentences splits text into lines and sentences
+func splitSentences(text string) []string {
+	return strings.FieldsFunc(text, func(r rune) bool {
+		switch r {
+		case '\n', '.', '!', '?', '。', '！', '？', '¡', '¿':
+			return true
+		}
+		return false
+	})
+}
+
+// classify returns the language of a single sentence and the number of
+// letters it was based on, or an empty string if it can't be determined
+func (d *Detector) classify(text string) (string, int) {
+	counts := make(map[*unicode.RangeTable]int)
+	letters := 0
+	for _, r := range text {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		letters++
+		for _, script := range scripts {
+			if unicode.Is(script, r) {
+				counts[script]++
+				break
+			}
+		}
+	}
+	if letters < d.options.MinLetters {
+		return "", 0
+	}
+
+	// Japanese mixes kanji with kana, so any kana at all decides it
+	if counts[unicode.Hiragana]+counts[unicode.Katakana] > 0 && d.isAllowed("ja") {
+		return "ja", letters
+	}
+
+	var dominant *unicode.RangeTable
+	for _, script := range scripts {
+		if dominant == nil || counts[script] > counts[dominant] {
+			dominant = script
+		}
+	}
+	if counts[dominant]*2 < letters {
+		return "", 0
+	}
+
+	// Chinese and Japanese both use Han, and without kana nothing tells them
+	// apart, so only guess when one of them has been ruled out
+	if dominant == unicode.Han {
+		switch {
+		case d.isAllowed("zh") && !d.isAllowed("ja"):
+			return "zh", letters
+		case d.isAllowed("ja") && !d.isAllowed("zh"):
+			return "ja", letters
+		}
+		return "", 0
+	}
+
+	for _, sl := range scriptLanguages {
+		if sl.script == dominant {
+			if d.isAllowed(sl.lang) {
+				return sl.lang, letters
+			}
+			return "", 0
+		}
+	}
+
+	lang := d.bestProfile(dominant, text)
+	if lang == "" {
+		return "", 0
+	}
+	return lang, letters
+}
+
+func (d *Detector) isAllowed(lang string) bool {
+	return d.allowed == nil || d.allowed[lang]
+}
+
+// bestProfile scores text against the trigram profiles of the languages
+// written in script and returns the most likely one
+func (d *Detector) bestProfile(script *unicode.RangeTable, text string) string {
+	grams := trigrams(text)
+	if len(grams) == 0 {
+		return ""
+	}
+
+	best := ""
+	bestScore := math.Inf(-1)
+	for _, p := range loadProfiles() {
+		if p.script != script || !d.isAllowed(p.lang) {
+			continue
+		}
+		if score := p.score(grams); score > bestScore {
+			best, bestScore = p.lang, score
+		}
+	}
+	return best
+}
+
+// scripts are the writing systems the detector distinguishes, in order of
+// precedence
+var scripts = []*unicode.RangeTable{
+	unicode.Latin,
+	unicode.Cyrillic,
+	unicode.Greek,
+	unicode.Arabic,
+	unicode.Hebrew,
+	unicode.Devanagari,
+	unicode.Thai,
+	unicode.Hangul,
+	unicode.Hiragana,
+	unicode.Katakana,
+	unicode.Han,
+}
+
+// scriptLanguages maps scripts used by a single supported language to that language
+var scriptLanguages = []struct {
+	script *unicode.RangeTable
+	lang   string
+}{
+	{unicode.Greek, "el"},
+	{unicode.Arabic, "ar"},
+	{unicode.Hebrew, "he"},
+	{unicode.Devanagari, "hi"},
+	{unicode.Thai, "th"},
+	{unicode.Hangul, "ko"},
+}
+
+// profile is the trigram frequency profile of a language
+type profile struct {
+	lang   string
+	script *unicode.RangeTable
+	counts map[string]int
+	total  int
+	vocab  int
+}
+
+// score returns the log-likelihood of the trigrams under the profile, using
+// add-one smoothing for trigrams the profile has never seen
+func (p *profile) score(grams []string) float64 {
+	denominator := math.Log(float64(p.total + p.vocab))
+	var score float64
+	for _, g := range grams {
+		score += math.Log(float64(p.counts[g]+1)) - denominator
+	}
+	return score
+}
+
+var (
+	profilesOnce sync.Once
+	profiles     []*profile
+)
+
+// loadProfiles builds the trigram profiles from the corpus on first use
+func loadProfiles() []*profile {
+	profilesOnce.Do(func() {
+		vocab := make(map[string]bool)
+		for lang, sample := range corpus {
+			p := &profile{lang: lang, counts: make(map[string]int)}
+			for _, g := range trigrams(sample) {
+				p.counts[g]++
+				p.total++
+				vocab[g] = true
+			}
+			for _, r := range sample {
+				if unicode.Is(unicode.Cyrillic, r) {
+					p.script = unicode.Cyrillic
+					break
+				}
+				if unicode.Is(unicode.Latin, r) {
+					p.script = unicode.Latin
+					break
+				}
+			}
+			profiles = append(profiles, p)
+		}
+		for _, p := range profiles {
+			p.vocab = len(vocab)
+		}
+		sort.Slice(profiles, func(i, j int) bool { return profiles[i].lang < profiles[j].lang })
+	})
+	return profiles
+}
+
+// trigrams returns the character trigrams of every word in text. Words are
+// lowercased and padded with spaces so that word beginnings and endings
+// count as features.
+func trigrams(text string) []string {
+	var grams []string
+	for _, word := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && r != '\''
+	}) {
+		runes := []rune(" " + strings.Trim(word, "'") + " ")
+		for i := 0; i+3 <= len(runes); i++ {
+			grams = append(grams, string(runes[i:i+3]))
+		}
+	}
+	return grams
+}
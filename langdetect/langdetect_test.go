@@ -0,0 +1,73 @@
+package langdetect
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDetect(t *testing.T) {
+	detector := New()
+
+	tests := []struct {
+		name string
+		text string
+		want []string
+	}{
+		{"english", "Just shipped a new version of the library, let me know what you think!", []string{"en"}},
+		{"spanish", "Acabamos de publicar una nueva versión de la biblioteca, ¿qué os parece?", []string{"es"}},
+		{"french", "Nous venons de publier une nouvelle version de la bibliothèque, qu'en pensez-vous ?", []string{"fr"}},
+		{"german", "Wir haben gerade eine neue Version der Bibliothek veröffentlicht, was haltet ihr davon?", []string{"de"}},
+		{"portuguese", "Acabamos de lançar uma nova versão da biblioteca, o que vocês acham?", []string{"pt"}},
+		{"italian", "Abbiamo appena pubblicato una nuova versione della libreria, che ne pensate?", []string{"it"}},
+		{"dutch", "We hebben net een nieuwe versie van de bibliotheek uitgebracht, wat vinden jullie ervan?", []string{"nl"}},
+		{"russian", "Мы только что выпустили новую версию библиотеки, что вы думаете?", []string{"ru"}},
+		{"ukrainian", "Ми щойно випустили нову версію бібліотеки, що ви думаєте?", []string{"uk"}},
+		{"japanese", "ライブラリの新しいバージョンを公開しました。ご意見をお聞かせください", []string{"ja"}},
+		{"korean", "라이브러리의 새 버전을 출시했습니다 어떻게 생각하세요", []string{"ko"}},
+		{"han only", "我们刚刚发布了这个库的新版本，大家觉得怎么样", nil},
+		{"multilingual", "Good morning everyone, the release is out!\n¡Buenos días a todos, ya está disponible la nueva versión!", []string{"es", "en"}},
+		{"too short", "lol ok", nil},
+		{"no letters", "12345 🎉🎉", nil},
+		{"urls only", "https://", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, detector.Detect(tt.text))
+		})
+	}
+}
+
+func TestDetectOptions(t *testing.T) {
+	text := "Good morning everyone, the release is out!\n¡Buenos días a todos, ya está disponible la nueva versión!"
+
+	t.Run("restricted languages", func(t *testing.T) {
+		detector := New(WithLanguages("en", "fr"))
+		assert.NotContains(t, detector.Detect(text), "es")
+		assert.Contains(t, detector.Detect(text), "en")
+		assert.Nil(t, New(WithLanguages("en")).Detect("我们刚刚发布了这个库的新版本"))
+		assert.Equal(t, []string{"zh"}, New(WithLanguages("en", "zh")).Detect("我们刚刚发布了这个库的新版本"))
+	})
+
+	t.Run("max languages", func(t *testing.T) {
+		assert.Equal(t, []string{"es"}, New(WithMaxLanguages(1)).Detect(text))
+	})
+
+	t.Run("min share", func(t *testing.T) {
+		long := text + "\nThanks to everyone who reported bugs and helped test the release candidates."
+		assert.Equal(t, []string{"en", "es"}, New().Detect(long))
+		assert.Equal(t, []string{"en"}, New(WithMinShare(0.6)).Detect(long))
+	})
+
+	t.Run("short sentences combined", func(t *testing.T) {
+		assert.Equal(t, []string{"en"}, New().Detect("Thanks. See you all. Bye now."))
+	})
+}
+
+func TestSupportedLanguages(t *testing.T) {
+	langs := SupportedLanguages()
+	assert.Contains(t, langs, "en")
+	assert.Contains(t, langs, "ja")
+	assert.Contains(t, langs, "uk")
+}
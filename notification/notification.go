@@ -0,0 +1,197 @@
+// Package notification provides typed notifications for the authenticated
+// account and dispatches them to handlers, in the same way the firehose
+// package does for network events.
+package notification
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/bluesky-social/indigo/api/bsky"
+	lexutil "github.com/bluesky-social/indigo/lex/util"
+
+	"github.com/watzon/lining/interaction"
+	"github.com/watzon/lining/post"
+	"github.com/watzon/lining/utils"
+)
+
+// Reason is why a notification was sent
+type Reason string
+
+const (
+	ReasonLike              Reason = "like"
+	ReasonRepost            Reason = "repost"
+	ReasonFollow            Reason = "follow"
+	ReasonMention           Reason = "mention"
+	ReasonReply             Reason = "reply"
+	ReasonQuote             Reason = "quote"
+	ReasonStarterpackJoined Reason = "starterpack-joined"
+)
+
+// Notification is a notification for the authenticated account
+type Notification struct {
+	// Uri and Cid identify the record that caused the notification, such as
+	// the like or the reply
+	Uri    string
+	Cid    string
+	Author *post.Author
+	Reason Reason
+	// ReasonSubject is the URI of the post that was liked, reposted, replied
+	// to or quoted
+	ReasonSubject string
+	IsRead        bool
+	IndexedAt     string
+	// Post is set for mentions, replies and quotes
+	Post *post.Post
+	// Record is the record that caused the notification
+	Record *lexutil.LexiconTypeDecoder
+}
+
+// Time returns when the notification was indexed
+func (n *Notification) Time() time.Time {
+	t, _ := time.Parse(time.RFC3339, n.IndexedAt)
+	return t
+}
+
+// FromListNotifications converts a notification returned by
+// app.bsky.notification.listNotifications
+func FromListNotifications(n *bsky.NotificationListNotifications_Notification) (*Notification, error) {
+	converted := &Notification{
+		Uri:       n.Uri,
+		Cid:       n.Cid,
+		Author:    post.AuthorFromProfileView(n.Author),
+		Reason:    Reason(n.Reason),
+		IsRead:    n.IsRead,
+		IndexedAt: n.IndexedAt,
+		Record:    n.Record,
+	}
+	if n.ReasonSubject != nil {
+		converted.ReasonSubject = *n.ReasonSubject
+	}
+
+	if n.Record != nil {
+		if feedPost, ok := n.Record.Val.(*bsky.FeedPost); ok {
+			repo, _, rkey, err := post.ParsePostURI(n.Uri)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse notification URI: %w", err)
+			}
+			p, err := post.PostFromFeedPost(feedPost, repo, rkey)
+			if err != nil {
+				return nil, fmt.Errorf("failed to convert notification post: %w", err)
+			}
+			p.Repo = repo
+			p.Rkey = rkey
+			p.Cid = n.Cid
+			p.Author = converted.Author
+			p.IndexedAt = n.IndexedAt
+			converted.Post = p
+		}
+	}
+
+	return converted, nil
+}
+
+// Filter is a function that filters notifications
+type Filter func(*Notification) bool
+
+// PostFilter is a function that filters the posts of mentions, replies and
+// quotes
+type PostFilter func(*post.Post) bool
+
+// HandlerWithFilter combines a notification handler with its filters
+type HandlerWithFilter struct {
+	Handler func(*Notification) error
+	Filters []Filter
+}
+
+// PostHandlerWithFilter combines a handler for the posts of mentions,
+// replies or quotes with its filters
+type PostHandlerWithFilter struct {
+	Handler func(*post.Post) error
+	Filters []PostFilter
+}
+
+// Callbacks holds the handlers notifications are dispatched to. Handlers
+// only run when all of their filters return true.
+type Callbacks struct {
+	// Handlers receive every notification
+	Handlers        []HandlerWithFilter
+	MentionHandlers []PostHandlerWithFilter
+	ReplyHandlers   []PostHandlerWithFilter
+	QuoteHandlers   []PostHandlerWithFilter
+	FollowHandlers  []interaction.FollowHandlerWithFilter
+	LikeHandlers    []interaction.LikeHandlerWithFilter
+	RepostHandlers  []interaction.RepostHandlerWithFilter
+}
+
+// Dispatch passes a notification to the matching handlers and stops at the
+// first error
+func (cb *Callbacks) Dispatch(n *Notification) error {
+	for _, h := range cb.Handlers {
+		if utils.MatchesAll(n, h.Filters) {
+			if err := h.Handler(n); err != nil {
+				return err
+			}
+		}
+	}
+
+	base := interaction.Interaction{Subject: n.ReasonSubject, CreatedAt: n.Time()}
+	if n.Author != nil {
+		base.Actor = n.Author.Did
+	}
+	switch n.Reason {
+	case ReasonMention:
+		return dispatchPost(n.Post, cb.MentionHandlers)
+	case ReasonReply:
+		return dispatchPost(n.Post, cb.ReplyHandlers)
+	case ReasonQuote:
+		return dispatchPost(n.Post, cb.QuoteHandlers)
+	case ReasonFollow:
+		follow := &interaction.Follow{Interaction: base}
+		if n.Record != nil {
+			if record, ok := n.Record.Val.(*bsky.GraphFollow); ok {
+				follow.Subject = record.Subject
+			}
+		}
+		for _, h := range cb.FollowHandlers {
+			if utils.MatchesAll(follow, h.Filters) {
+				if err := h.Handler(follow); err != nil {
+					return err
+				}
+			}
+		}
+	case ReasonLike:
+		like := &interaction.Like{Interaction: base, Uri: n.ReasonSubject}
+		for _, h := range cb.LikeHandlers {
+			if utils.MatchesAll(like, h.Filters) {
+				if err := h.Handler(like); err != nil {
+					return err
+				}
+			}
+		}
+	case ReasonRepost:
+		repost := &interaction.Repost{Interaction: base, Uri: n.ReasonSubject}
+		for _, h := range cb.RepostHandlers {
+			if utils.MatchesAll(repost, h.Filters) {
+				if err := h.Handler(repost); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func dispatchPost(p *post.Post, handlers []PostHandlerWithFilter) error {
+	if p == nil {
+		return nil
+	}
+	for _, h := range handlers {
+		if utils.MatchesAll(p, h.Filters) {
+			if err := h.Handler(p); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,616 @@
+// Package outbox provides a durable, file-backed queue of writes (posts, likes
+// and follows) that are sent to Bluesky in the background. Items are persisted
+// before they are sent, retried with exponential backoff while the PDS is
+// unreachable, and survive process restarts. Every item is written under a
+// record key chosen when it is enqueued, so resending an item never creates a
+// duplicate.
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	appbsky "github.com/bluesky-social/indigo/api/bsky"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+	"github.com/bluesky-social/indigo/xrpc"
+
+	"github.com/watzon/lining/client"
+	"github.com/watzon/lining/post"
+	"github.com/watzon/lining/utils"
+)
+
+// ErrNotFound is returned when no item has the given ID
+var ErrNotFound = errors.New("outbox item not found")
+
+// Kind is the kind of write an Item makes
+type Kind string
+
+const (
+	KindPost   Kind = "post"
+	KindLike   Kind = "like"
+	KindFollow Kind = "follow"
+)
+
+// Status is the delivery status of an Item
+type Status string
+
+const (
+	// StatusPending items are waiting to be sent or retried
+	StatusPending Status = "pending"
+	// StatusSent items were written successfully
+	StatusSent Status = "sent"
+	// StatusFailed items failed permanently or ran out of attempts. They stay
+	// in the outbox until they are retried or removed.
+	StatusFailed Status = "failed"
+)
+
+// Item is a write queued in the outbox
+type Item struct {
+	// ID identifies the item. It is a TID and doubles as the record key.
+	ID   string `json:"id"`
+	Kind Kind   `json:"kind"`
+
+	// Post, Threadgate and Postgate are set for posts
+	Post       *appbsky.FeedPost `json:"post,omitempty"`
+	Threadgate *post.Threadgate  `json:"threadgate,omitempty"`
+	Postgate   *post.Postgate    `json:"postgate,omitempty"`
+	// TTL, if set, is how long the post stays up once it's sent
+	TTL time.Duration `json:"ttl,omitempty"`
+
+	// Subject is the URI of the liked post or the DID of the followed user
+	Subject string `json:"subject,omitempty"`
+	// SubjectCid is the CID of the liked post
+	SubjectCid string `json:"subjectCid,omitempty"`
+
+	Status      Status    `json:"status"`
+	Attempts    int       `json:"attempts"`
+	LastError   string    `json:"lastError,omitempty"`
+	NextAttempt time.Time `json:"nextAttempt"`
+	CreatedAt   time.Time `json:"createdAt"`
+	SentAt      time.Time `json:"sentAt"`
+	// Uri is the URI of the written record, once sent. It is empty for follows.
+	Uri string `json:"uri,omitempty"`
+}
+
+// Sender writes outbox items to Bluesky. *client.BskyClient satisfies it.
+type Sender interface {
+	PostToFeed(ctx context.Context, p appbsky.FeedPost, opts ...client.PostOption) (string, string, error)
+	Like(ctx context.Context, uri string, cid string, opts ...client.RecordOption) (string, error)
+	Follow(ctx context.Context, did string, opts ...client.RecordOption) error
+}
+
+// Options configures an Outbox
+type Options struct {
+	// MaxAttempts is the number of times an item is sent before it's marked
+	// as failed
+	MaxAttempts int
+	// InitialBackoff is the delay before the first retry; it doubles with
+	// every attempt up to MaxBackoff
+	InitialBackoff time.Duration
+	// MaxBackoff caps the delay between retries
+	MaxBackoff time.Duration
+	// KeepSent is the number of sent items kept for inspection; older ones
+	// are dropped
+	KeepSent int
+	// OnSent is called after an item has been sent
+	OnSent func(Item)
+	// OnFailed is called when an item is marked as failed
+	OnFailed func(Item)
+}
+
+// Option is a function that configures an Options struct
+type Option func(*Options)
+
+// WithMaxAttempts returns an Option that sets the number of attempts per item
+func WithMaxAttempts(n int) Option {
+	return func(opts *Options) {
+		opts.MaxAttempts = n
+	}
+}
+
+// WithBackoff returns an Option that sets the initial and maximum retry delays
+func WithBackoff(initial, max time.Duration) Option {
+	return func(opts *Options) {
+		opts.InitialBackoff = initial
+		opts.MaxBackoff = max
+	}
+}
+
+// WithKeepSent returns an Option that sets how many sent items are kept
+func WithKeepSent(n int) Option {
+	return func(opts *Options) {
+		opts.KeepSent = n
+	}
+}
+
+// WithOnSent returns an Option that sets the function called for sent items
+func WithOnSent(fn func(Item)) Option {
+	return func(opts *Options) {
+		opts.OnSent = fn
+	}
+}
+
+// WithOnFailed returns an Option that sets the function called for failed items
+func WithOnFailed(fn func(Item)) Option {
+	return func(opts *Options) {
+		opts.OnFailed = fn
+	}
+}
+
+// DefaultOptions returns the default Options
+func DefaultOptions() Options {
+	return Options{
+		MaxAttempts:    8,
+		InitialBackoff: 5 * time.Second,
+		MaxBackoff:     10 * time.Minute,
+		KeepSent:       100,
+	}
+}
+
+// Outbox is a durable queue of writes. It is safe for concurrent use.
+//
+// Example:
+//
+//	box, err := outbox.Open("outbox.json", client)
+//	if err != nil {
+//	    return err
+//	}
+//	go box.Run(ctx)
+//
+//	item, err := box.EnqueuePost(feedPost, client.WithThreadgate(post.Threadgate{}))
+type Outbox struct {
+	options Options
+	path    string
+	sender  Sender
+
+	mu    sync.Mutex
+	items []*Item
+	// inFlight holds the IDs of items claimed by a Run or Drain that is
+	// sending them, so that no other one sends them at the same time
+	inFlight map[string]bool
+	wake     chan struct{}
+}
+
+// Open opens the outbox stored at path, creating it if it doesn't exist.
+// Items left pending by a previous process are sent again by Run or Drain.
+func Open(path string, sender Sender, opts ...Option) (*Outbox, error) {
+	options := DefaultOptions()
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	o := &Outbox{
+		options:  options,
+		path:     path,
+		sender:   sender,
+		inFlight: make(map[string]bool),
+		wake:     make(chan struct{}, 1),
+	}
+
+	data, err := os.ReadFile(path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+	case err != nil:
+		return nil, fmt.Errorf("failed to read outbox: %w", err)
+	default:
+		if err := json.Unmarshal(data, &o.items); err != nil {
+			return nil, fmt.Errorf("failed to parse outbox: %w", err)
+		}
+	}
+
+	return o, nil
+}
+
+// EnqueuePost queues a post. Threadgate, postgate, rkey and TTL options are
+// kept with the item; if no rkey is given, the item's ID is used. The post's
+// CreatedAt is fixed when it's enqueued.
+//
+// Images must already be uploaded. The PDS may discard blobs that no record
+// references after a while, so don't leave posts with images queued for long.
+func (o *Outbox) EnqueuePost(p appbsky.FeedPost, opts ...client.PostOption) (Item, error) {
+	var options client.PostOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	if p.CreatedAt == "" {
+		p.CreatedAt = time.Now().Format(time.RFC3339)
+	}
+	item := &Item{
+		ID:         options.Rkey,
+		Kind:       KindPost,
+		Post:       &p,
+		Threadgate: options.Threadgate,
+		Postgate:   options.Postgate,
+		TTL:        options.TTL,
+	}
+	if item.ID != "" {
+		if _, err := syntax.ParseTID(item.ID); err != nil {
+			return Item{}, fmt.Errorf("%w %q: %w", client.ErrInvalidRkey, item.ID, err)
+		}
+	}
+	return o.enqueue(item)
+}
+
+// EnqueueLike queues a like of the post with the given URI and CID
+func (o *Outbox) EnqueueLike(uri string, cid string) (Item, error) {
+	return o.enqueue(&Item{Kind: KindLike, Subject: uri, SubjectCid: cid})
+}
+
+// EnqueueFollow queues a follow of the user with the given DID
+func (o *Outbox) EnqueueFollow(did string) (Item, error) {
+	return o.enqueue(&Item{Kind: KindFollow, Subject: did})
+}
+
+func (o *Outbox) enqueue(item *Item) (Item, error) {
+	now := time.Now()
+	if item.ID == "" {
+		item.ID = utils.NewTID().String()
+	}
+	item.Status = StatusPending
+	item.CreatedAt = now
+	item.NextAttempt = now
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	for _, existing := range o.items {
+		if existing.ID == item.ID {
+			return Item{}, fmt.Errorf("outbox already has an item with ID %s", item.ID)
+		}
+	}
+	o.items = append(o.items, item)
+	if err := o.save(); err != nil {
+		o.items = o.items[:len(o.items)-1]
+		return Item{}, err
+	}
+
+	o.notify()
+	return *item, nil
+}
+
+// notify wakes up Run
+func (o *Outbox) notify() {
+	select {
+	case o.wake <- struct{}{}:
+	default:
+	}
+}
+
+// save writes the outbox to disk atomically. The caller must hold o.mu.
+func (o *Outbox) save() error {
+	data, err := json.MarshalIndent(o.items, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode outbox: %w", err)
+	}
+
+	if err := utils.WriteFileAtomic(o.path, data, 0o600); err != nil {
+		return fmt.Errorf("failed to save outbox: %w", err)
+	}
+	return nil
+}
+
+// Run sends queued items as they become due until ctx is cancelled, and then
+// returns ctx.Err(). Errors saving the outbox are returned immediately.
+func (o *Outbox) Run(ctx context.Context) error {
+	for {
+		if err := o.Drain(ctx); err != nil {
+			return err
+		}
+
+		wait := time.Hour
+		if next, ok := o.nextAttempt(); ok {
+			wait = time.Until(next)
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-o.wake:
+			timer.Stop()
+		case <-timer.C:
+		}
+	}
+}
+
+// nextAttempt returns the earliest time a pending item is due
+func (o *Outbox) nextAttempt() (time.Time, bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	var next time.Time
+	for _, item := range o.items {
+		if item.Status == StatusPending && !o.inFlight[item.ID] && (next.IsZero() || item.NextAttempt.Before(next)) {
+			next = item.NextAttempt
+		}
+	}
+	return next, !next.IsZero()
+}
+
+// Drain sends every pending item that is due, in the order they were queued.
+// Items that fail are rescheduled or marked as failed; Drain only returns an
+// error if ctx is cancelled or the outbox can't be saved. Each item is claimed
+// before it is sent, so concurrent calls to Drain and Run never send the same
+// item twice.
+func (o *Outbox) Drain(ctx context.Context) error {
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		item, ok := o.nextDue()
+		if !ok {
+			return nil
+		}
+
+		uri, err := o.send(ctx, item)
+		if err != nil && ctx.Err() != nil {
+			// Cancelled mid-send; the item is sent again next time
+			o.release(item.ID)
+			return ctx.Err()
+		}
+		if err := o.record(item.ID, uri, err); err != nil {
+			return err
+		}
+	}
+}
+
+// nextDue claims the first pending item that is due and isn't being sent
+// already, and returns a copy of it. The claim is released by record.
+func (o *Outbox) nextDue() (Item, bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	now := time.Now()
+	for _, item := range o.items {
+		if item.Status == StatusPending && !o.inFlight[item.ID] && !item.NextAttempt.After(now) {
+			o.inFlight[item.ID] = true
+			return *item, true
+		}
+	}
+	return Item{}, false
+}
+
+// release gives up the claim on an item without recording an attempt
+func (o *Outbox) release(id string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	delete(o.inFlight, id)
+}
+
+// send writes a single item
+func (o *Outbox) send(ctx context.Context, item Item) (string, error) {
+	switch item.Kind {
+	case KindPost:
+		if item.Post == nil {
+			return "", fmt.Errorf("post item %s has no post", item.ID)
+		}
+		opts := []client.PostOption{client.WithRkey(item.ID)}
+		if item.Threadgate != nil {
+			opts = append(opts, client.WithThreadgate(*item.Threadgate))
+		}
+		if item.Postgate != nil {
+			opts = append(opts, client.WithPostgate(*item.Postgate))
+		}
+		if item.TTL > 0 {
+			opts = append(opts, client.WithTTL(item.TTL))
+		}
+		_, uri, err := o.sender.PostToFeed(ctx, *item.Post, opts...)
+		return uri, err
+	case KindLike:
+		return o.sender.Like(ctx, item.Subject, item.SubjectCid, client.WithRecordKey(item.ID))
+	case KindFollow:
+		return "", o.sender.Follow(ctx, item.Subject, client.WithRecordKey(item.ID))
+	default:
+		return "", fmt.Errorf("unknown outbox item kind %q", item.Kind)
+	}
+}
+
+// record stores the outcome of sending an item
+func (o *Outbox) record(id string, uri string, sendErr error) error {
+	o.mu.Lock()
+	delete(o.inFlight, id)
+
+	var item *Item
+	for _, it := range o.items {
+		if it.ID == id {
+			item = it
+			break
+		}
+	}
+	if item == nil {
+		// Removed while it was being sent
+		o.mu.Unlock()
+		return nil
+	}
+
+	now := time.Now()
+	item.Attempts++
+	var callback func(Item)
+	switch {
+	case sendErr == nil:
+		item.Status = StatusSent
+		item.Uri = uri
+		item.SentAt = now
+		item.LastError = ""
+		callback = o.options.OnSent
+	case IsPermanent(sendErr) || item.Attempts >= o.options.MaxAttempts:
+		item.Status = StatusFailed
+		item.LastError = sendErr.Error()
+		callback = o.options.OnFailed
+	default:
+		item.LastError = sendErr.Error()
+		item.NextAttempt = now.Add(o.backoff(item.Attempts, sendErr))
+	}
+	snapshot := *item
+
+	o.pruneSent()
+	err := o.save()
+	o.mu.Unlock()
+
+	if callback != nil {
+		callback(snapshot)
+	}
+	return err
+}
+
+// backoff returns the delay before the next attempt
+func (o *Outbox) backoff(attempts int, err error) time.Duration {
+	return Backoff(attempts, o.options.InitialBackoff, o.options.MaxBackoff, err)
+}
+
+// Backoff returns the delay before retrying a write that failed with err for
+// the given number of attempts. The delay starts at initial and doubles with
+// every attempt up to max. Rate limited requests wait until the limit resets.
+func Backoff(attempts int, initial, max time.Duration, err error) time.Duration {
+	var xerr *xrpc.Error
+	if errors.As(err, &xerr) && xerr.Ratelimit != nil {
+		if wait := time.Until(xerr.Ratelimit.Reset); wait > 0 {
+			return wait
+		}
+	}
+
+	delay := initial
+	for i := 1; i < attempts && delay < max; i++ {
+		delay *= 2
+	}
+	if max > 0 && delay > max {
+		delay = max
+	}
+	return delay
+}
+
+// IsPermanent reports whether retrying a failed write is pointless: the
+// client or its write hooks rejected it, or the PDS refused the request itself
+func IsPermanent(err error) bool {
+	if errors.Is(err, client.ErrWriteRejected) ||
+		errors.Is(err, post.ErrInvalidLanguage) ||
+		errors.Is(err, post.ErrInvalidLabel) ||
+		errors.Is(err, client.ErrInvalidRkey) {
+		return true
+	}
+
+	var xerr *xrpc.Error
+	if errors.As(err, &xerr) {
+		switch xerr.StatusCode {
+		case http.StatusUnauthorized, http.StatusRequestTimeout, http.StatusTooManyRequests:
+			return false
+		}
+		return xerr.StatusCode >= 400 && xerr.StatusCode < 500
+	}
+	return false
+}
+
+// pruneSent drops the oldest sent items beyond KeepSent. The caller must hold
+// o.mu.
+func (o *Outbox) pruneSent() {
+	sent := 0
+	for _, item := range o.items {
+		if item.Status == StatusSent {
+			sent++
+		}
+	}
+
+	drop := sent - o.options.KeepSent
+	if drop <= 0 {
+		return
+	}
+	kept := o.items[:0]
+	for _, item := range o.items {
+		if item.Status == StatusSent && drop > 0 {
+			drop--
+			continue
+		}
+		kept = append(kept, item)
+	}
+	o.items = kept
+}
+
+// Items returns copies of the items in the outbox, in the order they were
+// queued. If statuses are given, only items with one of them are returned.
+//
+// Example:
+//
+//	for _, item := range box.Items(outbox.StatusFailed) {
+//	    log.Printf("%s %s failed: %s", item.Kind, item.ID, item.LastError)
+//	}
+func (o *Outbox) Items(statuses ...Status) []Item {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	var items []Item
+	for _, item := range o.items {
+		if len(statuses) == 0 || hasStatus(statuses, item.Status) {
+			items = append(items, *item)
+		}
+	}
+	return items
+}
+
+func hasStatus(statuses []Status, status Status) bool {
+	for _, s := range statuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+// Get returns a copy of the item with the given ID
+func (o *Outbox) Get(id string) (Item, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	for _, item := range o.items {
+		if item.ID == id {
+			return *item, nil
+		}
+	}
+	return Item{}, fmt.Errorf("%w: %s", ErrNotFound, id)
+}
+
+// Retry puts a failed item back in the queue with a fresh set of attempts.
+// The item keeps its ID, so it is still written under the same record key.
+func (o *Outbox) Retry(id string) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	for _, item := range o.items {
+		if item.ID != id {
+			continue
+		}
+		if item.Status != StatusFailed {
+			return fmt.Errorf("outbox item %s is %s, not failed", id, item.Status)
+		}
+		item.Status = StatusPending
+		item.Attempts = 0
+		item.NextAttempt = time.Now()
+		if err := o.save(); err != nil {
+			return err
+		}
+		o.notify()
+		return nil
+	}
+	return fmt.Errorf("%w: %s", ErrNotFound, id)
+}
+
+// Remove deletes an item from the outbox, whatever its status
+func (o *Outbox) Remove(id string) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	for i, item := range o.items {
+		if item.ID == id {
+			o.items = append(o.items[:i], o.items[i+1:]...)
+			return o.save()
+		}
+	}
+	return fmt.Errorf("%w: %s", ErrNotFound, id)
+}
@@ -0,0 +1,297 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	appbsky "github.com/bluesky-social/indigo/api/bsky"
+	"github.com/bluesky-social/indigo/xrpc"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/watzon/lining/client"
+	"github.com/watzon/lining/config"
+	"github.com/watzon/lining/post"
+)
+
+// fakeSender records writes and fails the first failures of them
+type fakeSender struct {
+	mu       sync.Mutex
+	failures int
+	err      error
+	posts    []string
+	rkeys    []string
+	gates    int
+	// hold, when set, blocks posts until it is closed
+	hold chan struct{}
+}
+
+func (s *fakeSender) fail() error {
+	if s.failures > 0 {
+		s.failures--
+		if s.err != nil {
+			return s.err
+		}
+		return &xrpc.Error{StatusCode: http.StatusBadGateway}
+	}
+	return nil
+}
+
+func (s *fakeSender) PostToFeed(ctx context.Context, p appbsky.FeedPost, opts ...client.PostOption) (string, string, error) {
+	if s.hold != nil {
+		<-s.hold
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var options client.PostOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+	s.rkeys = append(s.rkeys, options.Rkey)
+	if err := s.fail(); err != nil {
+		return "", "", err
+	}
+	if options.Threadgate != nil {
+		s.gates++
+	}
+	s.posts = append(s.posts, p.Text)
+	return "cid", "at://did:plc:test/app.bsky.feed.post/" + options.Rkey, nil
+}
+
+func (s *fakeSender) Like(ctx context.Context, uri string, cid string, opts ...client.RecordOption) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.fail(); err != nil {
+		return "", err
+	}
+	return "at://did:plc:test/app.bsky.feed.like/1", nil
+}
+
+func (s *fakeSender) Follow(ctx context.Context, did string, opts ...client.RecordOption) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.fail()
+}
+
+func TestOutbox(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("sends queued writes in order", func(t *testing.T) {
+		sender := &fakeSender{}
+		box, err := Open(filepath.Join(t.TempDir(), "outbox.json"), sender)
+		assert.NoError(t, err)
+
+		first, err := box.EnqueuePost(appbsky.FeedPost{Text: "first"}, client.WithThreadgate(post.Threadgate{}))
+		assert.NoError(t, err)
+		_, err = box.EnqueuePost(appbsky.FeedPost{Text: "second"})
+		assert.NoError(t, err)
+		_, err = box.EnqueueLike("at://did:plc:a/app.bsky.feed.post/1", "cid")
+		assert.NoError(t, err)
+		_, err = box.EnqueueFollow("did:plc:a")
+		assert.NoError(t, err)
+
+		assert.NoError(t, box.Drain(ctx))
+
+		assert.Equal(t, []string{"first", "second"}, sender.posts)
+		assert.Equal(t, 1, sender.gates)
+		assert.Len(t, box.Items(StatusSent), 4)
+		sent, err := box.Get(first.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, "at://did:plc:test/app.bsky.feed.post/"+first.ID, sent.Uri)
+	})
+
+	t.Run("retries with the same rkey", func(t *testing.T) {
+		sender := &fakeSender{failures: 2}
+		box, err := Open(filepath.Join(t.TempDir(), "outbox.json"), sender, WithBackoff(time.Millisecond, time.Millisecond))
+		assert.NoError(t, err)
+
+		item, err := box.EnqueuePost(appbsky.FeedPost{Text: "flaky"})
+		assert.NoError(t, err)
+
+		for i := 0; i < 3; i++ {
+			assert.NoError(t, box.Drain(ctx))
+			time.Sleep(2 * time.Millisecond)
+		}
+
+		sent, err := box.Get(item.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, StatusSent, sent.Status)
+		assert.Equal(t, 3, sent.Attempts)
+		assert.Equal(t, []string{item.ID, item.ID, item.ID}, sender.rkeys)
+		assert.Equal(t, []string{"flaky"}, sender.posts)
+	})
+
+	t.Run("survives restarts", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "outbox.json")
+		box, err := Open(path, &fakeSender{})
+		assert.NoError(t, err)
+		item, err := box.EnqueuePost(appbsky.FeedPost{
+			Text:  "persisted",
+			Langs: []string{"en"},
+			Embed: &appbsky.FeedPost_Embed{EmbedExternal: &appbsky.EmbedExternal{
+				LexiconTypeID: "app.bsky.embed.external",
+				External:      &appbsky.EmbedExternal_External{Uri: "https://example.com", Title: "Example"},
+			}},
+		})
+		assert.NoError(t, err)
+
+		sender := &fakeSender{}
+		reopened, err := Open(path, sender)
+		assert.NoError(t, err)
+		pending := reopened.Items(StatusPending)
+		assert.Len(t, pending, 1)
+		assert.Equal(t, item.ID, pending[0].ID)
+		assert.Equal(t, item.Post.CreatedAt, pending[0].Post.CreatedAt)
+		assert.Equal(t, "https://example.com", pending[0].Post.Embed.EmbedExternal.External.Uri)
+
+		assert.NoError(t, reopened.Drain(ctx))
+		assert.Equal(t, []string{"persisted"}, sender.posts)
+	})
+
+	t.Run("posts with a TTL expire once sent", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			switch r.URL.Path {
+			case "/xrpc/com.atproto.server.createSession":
+				w.Write([]byte(`{"accessJwt": "a", "refreshJwt": "r", "handle": "test.bsky.social", "did": "did:plc:test"}`))
+			case "/xrpc/com.atproto.repo.putRecord":
+				var input map[string]any
+				json.NewDecoder(r.Body).Decode(&input)
+				w.Write([]byte(`{"uri": "at://did:plc:test/app.bsky.feed.post/` + input["rkey"].(string) + `", "cid": "cid"}`))
+			default:
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+		defer server.Close()
+
+		cfg := config.Default().
+			WithHandle("test.bsky.social").
+			WithAPIKey("test-key").
+			WithServerURL(server.URL).
+			WithExpiryIndexPath(filepath.Join(t.TempDir(), "expiry.json"))
+		bsky, err := client.NewClient(cfg)
+		assert.NoError(t, err)
+		assert.NoError(t, bsky.Connect(ctx))
+
+		path := filepath.Join(t.TempDir(), "outbox.json")
+		box, err := Open(path, bsky)
+		assert.NoError(t, err)
+		item, err := box.EnqueuePost(appbsky.FeedPost{Text: "flash sale"}, client.WithTTL(time.Hour))
+		assert.NoError(t, err)
+
+		reopened, err := Open(path, bsky)
+		assert.NoError(t, err)
+		assert.Equal(t, time.Hour, reopened.Items()[0].TTL)
+		assert.NoError(t, reopened.Drain(ctx))
+
+		expiring := bsky.ExpiringPosts()
+		assert.Len(t, expiring, 1)
+		assert.Equal(t, "at://did:plc:test/app.bsky.feed.post/"+item.ID, expiring[0].Uri)
+		assert.WithinDuration(t, time.Now().Add(time.Hour), expiring[0].ExpiresAt, time.Minute)
+	})
+
+	t.Run("fails permanent errors and replays them", func(t *testing.T) {
+		var failed []Item
+		sender := &fakeSender{failures: 1, err: &xrpc.Error{StatusCode: http.StatusBadRequest}}
+		box, err := Open(filepath.Join(t.TempDir(), "outbox.json"), sender,
+			WithOnFailed(func(item Item) { failed = append(failed, item) }),
+		)
+		assert.NoError(t, err)
+
+		item, err := box.EnqueueFollow("did:plc:a")
+		assert.NoError(t, err)
+		assert.NoError(t, box.Drain(ctx))
+
+		assert.Len(t, failed, 1)
+		assert.Equal(t, StatusFailed, failed[0].Status)
+		assert.Len(t, box.Items(StatusFailed), 1)
+
+		assert.NoError(t, box.Retry(item.ID))
+		assert.NoError(t, box.Drain(ctx))
+		assert.Empty(t, box.Items(StatusFailed))
+		assert.Len(t, box.Items(StatusSent), 1)
+
+		assert.Error(t, box.Retry(item.ID), "only failed items can be retried")
+		assert.ErrorIs(t, box.Retry("missing"), ErrNotFound)
+	})
+
+	t.Run("gives up after max attempts", func(t *testing.T) {
+		sender := &fakeSender{failures: 10}
+		box, err := Open(filepath.Join(t.TempDir(), "outbox.json"), sender,
+			WithMaxAttempts(2), WithBackoff(0, 0),
+		)
+		assert.NoError(t, err)
+
+		_, err = box.EnqueueLike("at://did:plc:a/app.bsky.feed.post/1", "cid")
+		assert.NoError(t, err)
+		assert.NoError(t, box.Drain(ctx))
+
+		failed := box.Items(StatusFailed)
+		assert.Len(t, failed, 1)
+		assert.Equal(t, 2, failed[0].Attempts)
+		assert.Contains(t, failed[0].LastError, "502")
+	})
+
+	t.Run("keeps a limited number of sent items", func(t *testing.T) {
+		box, err := Open(filepath.Join(t.TempDir(), "outbox.json"), &fakeSender{}, WithKeepSent(2))
+		assert.NoError(t, err)
+
+		for i := 0; i < 4; i++ {
+			_, err := box.EnqueueFollow("did:plc:a")
+			assert.NoError(t, err)
+		}
+		assert.NoError(t, box.Drain(ctx))
+		assert.Len(t, box.Items(), 2)
+	})
+
+	t.Run("concurrent drains send each item once", func(t *testing.T) {
+		sender := &fakeSender{hold: make(chan struct{})}
+		box, err := Open(filepath.Join(t.TempDir(), "outbox.json"), sender)
+		assert.NoError(t, err)
+
+		_, err = box.EnqueuePost(appbsky.FeedPost{Text: "once"})
+		assert.NoError(t, err)
+
+		done := make(chan error)
+		go func() { done <- box.Drain(ctx) }()
+		assert.Eventually(t, func() bool {
+			box.mu.Lock()
+			defer box.mu.Unlock()
+			return len(box.inFlight) == 1
+		}, time.Second, time.Millisecond)
+
+		// The item is claimed by the first drain, so this one has nothing to send
+		assert.NoError(t, box.Drain(ctx))
+		_, ok := box.nextAttempt()
+		assert.False(t, ok)
+
+		close(sender.hold)
+		assert.NoError(t, <-done)
+		assert.Equal(t, []string{"once"}, sender.posts)
+		assert.Len(t, box.Items(StatusSent), 1)
+	})
+
+	t.Run("run sends new items until cancelled", func(t *testing.T) {
+		sender := &fakeSender{}
+		box, err := Open(filepath.Join(t.TempDir(), "outbox.json"), sender)
+		assert.NoError(t, err)
+
+		ctx, cancel := context.WithCancel(ctx)
+		done := make(chan error)
+		go func() { done <- box.Run(ctx) }()
+
+		_, err = box.EnqueuePost(appbsky.FeedPost{Text: "live"})
+		assert.NoError(t, err)
+		assert.Eventually(t, func() bool { return len(box.Items(StatusSent)) == 1 }, time.Second, time.Millisecond)
+
+		cancel()
+		assert.True(t, errors.Is(<-done, context.Canceled))
+	})
+}
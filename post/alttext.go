@@ -0,0 +1,189 @@
+package post
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"unicode"
+
+	"github.com/bluesky-social/indigo/api/bsky"
+	"github.com/watzon/lining/utils"
+)
+
+// Default maximum alt text lengths, in graphemes
+const (
+	maxImageAltLength = 2000
+	maxVideoAltLength = 1000
+)
+
+// ErrMissingAltText is returned when an image or video has no alt text but
+// the AltTextPolicy requires it
+var ErrMissingAltText = errors.New("missing alt text")
+
+// ErrAltTextTooLong is returned when alt text exceeds the AltTextPolicy's limit
+var ErrAltTextTooLong = errors.New("alt text too long")
+
+// AltTextPolicy configures how Build checks the alt text of a post's media.
+// The zero value doesn't check anything.
+type AltTextPolicy struct {
+	// Require rejects images and videos without alt text
+	Require bool
+	// MaxLength limits alt text, in graphemes. When zero, images are limited
+	// to 2000 graphemes and videos to 1000.
+	MaxLength int
+	// DraftPlaceholders makes BuildDraft fill in missing alt text for images
+	// read from files with a placeholder derived from the filename. Build never
+	// uses placeholders.
+	DraftPlaceholders bool
+}
+
+// WithAltTextPolicy returns a BuilderOption that sets the alt text policy
+// enforced by Build.
+//
+// Example:
+//
+//	builder := post.NewBuilder(post.WithAltTextPolicy(post.AltTextPolicy{
+//	    Require:   true,
+//	    MaxLength: 1000,
+//	}))
+func WithAltTextPolicy(policy AltTextPolicy) BuilderOption {
+	return func(opts *BuilderOptions) {
+		opts.AltTextPolicy = policy
+	}
+}
+
+// AltTextError reports a problem with the alt text of one piece of media
+type AltTextError struct {
+	// Media is "image" or "video"
+	Media string
+	// Index is the position of the image in the post, starting at 0
+	Index int
+	// Source is the file the media was read from, if known
+	Source string
+	Err    error
+}
+
+func (e *AltTextError) Error() string {
+	if e.Source != "" {
+		return fmt.Sprintf("%s %d (%s): %v", e.Media, e.Index+1, e.Source, e.Err)
+	}
+	return fmt.Sprintf("%s %d: %v", e.Media, e.Index+1, e.Err)
+}
+
+func (e *AltTextError) Unwrap() error {
+	return e.Err
+}
+
+// AltTextErrors is returned by Build when media violates the AltTextPolicy,
+// with one entry per offending image or video
+type AltTextErrors []*AltTextError
+
+func (e AltTextErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return "alt text policy violated: " + strings.Join(msgs, "; ")
+}
+
+func (e AltTextErrors) Unwrap() []error {
+	errs := make([]error, len(e))
+	for i, err := range e {
+		errs[i] = err
+	}
+	return errs
+}
+
+// embedMedia returns the images and video of an embed, including media
+// attached to a quote
+func embedMedia(embed *bsky.FeedPost_Embed) ([]*bsky.EmbedImages_Image, *bsky.EmbedVideo) {
+	if embed == nil {
+		return nil, nil
+	}
+	switch {
+	case embed.EmbedImages != nil:
+		return embed.EmbedImages.Images, nil
+	case embed.EmbedVideo != nil:
+		return nil, embed.EmbedVideo
+	case embed.EmbedRecordWithMedia != nil && embed.EmbedRecordWithMedia.Media != nil:
+		media := embed.EmbedRecordWithMedia.Media
+		if media.EmbedImages != nil {
+			return media.EmbedImages.Images, nil
+		}
+		return nil, media.EmbedVideo
+	}
+	return nil, nil
+}
+
+// checkAltText checks the media of the post against the AltTextPolicy
+func (b *Builder) checkAltText(embed *bsky.FeedPost_Embed) error {
+	policy := b.options.AltTextPolicy
+	if !policy.Require && policy.MaxLength == 0 {
+		return nil
+	}
+	images, video := embedMedia(embed)
+
+	var errs AltTextErrors
+	check := func(media string, index int, alt string, limit int) {
+		if policy.MaxLength > 0 {
+			limit = policy.MaxLength
+		}
+		source := ""
+		if media == "image" && embed != b.sourceEmbed && index < len(b.imagePaths) {
+			source = b.imagePaths[index]
+		}
+		switch {
+		case policy.Require && strings.TrimSpace(alt) == "":
+			errs = append(errs, &AltTextError{Media: media, Index: index, Source: source, Err: ErrMissingAltText})
+		case utils.GraphemeCount(alt) > limit:
+			errs = append(errs, &AltTextError{
+				Media:  media,
+				Index:  index,
+				Source: source,
+				Err:    fmt.Errorf("%w: %d graphemes, limit is %d", ErrAltTextTooLong, utils.GraphemeCount(alt), limit),
+			})
+		}
+	}
+
+	for i, img := range images {
+		check("image", i, img.Alt, maxImageAltLength)
+	}
+	if video != nil {
+		alt := ""
+		if video.Alt != nil {
+			alt = *video.Alt
+		}
+		check("video", 0, alt, maxVideoAltLength)
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// fillAltTextPlaceholders gives images read from files a placeholder alt text
+// derived from the filename, if the policy allows it
+func (b *Builder) fillAltTextPlaceholders(embed *bsky.FeedPost_Embed) {
+	if !b.options.AltTextPolicy.DraftPlaceholders || embed == b.sourceEmbed {
+		return
+	}
+	images, _ := embedMedia(embed)
+	for i, img := range images {
+		if strings.TrimSpace(img.Alt) == "" && i < len(b.imagePaths) && b.imagePaths[i] != "" {
+			img.Alt = PlaceholderAltText(b.imagePaths[i])
+		}
+	}
+}
+
+// PlaceholderAltText derives placeholder alt text from a filename, turning
+// "/photos/IMG_2041-sunset_at-beach.jpg" into "IMG 2041 sunset at beach".
+// It is meant for drafts; placeholders rarely describe an image well.
+func PlaceholderAltText(path string) string {
+	name := filepath.Base(path)
+	name = strings.TrimSuffix(name, filepath.Ext(name))
+	return strings.Join(strings.FieldsFunc(name, func(r rune) bool {
+		return r == '_' || r == '-' || r == '.' || unicode.IsSpace(r)
+	}), " ")
+}
@@ -0,0 +1,107 @@
+package post
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/watzon/lining/models"
+)
+
+func TestAltTextPolicy(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"IMG_2041-sunset_at-beach.jpg", "cat.png"} {
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(name), 0o644))
+	}
+	sunset := filepath.Join(dir, "IMG_2041-sunset_at-beach.jpg")
+	cat := filepath.Join(dir, "cat.png")
+
+	policy := AltTextPolicy{Require: true, MaxLength: 20, DraftPlaceholders: true}
+
+	t.Run("no policy", func(t *testing.T) {
+		_, err := NewBuilder(WithUploader(&fakeUploader{})).
+			AddText("photos").
+			WithImageFromFile("", sunset).
+			Build()
+		assert.NoError(t, err)
+	})
+
+	t.Run("reports missing and long alt text", func(t *testing.T) {
+		_, err := NewBuilder(WithUploader(&fakeUploader{}), WithAltTextPolicy(policy)).
+			AddText("photos").
+			WithImageFromFile("", sunset).
+			WithImageFromFile("A very sleepy cat curled up in a cardboard box", cat).
+			Build()
+
+		var errs AltTextErrors
+		assert.True(t, errors.As(err, &errs))
+		assert.Len(t, errs, 2)
+		assert.Equal(t, "image", errs[0].Media)
+		assert.Equal(t, 0, errs[0].Index)
+		assert.Equal(t, sunset, errs[0].Source)
+		assert.ErrorIs(t, errs[0], ErrMissingAltText)
+		assert.Equal(t, 1, errs[1].Index)
+		assert.ErrorIs(t, errs[1], ErrAltTextTooLong)
+		assert.True(t, strings.Contains(err.Error(), "cat.png"))
+	})
+
+	t.Run("whitespace is not alt text", func(t *testing.T) {
+		uploaded, _ := (&fakeUploader{}).UploadImage(context.Background(), models.Image{Title: "  ", Data: []byte("x")})
+		_, err := NewBuilder(WithAltTextPolicy(AltTextPolicy{Require: true})).
+			WithImages([]models.UploadedImage{*uploaded}).
+			Build()
+		assert.ErrorIs(t, err, ErrMissingAltText)
+	})
+
+	t.Run("default limits", func(t *testing.T) {
+		uploaded, _ := (&fakeUploader{}).UploadImage(context.Background(), models.Image{Title: strings.Repeat("a", 2001), Data: []byte("x")})
+		_, err := NewBuilder(WithAltTextPolicy(AltTextPolicy{Require: true})).
+			WithImages([]models.UploadedImage{*uploaded}).
+			Build()
+		assert.ErrorIs(t, err, ErrAltTextTooLong)
+	})
+
+	t.Run("videos in copied posts", func(t *testing.T) {
+		p := &Post{Text: "clip", Repo: "did:plc:bob", Embed: &Embed{Video: &EmbedVideo{Ref: testBlobCid, MimeType: "video/mp4"}}}
+		builder, err := NewBuilderFromPost(p, WithAltTextPolicy(policy))
+		assert.NoError(t, err)
+
+		_, err = builder.Build()
+		var errs AltTextErrors
+		assert.True(t, errors.As(err, &errs))
+		assert.Equal(t, "video", errs[0].Media)
+		assert.ErrorIs(t, err, ErrMissingAltText)
+	})
+
+	t.Run("drafts get placeholders", func(t *testing.T) {
+		builder := NewBuilder(WithUploader(&fakeUploader{}), WithAltTextPolicy(policy)).
+			AddText("photos").
+			WithImageFromFile("", sunset).
+			WithImageFromFile("A cat", cat)
+
+		draft, err := builder.BuildDraft()
+		assert.NoError(t, err)
+		assert.Equal(t, "IMG 2041 sunset at beach", draft.Embed.EmbedImages.Images[0].Alt)
+		assert.Equal(t, "A cat", draft.Embed.EmbedImages.Images[1].Alt)
+
+		// Placeholders never make it into a published post
+		_, err = builder.Build()
+		assert.ErrorIs(t, err, ErrMissingAltText)
+
+		draft, err = NewBuilder(WithUploader(&fakeUploader{}), WithAltTextPolicy(AltTextPolicy{Require: true})).
+			WithImageFromFile("", sunset).
+			BuildDraft()
+		assert.NoError(t, err)
+		assert.Equal(t, "", draft.Embed.EmbedImages.Images[0].Alt)
+	})
+}
+
+func TestPlaceholderAltText(t *testing.T) {
+	assert.Equal(t, "IMG 2041 sunset at beach", PlaceholderAltText("/photos/IMG_2041-sunset_at-beach.jpg"))
+	assert.Equal(t, "cat", PlaceholderAltText("cat.png"))
+	assert.Equal(t, "my holiday photo", PlaceholderAltText("my holiday.photo.jpeg"))
+}
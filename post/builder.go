@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net/http"
 	"net/url"
 	"regexp"
 	"sort"
@@ -13,14 +14,28 @@ import (
 
 	"github.com/bluesky-social/indigo/api/atproto"
 	"github.com/bluesky-social/indigo/api/bsky"
+	"github.com/bluesky-social/indigo/atproto/syntax"
 	lexutil "github.com/bluesky-social/indigo/lex/util"
 	"github.com/bluesky-social/indigo/xrpc"
 	"github.com/watzon/lining/models"
+	"github.com/watzon/lining/utils"
 )
 
-// Maximum length for a Bluesky post
+// Maximum length for a Bluesky post, in graphemes
 const maxPostLength = 300
 
+// Maximum number of tags in a post's tags field
+const maxTags = 8
+
+// Maximum size for a Bluesky post, in bytes
+const maxPostBytes = 3000
+
+// Maximum length and size of a chat message, in graphemes and bytes
+const (
+	maxMessageLength = 1000
+	maxMessageBytes  = 10000
+)
+
 // ErrEmptyText is returned when attempting to add empty text
 var ErrEmptyText = errors.New("text cannot be empty")
 
@@ -30,6 +45,10 @@ var ErrInvalidURL = errors.New("invalid URL")
 // ErrInvalidMention is returned when a mention is not valid
 var ErrInvalidMention = errors.New("invalid mention format")
 
+// ErrUnresolvedMention is returned when a mentioned handle cannot be resolved to a DID
+// and the builder is configured with MentionError
+var ErrUnresolvedMention = errors.New("unable to resolve mention")
+
 // ErrInvalidTag is returned when a tag is not valid
 var ErrInvalidTag = errors.New("invalid tag format")
 
@@ -39,6 +58,9 @@ var ErrMismatchedImages = errors.New("images and blobs arrays must have the same
 // ErrPostTooLong is returned when the post exceeds the maximum length
 var ErrPostTooLong = errors.New("post exceeds maximum length")
 
+// ErrPostTooLarge is returned when the post exceeds the maximum size in bytes
+var ErrPostTooLarge = errors.New("post exceeds maximum size")
+
 // JoinStrategy determines how text segments are joined together in the final post
 type JoinStrategy int
 
@@ -49,22 +71,57 @@ const (
 	JoinWithSpaces
 )
 
+// UnresolvedMentionPolicy determines what happens when a mentioned handle
+// cannot be resolved to a DID
+type UnresolvedMentionPolicy int
+
+const (
+	// MentionAsText keeps the mention in the post as plain text, without a facet
+	MentionAsText UnresolvedMentionPolicy = iota
+	// MentionError fails the build with ErrUnresolvedMention
+	MentionError
+)
+
+// MentionResolver resolves handles to DIDs for mention facets. The
+// client.BskyClient type satisfies this interface, backed by its identity cache.
+type MentionResolver interface {
+	GetDIDForHandle(ctx context.Context, handle string) (string, error)
+}
+
 // BuilderOptions configures the behavior of the post Builder
 type BuilderOptions struct {
 	// JoinStrategy determines how text segments are joined together
 	JoinStrategy JoinStrategy
-	// MaxLength sets a custom maximum length for posts (must be <= 300)
+	// MaxLength sets a custom maximum length for posts in graphemes (must be
+	// <= 300, unless raised to the chat message limit by WithMessageLimits)
 	MaxLength int
+	// MaxBytes is the maximum size of the text in bytes
+	MaxBytes int
 	// AutoHashtag automatically converts words starting with # into hashtag facets
 	AutoHashtag bool
 	// AutoMention automatically converts words starting with @ into mention facets
 	AutoMention bool
 	// AutoLink automatically converts URLs in text into link facets
 	AutoLink bool
-	// DefaultLanguage sets the default language for the post
+	// DefaultLanguage sets the language used when none are set on the builder
+	// and none are detected. An empty string leaves the post's languages unset.
 	DefaultLanguage string
+	// LanguageDetector detects the post's languages from its text
+	LanguageDetector LanguageDetector
 	// Client is the xrpc client used for fetching posts
 	Client *xrpc.Client
+	// Resolver is used to resolve mentioned handles to DIDs
+	Resolver MentionResolver
+	// UnresolvedMentions determines how mentions that cannot be resolved are handled
+	UnresolvedMentions UnresolvedMentionPolicy
+	// LabelPolicies are checked by Build to enforce self-labels on media
+	LabelPolicies []LabelPolicy
+	// Uploader uploads images added from files and link card thumbnails
+	Uploader ImageUploader
+	// HTTPClient is used to fetch link cards
+	HTTPClient *http.Client
+	// AltTextPolicy is checked by Build against the post's images and videos
+	AltTextPolicy AltTextPolicy
 }
 
 // BuilderOption is a function that configures a BuilderOptions struct
@@ -87,6 +144,17 @@ func WithMaxLength(length int) BuilderOption {
 	}
 }
 
+// WithMessageLimits returns a BuilderOption that raises the length limits to
+// those of a chat message, 1000 graphemes and 10000 bytes, for building
+// messages with chat.MessageFromPost. Text this long can't be published as a
+// post.
+func WithMessageLimits() BuilderOption {
+	return func(opts *BuilderOptions) {
+		opts.MaxLength = maxMessageLength
+		opts.MaxBytes = maxMessageBytes
+	}
+}
+
 // WithAutoHashtag returns a BuilderOption that enables auto-hashtag
 func WithAutoHashtag(enabled bool) BuilderOption {
 	return func(opts *BuilderOptions) {
@@ -108,7 +176,11 @@ func WithAutoLink(enabled bool) BuilderOption {
 	}
 }
 
-// WithDefaultLanguage returns a BuilderOption that sets the default language
+// WithDefaultLanguage returns a BuilderOption that sets the default language.
+// It is used whenever no languages are set on the builder and the
+// LanguageDetector finds none, so posts in other languages are tagged with it
+// unless it is set to "" or the languages are set explicitly. It defaults to
+// "en".
 func WithDefaultLanguage(lang string) BuilderOption {
 	return func(opts *BuilderOptions) {
 		opts.DefaultLanguage = lang
@@ -122,15 +194,31 @@ func WithClient(client *xrpc.Client) BuilderOption {
 	}
 }
 
+// WithResolver returns a BuilderOption that sets the mention resolver
+func WithResolver(resolver MentionResolver) BuilderOption {
+	return func(opts *BuilderOptions) {
+		opts.Resolver = resolver
+	}
+}
+
+// WithUnresolvedMentions returns a BuilderOption that sets how unresolvable mentions are handled
+func WithUnresolvedMentions(policy UnresolvedMentionPolicy) BuilderOption {
+	return func(opts *BuilderOptions) {
+		opts.UnresolvedMentions = policy
+	}
+}
+
 // DefaultOptions returns the default BuilderOptions
 func DefaultOptions() BuilderOptions {
 	return BuilderOptions{
-		JoinStrategy:    JoinAsIs,
-		MaxLength:       maxPostLength,
-		AutoHashtag:     false,
-		AutoMention:     false,
-		AutoLink:        false,
-		DefaultLanguage: "en",
+		JoinStrategy:       JoinAsIs,
+		MaxLength:          maxPostLength,
+		MaxBytes:           maxPostBytes,
+		AutoHashtag:        false,
+		AutoMention:        false,
+		AutoLink:           false,
+		DefaultLanguage:    "en",
+		UnresolvedMentions: MentionAsText,
 	}
 }
 
@@ -153,8 +241,18 @@ type Builder struct {
 	segments []segment
 	embed    models.Embed
 	reply    *bsky.FeedPost_ReplyRef
-	err      error
-	options  BuilderOptions
+	labels   []string
+	langs    []string
+	tags     []string
+	pending  pending
+	// sourceEmbed is the embed of a post copied with NewBuilderFromPost, used
+	// when no other embed is added
+	sourceEmbed *bsky.FeedPost_Embed
+	sourceRepo  string
+	// imagePaths holds the file each embedded image was read from, if known
+	imagePaths []string
+	err        error
+	options    BuilderOptions
 }
 
 // segment represents a piece of text with an optional facet.
@@ -162,6 +260,11 @@ type Builder struct {
 type segment struct {
 	text  string
 	facet *models.Facet
+	// attached segments are never separated from the previous segment by the
+	// join strategy
+	attached bool
+	// handle is set for mentions whose DID has yet to be resolved
+	handle string
 }
 
 // NewBuilder creates a new post builder with the specified options
@@ -184,7 +287,9 @@ var (
 	mentionRegex = regexp.MustCompile(`@[\w-]+[^\s#@]*`)
 )
 
-// validateMention validates a mention username
+// validateMention validates a mention username. Full handles such as
+// "alice.bsky.social" are validated against the atproto handle syntax, while
+// bare names without a dot are accepted for use with an explicit DID.
 func validateMention(username string) error {
 	if username == "" {
 		return ErrInvalidMention
@@ -193,6 +298,12 @@ func validateMention(username string) error {
 	if strings.ContainsAny(username, " \t\n@") {
 		return ErrInvalidMention
 	}
+	if strings.Contains(username, ".") {
+		if _, err := syntax.ParseHandle(username); err != nil {
+			return ErrInvalidMention
+		}
+		return nil
+	}
 	// Check for valid format (letters, numbers, _, -)
 	for _, r := range username {
 		if !unicode.IsLetter(r) && !unicode.IsNumber(r) && r != '_' && r != '-' {
@@ -206,6 +317,21 @@ func validateMention(username string) error {
 	return nil
 }
 
+// resolveMention resolves a handle to a DID using the configured resolver
+func (b *Builder) resolveMention(ctx context.Context, handle string) (string, error) {
+	if b.options.Resolver == nil {
+		return "", fmt.Errorf("%w: no resolver configured for @%s", ErrUnresolvedMention, handle)
+	}
+	did, err := b.options.Resolver.GetDIDForHandle(ctx, handle)
+	if err != nil {
+		return "", fmt.Errorf("%w: @%s: %v", ErrUnresolvedMention, handle, err)
+	}
+	if did == "" {
+		return "", fmt.Errorf("%w: @%s", ErrUnresolvedMention, handle)
+	}
+	return did, nil
+}
+
 // validateTag validates a hashtag
 func validateTag(tag string) error {
 	if tag == "" {
@@ -298,27 +424,35 @@ func (b *Builder) processText(text string) *Builder {
 
 	if b.options.AutoMention {
 		for _, m := range mentionRegex.FindAllStringIndex(text, -1) {
+			// Skip matches in the middle of a word, such as email addresses
+			if m[0] > 0 {
+				prev := rune(text[m[0]-1])
+				if unicode.IsLetter(prev) || unicode.IsNumber(prev) {
+					continue
+				}
+			}
 			fullMatch := text[m[0]:m[1]]
 			username := strings.TrimPrefix(fullMatch, "@")
 			// Find where the actual username ends (before any punctuation)
 			usernameEnd := 0
 			for i, r := range username {
-				if !unicode.IsLetter(r) && !unicode.IsNumber(r) && r != '_' && r != '-' {
+				if !unicode.IsLetter(r) && !unicode.IsNumber(r) && r != '_' && r != '-' && r != '.' {
 					usernameEnd = i
 					break
 				}
 				usernameEnd = i + 1
 			}
-			username = username[:usernameEnd]
+			// Trailing dots end the sentence rather than the handle
+			username = strings.TrimRight(username[:usernameEnd], ".")
 			matches = append(matches, match{
 				start: m[0],
 				end:   m[0] + len(username) + 1, // +1 for the @ prefix
 				process: func(text string) bool {
-					if err := validateMention(username); err == nil {
-						b.AddMention(username, "did:plc:"+username)
-						return true
+					if err := validateMention(username); err != nil {
+						return false
 					}
-					return false
+					b.AddMention(username, "")
+					return true
 				},
 			})
 		}
@@ -344,6 +478,9 @@ func (b *Builder) processText(text string) *Builder {
 		// Process the match
 		matchText := text[m.start:m.end]
 		if !m.process(matchText) {
+			if b.err != nil {
+				return b
+			}
 			// If processing failed, treat it as regular text
 			if err := b.validatePostLength(matchText); err != nil {
 				b.err = err
@@ -367,12 +504,24 @@ func (b *Builder) processText(text string) *Builder {
 	return b
 }
 
+// validatePostLength checks that the post, with additionalText appended, stays
+// within both the grapheme and byte limits
 func (b *Builder) validatePostLength(additionalText string) error {
-	totalLength := len(additionalText)
+	var text strings.Builder
 	for _, seg := range b.segments {
-		totalLength += len(seg.text)
+		text.WriteString(seg.text)
 	}
-	if totalLength > b.options.MaxLength {
+	text.WriteString(additionalText)
+	return b.checkLength(text.String())
+}
+
+// checkLength checks text against the configured maximum length in graphemes
+// and the maximum size in bytes
+func (b *Builder) checkLength(text string) error {
+	if len(text) > b.options.MaxBytes {
+		return ErrPostTooLarge
+	}
+	if utils.GraphemeCount(text) > b.options.MaxLength {
 		return ErrPostTooLong
 	}
 	return nil
@@ -408,12 +557,17 @@ func (b *Builder) AddFacet(text string, ftype models.FacetType, value string) *B
 }
 
 // AddMention adds a mention facet (@username) to the post.
-// The username should be provided without the @ prefix, as it will be added automatically.
-// The did parameter should be the Bluesky DID for the mentioned user.
+// The username should be provided without the @ prefix, as it will be added automatically,
+// and may be a full handle such as "alice.bsky.social".
+// The did parameter should be the Bluesky DID for the mentioned user. If it is empty,
+// the handle is resolved using the builder's MentionResolver when the post is
+// resolved; handles that cannot be resolved are left as plain text or cause an
+// error, depending on the UnresolvedMentions option.
 //
 // Example:
 //
 //	builder.AddMention("alice", "did:plc:alice")  // Adds "@alice" to the post
+//	builder.AddMention("alice.bsky.social", "")   // Resolves the DID for "@alice.bsky.social"
 func (b *Builder) AddMention(username string, did string) *Builder {
 	if b.err != nil {
 		return b
@@ -422,6 +576,11 @@ func (b *Builder) AddMention(username string, did string) *Builder {
 		b.err = err
 		return b
 	}
+	if did == "" {
+		// Resolved later by Resolve
+		b.segments = append(b.segments, segment{text: "@" + username, handle: username})
+		return b
+	}
 	return b.AddFacet("@"+username, models.FacetMention, did)
 }
 
@@ -451,10 +610,6 @@ func (b *Builder) AddTag(tag string) *Builder {
 
 	// Strip leading # for validation
 	tagWithoutHash := strings.TrimLeft(tag, "#")
-	if err := validateTag(tagWithoutHash); err != nil {
-		b.err = err
-		return b
-	}
 
 	// Build display text based on input format
 	displayText := tag
@@ -462,7 +617,51 @@ func (b *Builder) AddTag(tag string) *Builder {
 		displayText = "#" + tagWithoutHash
 	}
 
-	return b.AddFacet(displayText, models.FacetTag, tagWithoutHash)
+	return b.addTag(displayText, tagWithoutHash)
+}
+
+// addTag adds a tag facet whose text may differ from the tag, such as a
+// Markdown link to a hashtag page
+func (b *Builder) addTag(text, tag string) *Builder {
+	if err := validateTag(tag); err != nil {
+		b.err = err
+		return b
+	}
+	return b.AddFacet(text, models.FacetTag, tag)
+}
+
+// WithTags adds hashtags to the post that don't appear in its text. They
+// are stored in the record's tags field and can be given with or without the
+// # prefix. Up to eight tags can be set; duplicates are ignored.
+//
+// Example:
+//
+//	builder.WithTags("golang", "bluesky")
+func (b *Builder) WithTags(tags ...string) *Builder {
+	if b.err != nil {
+		return b
+	}
+	for _, tag := range tags {
+		tag = strings.TrimLeft(tag, "#")
+		if err := validateTag(tag); err != nil {
+			b.err = err
+			return b
+		}
+		duplicate := false
+		for _, existing := range b.tags {
+			if existing == tag {
+				duplicate = true
+				break
+			}
+		}
+		if !duplicate {
+			b.tags = append(b.tags, tag)
+		}
+	}
+	if len(b.tags) > maxTags {
+		b.err = fmt.Errorf("%w: a post can have at most %d tags", ErrInvalidTag, maxTags)
+	}
+	return b
 }
 
 // AddLink adds a link facet with custom display text to the post.
@@ -524,6 +723,7 @@ func (b *Builder) AddNewLine() *Builder {
 // facets in the text.
 func (b *Builder) WithExternalLink(link models.Link) *Builder {
 	b.embed.Link = link
+	b.pending.cardUrl = ""
 	return b
 }
 
@@ -545,6 +745,7 @@ func (b *Builder) WithImages(images []models.UploadedImage) *Builder {
 	}
 	b.embed.Images = imgs
 	b.embed.UploadedImages = blobs
+	b.imagePaths = make([]string, len(images))
 	return b
 }
 
@@ -571,12 +772,15 @@ func (b *Builder) WithReply(reply *bsky.FeedPost_ReplyRef) *Builder {
 	}
 
 	b.reply = reply
+	b.pending.replyUri = ""
 	return b
 }
 
 // WithReplyToUri sets the post as a reply to another post using the provided URI.
 // The URI should be in the format "at://did:plc:xxx/app.bsky.feed.post/xxx".
-// This method will extract the necessary information from the URI to build the ReplyRef.
+// The parent record is fetched by Resolve to obtain its CID, and if the parent
+// is itself a reply, its root reference is reused so the new post stays in the
+// same thread.
 func (b *Builder) WithReplyToUri(uri string) *Builder {
 	if b.err != nil {
 		return b
@@ -588,7 +792,7 @@ func (b *Builder) WithReplyToUri(uri string) *Builder {
 	}
 
 	// Use our existing ParsePostURI function to validate and parse the URI
-	repo, collection, rkey, err := ParsePostURI(uri)
+	_, collection, _, err := ParsePostURI(uri)
 	if err != nil {
 		b.err = fmt.Errorf("invalid reply URI: %w", err)
 		return b
@@ -600,44 +804,97 @@ func (b *Builder) WithReplyToUri(uri string) *Builder {
 		return b
 	}
 
-	// Fetch the post to get its CID
-	ctx := context.Background()
-	resp, err := atproto.RepoGetRecord(ctx, b.options.Client, "", collection, repo, rkey)
-	if err != nil {
-		b.err = fmt.Errorf("failed to fetch reply post: %w", err)
+	if b.options.Client == nil {
+		b.err = errors.New("a client is required to resolve reply URIs")
+		return b
+	}
+
+	b.reply = nil
+	b.pending.replyUri = uri
+	return b
+}
+
+// WithReplyToPost sets the post as a reply to the given post. Unlike
+// WithReplyToUri, no network request is made, since the post already carries
+// its CID and, if it is itself a reply, the root of its thread.
+func (b *Builder) WithReplyToPost(p *Post) *Builder {
+	if b.err != nil {
+		return b
+	}
+
+	if p == nil {
+		b.err = errors.New("reply post cannot be nil")
+		return b
+	}
+
+	if p.Repo == "" || p.Rkey == "" || p.Cid == "" {
+		b.err = errors.New("reply post must have a repo, rkey and CID")
 		return b
 	}
 
-	// Create the ReplyRef with the parent reference
-	// For now, we'll set both parent and root to the same post
-	// In the future, we might want to fetch the actual root if this is a reply to a reply
-	ref := &atproto.RepoStrongRef{
-		Cid: *resp.Cid,
-		Uri: uri,
+	parent := &atproto.RepoStrongRef{
+		Cid: p.Cid,
+		Uri: p.Uri(),
+	}
+
+	root := parent
+	if p.ReplyRef != nil && p.ReplyRef.Root != nil {
+		root = p.ReplyRef.Root
 	}
 
 	b.reply = &bsky.FeedPost_ReplyRef{
-		Parent: ref,
-		Root:   ref,
+		Parent: parent,
+		Root:   root,
 	}
+	b.pending.replyUri = ""
 
 	return b
 }
 
 // Build creates the final Bluesky post, combining all the added text,
-// facets, and embeds into a complete post structure.
+// facets, and embeds into a complete post structure. If the post still needs
+// to be resolved, Build calls Resolve without a deadline first; use
+// BuildContext, or call Resolve before Build, to bound that work.
 func (b *Builder) Build() (bsky.FeedPost, error) {
+	return b.build(context.Background(), false)
+}
+
+// BuildContext works like Build, but resolves the post with ctx if it still
+// needs to be resolved.
+//
+// Example:
+//
+//	p, err := builder.BuildContext(ctx)
+func (b *Builder) BuildContext(ctx context.Context) (bsky.FeedPost, error) {
+	return b.build(ctx, false)
+}
+
+// BuildDraft works like Build, but doesn't enforce the AltTextPolicy, so that
+// unfinished posts can be previewed or saved. If the policy enables
+// DraftPlaceholders, images read from files that lack alt text get a
+// placeholder derived from their filename.
+func (b *Builder) BuildDraft() (bsky.FeedPost, error) {
+	return b.build(context.Background(), true)
+}
+
+func (b *Builder) build(ctx context.Context, draft bool) (bsky.FeedPost, error) {
 	if b.err != nil {
 		return bsky.FeedPost{}, b.err
 	}
 
+	if b.needsResolve() {
+		if err := b.Resolve(ctx); err != nil {
+			return bsky.FeedPost{}, err
+		}
+	}
+
 	var text strings.Builder
 	var facets []*bsky.RichtextFacet
 	byteIndex := 0
 
 	for i, seg := range b.segments {
 		// Handle joining strategy
-		if i > 0 && b.options.JoinStrategy == JoinWithSpaces {
+		if i > 0 && b.options.JoinStrategy == JoinWithSpaces && !seg.attached {
 			prevText := b.segments[i-1].text
 			if b.shouldAddSpace(prevText, seg.text) {
 				text.WriteString(" ")
@@ -684,12 +941,24 @@ func (b *Builder) Build() (bsky.FeedPost, error) {
 		byteIndex += len(seg.text)
 	}
 
+	if err := b.checkLength(text.String()); err != nil {
+		return bsky.FeedPost{}, err
+	}
+
+	langs, err := b.languages()
+	if err != nil {
+		return bsky.FeedPost{}, err
+	}
+
 	post := bsky.FeedPost{
 		Text:          text.String(),
 		Facets:        facets,
 		LexiconTypeID: "app.bsky.feed.post",
 		CreatedAt:     time.Now().Format(time.RFC3339),
 		Reply:         b.reply,
+		Labels:        b.selfLabels(),
+		Langs:         langs,
+		Tags:          b.tags,
 	}
 
 	// Handle embeds
@@ -709,17 +978,32 @@ func (b *Builder) Build() (bsky.FeedPost, error) {
 			},
 		}
 	} else if b.embed.Link.Uri.String() != "" {
+		external := &bsky.EmbedExternal_External{
+			Uri:         b.embed.Link.Uri.String(),
+			Title:       b.embed.Link.Title,
+			Description: b.embed.Link.Description,
+		}
+		if b.embed.Link.Thumb.Ref.Defined() {
+			external.Thumb = &b.embed.Link.Thumb
+		}
 		post.Embed = &bsky.FeedPost_Embed{
 			EmbedExternal: &bsky.EmbedExternal{
 				LexiconTypeID: "app.bsky.embed.external",
-				External: &bsky.EmbedExternal_External{
-					Uri:         b.embed.Link.Uri.String(),
-					Title:       b.embed.Link.Title,
-					Description: b.embed.Link.Description,
-					Thumb:       &b.embed.Link.Thumb,
-				},
+				External:      external,
 			},
 		}
+	} else if b.sourceEmbed != nil {
+		post.Embed = b.sourceEmbed
+	}
+
+	if err := b.checkLabelPolicies(post.Embed); err != nil {
+		return bsky.FeedPost{}, err
+	}
+
+	if draft {
+		b.fillAltTextPlaceholders(post.Embed)
+	} else if err := b.checkAltText(post.Embed); err != nil {
+		return bsky.FeedPost{}, err
 	}
 
 	return post, nil
@@ -1,8 +1,16 @@
 package post
 
 import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 
+	"github.com/bluesky-social/indigo/api/atproto"
+	"github.com/bluesky-social/indigo/api/bsky"
+	"github.com/bluesky-social/indigo/xrpc"
 	"github.com/stretchr/testify/assert"
 	"github.com/watzon/lining/models"
 )
@@ -413,6 +421,63 @@ func TestBuilderOptions(t *testing.T) {
 	})
 }
 
+// mapResolver is a MentionResolver backed by a static map of handles to DIDs
+type mapResolver map[string]string
+
+func (r mapResolver) GetDIDForHandle(ctx context.Context, handle string) (string, error) {
+	did, ok := r[handle]
+	if !ok {
+		return "", errors.New("handle not found")
+	}
+	return did, nil
+}
+
+var testResolver = mapResolver{
+	"alice":             "did:plc:alice",
+	"bob":               "did:plc:bob",
+	"carol.bsky.social": "did:plc:carol",
+}
+
+func TestBuilderMentionResolution(t *testing.T) {
+	t.Run("resolves handles passed to AddMention", func(t *testing.T) {
+		post, err := NewBuilder(WithResolver(testResolver)).
+			AddText("cc ").
+			AddMention("carol.bsky.social", "").
+			Build()
+
+		assert.NoError(t, err)
+		assert.Equal(t, "cc @carol.bsky.social", post.Text)
+		assert.Len(t, post.Facets, 1)
+		assert.Equal(t, "did:plc:carol", post.Facets[0].Features[0].RichtextFacet_Mention.Did)
+	})
+
+	t.Run("keeps unresolved mentions as text", func(t *testing.T) {
+		post, err := NewBuilder(WithResolver(testResolver)).
+			AddMention("nobody.bsky.social", "").
+			Build()
+
+		assert.NoError(t, err)
+		assert.Equal(t, "@nobody.bsky.social", post.Text)
+		assert.Empty(t, post.Facets)
+	})
+
+	t.Run("errors on unresolved mentions", func(t *testing.T) {
+		_, err := NewBuilder(WithResolver(testResolver), WithUnresolvedMentions(MentionError)).
+			AddMention("nobody.bsky.social", "").
+			Build()
+
+		assert.ErrorIs(t, err, ErrUnresolvedMention)
+	})
+
+	t.Run("rejects invalid handles", func(t *testing.T) {
+		_, err := NewBuilder(WithResolver(testResolver)).
+			AddMention("bad..handle", "").
+			Build()
+
+		assert.ErrorIs(t, err, ErrInvalidMention)
+	})
+}
+
 func TestBuilderAutoDetection(t *testing.T) {
 	t.Run("auto hashtags", func(t *testing.T) {
 		post, err := NewBuilder(WithAutoHashtag(true)).
@@ -432,7 +497,7 @@ func TestBuilderAutoDetection(t *testing.T) {
 	})
 
 	t.Run("auto mentions", func(t *testing.T) {
-		post, err := NewBuilder(WithAutoMention(true)).
+		post, err := NewBuilder(WithAutoMention(true), WithResolver(testResolver)).
 			AddText("Hello @alice and @bob!").
 			Build()
 
@@ -448,6 +513,50 @@ func TestBuilderAutoDetection(t *testing.T) {
 		}
 	})
 
+	t.Run("auto mentions with full handles", func(t *testing.T) {
+		post, err := NewBuilder(WithAutoMention(true), WithResolver(testResolver)).
+			AddText("Thanks @carol.bsky.social. Mail me at me@example.com").
+			Build()
+
+		assert.NoError(t, err)
+		assert.Equal(t, "Thanks @carol.bsky.social. Mail me at me@example.com", post.Text)
+		assert.Len(t, post.Facets, 1)
+
+		facet := post.Facets[0]
+		assert.Equal(t, int64(7), facet.Index.ByteStart)
+		assert.Equal(t, int64(25), facet.Index.ByteEnd)
+		assert.Equal(t, "did:plc:carol", facet.Features[0].RichtextFacet_Mention.Did)
+	})
+
+	t.Run("auto mentions without a resolver", func(t *testing.T) {
+		post, err := NewBuilder(WithAutoMention(true)).
+			AddText("Hello @alice!").
+			Build()
+
+		assert.NoError(t, err)
+		assert.Equal(t, "Hello @alice!", post.Text)
+		assert.Empty(t, post.Facets)
+	})
+
+	t.Run("unresolvable auto mentions", func(t *testing.T) {
+		post, err := NewBuilder(WithAutoMention(true), WithResolver(testResolver)).
+			AddText("Hello @nobody.bsky.social!").
+			Build()
+
+		assert.NoError(t, err)
+		assert.Equal(t, "Hello @nobody.bsky.social!", post.Text)
+		assert.Empty(t, post.Facets)
+
+		_, err = NewBuilder(
+			WithAutoMention(true),
+			WithResolver(testResolver),
+			WithUnresolvedMentions(MentionError),
+		).AddText("Hello @nobody.bsky.social!").
+			Build()
+
+		assert.ErrorIs(t, err, ErrUnresolvedMention)
+	})
+
 	t.Run("auto links", func(t *testing.T) {
 		post, err := NewBuilder(WithAutoLink(true)).
 			AddText("Check https://example.com and https://test.com").
@@ -470,6 +579,7 @@ func TestBuilderAutoDetection(t *testing.T) {
 			WithAutoHashtag(true),
 			WithAutoMention(true),
 			WithAutoLink(true),
+			WithResolver(testResolver),
 		).AddText("Hi @alice! Check #golang at https://golang.org #programming").
 			Build()
 
@@ -520,6 +630,46 @@ func TestBuilderMaxLength(t *testing.T) {
 		assert.ErrorIs(t, err, ErrPostTooLong)
 	})
 
+	t.Run("counts graphemes rather than bytes", func(t *testing.T) {
+		text := strings.Repeat("👍🏽", maxPostLength)
+		post, err := NewBuilder().AddText(text).Build()
+		assert.NoError(t, err)
+		assert.Equal(t, text, post.Text)
+
+		_, err = NewBuilder().AddText(text + "!").Build()
+		assert.ErrorIs(t, err, ErrPostTooLong)
+	})
+
+	t.Run("enforces the byte limit", func(t *testing.T) {
+		// Each family emoji is a single grapheme but 25 bytes
+		text := strings.Repeat("👩‍👩‍👧‍👦", 150)
+		_, err := NewBuilder().AddText(text).Build()
+		assert.ErrorIs(t, err, ErrPostTooLarge)
+	})
+
+	t.Run("includes facets and join spaces", func(t *testing.T) {
+		_, err := NewBuilder(WithMaxLength(10), WithJoinStrategy(JoinWithSpaces)).
+			AddText("hello").
+			AddLink("world", "https://example.com").
+			Build()
+		assert.ErrorIs(t, err, ErrPostTooLong)
+	})
+
+	t.Run("message limits", func(t *testing.T) {
+		text := strings.Repeat("👩‍👩‍👧‍👦", 400)
+		_, err := NewBuilder().AddText(text).Build()
+		assert.Error(t, err)
+
+		post, err := NewBuilder(WithMessageLimits()).AddText(text).Build()
+		assert.NoError(t, err)
+		assert.Equal(t, text, post.Text)
+
+		_, err = NewBuilder(WithMessageLimits()).AddText(strings.Repeat("a", maxMessageLength+1)).Build()
+		assert.ErrorIs(t, err, ErrPostTooLong)
+		_, err = NewBuilder(WithMessageLimits()).AddText(strings.Repeat("👩‍👩‍👧‍👦", maxMessageLength)).Build()
+		assert.ErrorIs(t, err, ErrPostTooLarge)
+	})
+
 	t.Run("invalid max length", func(t *testing.T) {
 		assert.Panics(t, func() {
 			NewBuilder(WithMaxLength(0))
@@ -532,3 +682,121 @@ func TestBuilderMaxLength(t *testing.T) {
 		})
 	})
 }
+
+func TestBuilderReplies(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/xrpc/com.atproto.repo.getRecord" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Query().Get("rkey") {
+		case "top":
+			w.Write([]byte(`{
+				"uri": "at://did:plc:alice/app.bsky.feed.post/top",
+				"cid": "cid-top",
+				"value": {
+					"$type": "app.bsky.feed.post",
+					"text": "top level",
+					"createdAt": "2024-01-01T00:00:00Z"
+				}
+			}`))
+		case "nested":
+			w.Write([]byte(`{
+				"uri": "at://did:plc:bob/app.bsky.feed.post/nested",
+				"cid": "cid-nested",
+				"value": {
+					"$type": "app.bsky.feed.post",
+					"text": "a reply",
+					"createdAt": "2024-01-01T00:00:00Z",
+					"reply": {
+						"root": {"uri": "at://did:plc:alice/app.bsky.feed.post/top", "cid": "cid-top"},
+						"parent": {"uri": "at://did:plc:alice/app.bsky.feed.post/top", "cid": "cid-top"}
+					}
+				}
+			}`))
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error": "RecordNotFound", "message": "Could not locate record"}`))
+		}
+	}))
+	defer server.Close()
+
+	client := &xrpc.Client{Client: server.Client(), Host: server.URL}
+	ctx := context.Background()
+
+	t.Run("reply to top-level post", func(t *testing.T) {
+		post, err := NewBuilder(WithClient(client)).
+			AddText("hi").
+			WithReplyToUri("at://did:plc:alice/app.bsky.feed.post/top").
+			Build()
+
+		assert.NoError(t, err)
+		assert.NotNil(t, post.Reply)
+		assert.Equal(t, "at://did:plc:alice/app.bsky.feed.post/top", post.Reply.Parent.Uri)
+		assert.Equal(t, "cid-top", post.Reply.Parent.Cid)
+		assert.Equal(t, post.Reply.Parent, post.Reply.Root)
+	})
+
+	t.Run("reply to a reply keeps the thread root", func(t *testing.T) {
+		post, err := NewBuilder(WithClient(client)).
+			AddText("hi").
+			WithReplyToUri("at://did:plc:bob/app.bsky.feed.post/nested").
+			Build()
+
+		assert.NoError(t, err)
+		assert.NotNil(t, post.Reply)
+		assert.Equal(t, "at://did:plc:bob/app.bsky.feed.post/nested", post.Reply.Parent.Uri)
+		assert.Equal(t, "cid-nested", post.Reply.Parent.Cid)
+		assert.Equal(t, "at://did:plc:alice/app.bsky.feed.post/top", post.Reply.Root.Uri)
+		assert.Equal(t, "cid-top", post.Reply.Root.Cid)
+	})
+
+	t.Run("missing parent", func(t *testing.T) {
+		err := NewBuilder(WithClient(client)).
+			AddText("hi").
+			WithReplyToUri("at://did:plc:bob/app.bsky.feed.post/missing").
+			Resolve(ctx)
+
+		var resolveErr *ResolveError
+		assert.ErrorAs(t, err, &resolveErr)
+		assert.Equal(t, ResolveReply, resolveErr.Op)
+		assert.Equal(t, "at://did:plc:bob/app.bsky.feed.post/missing", resolveErr.Target)
+	})
+
+	t.Run("without a client", func(t *testing.T) {
+		_, err := NewBuilder().
+			WithReplyToUri("at://did:plc:alice/app.bsky.feed.post/top").
+			Build()
+
+		assert.Error(t, err)
+	})
+
+	t.Run("reply to post value", func(t *testing.T) {
+		root := &atproto.RepoStrongRef{Uri: "at://did:plc:alice/app.bsky.feed.post/top", Cid: "cid-top"}
+		parent := &Post{
+			Repo:     "did:plc:bob",
+			Rkey:     "nested",
+			Cid:      "cid-nested",
+			ReplyRef: &bsky.FeedPost_ReplyRef{Root: root, Parent: root},
+		}
+
+		post, err := NewBuilder().
+			AddText("hi").
+			WithReplyToPost(parent).
+			Build()
+
+		assert.NoError(t, err)
+		assert.Equal(t, "at://did:plc:bob/app.bsky.feed.post/nested", post.Reply.Parent.Uri)
+		assert.Equal(t, "cid-nested", post.Reply.Parent.Cid)
+		assert.Equal(t, root, post.Reply.Root)
+	})
+
+	t.Run("reply to incomplete post value", func(t *testing.T) {
+		_, err := NewBuilder().
+			WithReplyToPost(&Post{Repo: "did:plc:bob"}).
+			Build()
+
+		assert.Error(t, err)
+	})
+}
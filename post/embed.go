@@ -20,8 +20,11 @@ type EmbedImage struct {
 }
 
 type EmbedVideoCaption struct {
-	Lang string
-	Text string
+	Lang     string
+	Text     string
+	Ref      string // Caption file (WebVTT) blob
+	MimeType string
+	Size     int64
 }
 
 type EmbedVideo struct {
@@ -34,10 +37,12 @@ type EmbedVideo struct {
 }
 
 type EmbedExternal struct {
-	Description string
-	Uri         string
-	ThumbRef    string
-	Title       string
+	Description   string
+	Uri           string
+	ThumbRef      string
+	ThumbMimeType string
+	ThumbSize     int64
+	Title         string
 }
 
 type EmbedRecord struct {
@@ -119,6 +124,7 @@ func ExtractEmbedFromFeedPost(feedPost *bsky.FeedPost) (*Embed, error) {
 				Video: &EmbedVideo{
 					Alt:         alt,
 					AspectRatio: aspectRatio,
+					Captions:    extractCaptions(feedPost.Embed.EmbedVideo.Captions),
 					Ref:         feedPost.Embed.EmbedVideo.Video.Ref.String(),
 					MimeType:    feedPost.Embed.EmbedVideo.Video.MimeType,
 					Size:        feedPost.Embed.EmbedVideo.Video.Size,
@@ -126,19 +132,9 @@ func ExtractEmbedFromFeedPost(feedPost *bsky.FeedPost) (*Embed, error) {
 				Images: make([]*EmbedImage, 0),
 			}
 		case feedPost.Embed.EmbedExternal != nil:
-			var thumbRef string
-			if feedPost.Embed.EmbedExternal.External.Thumb != nil {
-				thumbRef = feedPost.Embed.EmbedExternal.External.Thumb.Ref.String()
-			}
-
 			embed = &Embed{
-				External: &EmbedExternal{
-					Description: feedPost.Embed.EmbedExternal.External.Description,
-					Uri:         feedPost.Embed.EmbedExternal.External.Uri,
-					ThumbRef:    thumbRef,
-					Title:       feedPost.Embed.EmbedExternal.External.Title,
-				},
-				Images: make([]*EmbedImage, 0),
+				External: extractExternal(feedPost.Embed.EmbedExternal),
+				Images:   make([]*EmbedImage, 0),
 			}
 		case feedPost.Embed.EmbedRecord != nil:
 			embed = &Embed{
@@ -150,6 +146,9 @@ func ExtractEmbedFromFeedPost(feedPost *bsky.FeedPost) (*Embed, error) {
 			}
 		case feedPost.Embed.EmbedRecordWithMedia != nil:
 			media := feedPost.Embed.EmbedRecordWithMedia.Media
+			if media == nil {
+				return nil, fmt.Errorf("record with media embed has no media")
+			}
 			switch {
 			case media.EmbedImages != nil:
 				images := make([]*EmbedImage, len(media.EmbedImages.Images))
@@ -205,6 +204,7 @@ func ExtractEmbedFromFeedPost(feedPost *bsky.FeedPost) (*Embed, error) {
 							Video: &EmbedVideo{
 								Alt:         alt,
 								AspectRatio: aspectRatio,
+								Captions:    extractCaptions(media.EmbedVideo.Captions),
 								Ref:         media.EmbedVideo.Video.Ref.String(),
 								MimeType:    media.EmbedVideo.Video.MimeType,
 								Size:        media.EmbedVideo.Video.Size,
@@ -213,25 +213,59 @@ func ExtractEmbedFromFeedPost(feedPost *bsky.FeedPost) (*Embed, error) {
 					},
 				}
 			case media.EmbedExternal != nil:
-				var thumbRef string
-				if media.EmbedExternal.External.Thumb != nil {
-					thumbRef = media.EmbedExternal.External.Thumb.Ref.String()
-				}
-
 				embed = &Embed{
 					RecordWithMedia: &EmbedRecordWithMedia{
 						Media: &EmbedRecordWithMedia_Media{
-							External: &EmbedExternal{
-								Description: media.EmbedExternal.External.Description,
-								Uri:         media.EmbedExternal.External.Uri,
-								ThumbRef:    thumbRef,
-								Title:       media.EmbedExternal.External.Title,
-							},
+							External: extractExternal(media.EmbedExternal),
 						},
 					},
 				}
 			}
+			if embed.RecordWithMedia != nil {
+				if record := feedPost.Embed.EmbedRecordWithMedia.Record; record != nil && record.Record != nil {
+					embed.RecordWithMedia.Record = &EmbedRecord{
+						Cid: record.Record.Cid,
+						Uri: record.Record.Uri,
+					}
+				}
+				embed.Images = make([]*EmbedImage, 0)
+			}
 		}
 	}
 	return embed, nil
 }
+
+// extractExternal converts an external link embed
+func extractExternal(external *bsky.EmbedExternal) *EmbedExternal {
+	if external.External == nil {
+		return nil
+	}
+	extracted := &EmbedExternal{
+		Description: external.External.Description,
+		Uri:         external.External.Uri,
+		Title:       external.External.Title,
+	}
+	if external.External.Thumb != nil {
+		extracted.ThumbRef = external.External.Thumb.Ref.String()
+		extracted.ThumbMimeType = external.External.Thumb.MimeType
+		extracted.ThumbSize = external.External.Thumb.Size
+	}
+	return extracted
+}
+
+// extractCaptions converts the caption files of a video embed
+func extractCaptions(captions []*bsky.EmbedVideo_Caption) []*EmbedVideoCaption {
+	var extracted []*EmbedVideoCaption
+	for _, caption := range captions {
+		if caption == nil || caption.File == nil {
+			continue
+		}
+		extracted = append(extracted, &EmbedVideoCaption{
+			Lang:     caption.Lang,
+			Ref:      caption.File.Ref.String(),
+			MimeType: caption.File.MimeType,
+			Size:     caption.File.Size,
+		})
+	}
+	return extracted
+}
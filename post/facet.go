@@ -39,11 +39,21 @@ type Facet struct {
 func ExtractFacetsFromFeedPost(feedPost *bsky.FeedPost) []Facet {
 	var facets []Facet
 	for _, facet := range feedPost.Facets {
+		if facet == nil || facet.Index == nil {
+			continue
+		}
 		for _, feature := range facet.Features {
+			if feature == nil {
+				continue
+			}
 			index := FacetByteSlice{
 				ByteStart: facet.Index.ByteStart,
 				ByteEnd:   min(facet.Index.ByteEnd, int64(len(feedPost.Text))),
 			}
+			// Skip facets whose range doesn't fit the text
+			if index.ByteStart < 0 || index.ByteStart > index.ByteEnd {
+				continue
+			}
 			text := feedPost.Text[index.ByteStart:index.ByteEnd]
 			switch {
 			case feature.RichtextFacet_Link != nil:
@@ -0,0 +1,287 @@
+package post
+
+import (
+	"github.com/bluesky-social/indigo/api/atproto"
+	"github.com/bluesky-social/indigo/api/bsky"
+)
+
+// Author is the account that wrote a post, as seen by the authenticated user
+type Author struct {
+	Did         string
+	Handle      string
+	DisplayName string
+	Avatar      string
+	// Description and IndexedAt are only set for full profile views, such as
+	// followers and actor search results
+	Description string
+	IndexedAt   string
+	// CreatedAt is when the account was created
+	CreatedAt string
+	// Labeler is set for accounts that run a labeling service
+	Labeler bool
+	// Labels are the moderation labels applied to the account
+	Labels []ModerationLabel
+	// Relationship is nil when the post wasn't fetched by an authenticated user
+	Relationship *Relationship
+}
+
+// Relationship is the authenticated user's relationship to an account
+type Relationship struct {
+	// Following is the URI of the user's follow of the account
+	Following string
+	// FollowedBy is the URI of the account's follow of the user
+	FollowedBy string
+	// Blocking is the URI of the user's block of the account
+	Blocking  string
+	BlockedBy bool
+	Muted     bool
+}
+
+// ModerationLabel is a label applied to a post or account by a labeler, as
+// opposed to the self-labels in Post.Labels
+type ModerationLabel struct {
+	// Src is the DID of the labeler
+	Src string
+	// Uri is the post or account the label applies to
+	Uri string
+	Val string
+	// Neg marks a label that removes an earlier label with the same value
+	Neg       bool
+	CreatedAt string
+	// ExpiresAt is empty for labels that don't expire
+	ExpiresAt string
+}
+
+// moderationLabels converts labels from the AppView
+func moderationLabels(labels []*atproto.LabelDefs_Label) []ModerationLabel {
+	if len(labels) == 0 {
+		return nil
+	}
+	converted := make([]ModerationLabel, 0, len(labels))
+	for _, label := range labels {
+		if label == nil {
+			continue
+		}
+		l := ModerationLabel{Src: label.Src, Uri: label.Uri, Val: label.Val, CreatedAt: label.Cts}
+		if label.Neg != nil {
+			l.Neg = *label.Neg
+		}
+		if label.Exp != nil {
+			l.ExpiresAt = *label.Exp
+		}
+		converted = append(converted, l)
+	}
+	return converted
+}
+
+// relationshipFromViewerState converts a bsky.ActorDefs_ViewerState to a
+// Relationship
+func relationshipFromViewerState(state *bsky.ActorDefs_ViewerState) *Relationship {
+	if state == nil {
+		return nil
+	}
+	rel := &Relationship{
+		Following:  stringValue(state.Following),
+		FollowedBy: stringValue(state.FollowedBy),
+		Blocking:   stringValue(state.Blocking),
+		BlockedBy:  state.BlockedBy != nil && *state.BlockedBy,
+		Muted:      state.Muted != nil && *state.Muted,
+	}
+	return rel
+}
+
+func stringValue(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+// profileView holds the fields shared by the actor profile views, so that
+// every view is converted to an Author the same way
+type profileView struct {
+	did         string
+	handle      string
+	displayName *string
+	avatar      *string
+	description *string
+	indexedAt   *string
+	createdAt   *string
+	associated  *bsky.ActorDefs_ProfileAssociated
+	labels      []*atproto.LabelDefs_Label
+	viewer      *bsky.ActorDefs_ViewerState
+}
+
+// author converts the profile view to an Author
+func (v profileView) author() *Author {
+	return &Author{
+		Did:          v.did,
+		Handle:       v.handle,
+		DisplayName:  stringValue(v.displayName),
+		Avatar:       stringValue(v.avatar),
+		Description:  stringValue(v.description),
+		IndexedAt:    stringValue(v.indexedAt),
+		CreatedAt:    stringValue(v.createdAt),
+		Labeler:      v.associated != nil && v.associated.Labeler != nil && *v.associated.Labeler,
+		Labels:       moderationLabels(v.labels),
+		Relationship: relationshipFromViewerState(v.viewer),
+	}
+}
+
+// AuthorFromProfileViewBasic converts a bsky.ActorDefs_ProfileViewBasic to an
+// Author. It returns nil for a nil profile.
+func AuthorFromProfileViewBasic(profile *bsky.ActorDefs_ProfileViewBasic) *Author {
+	if profile == nil {
+		return nil
+	}
+	return profileView{
+		did:         profile.Did,
+		handle:      profile.Handle,
+		displayName: profile.DisplayName,
+		avatar:      profile.Avatar,
+		createdAt:   profile.CreatedAt,
+		associated:  profile.Associated,
+		labels:      profile.Labels,
+		viewer:      profile.Viewer,
+	}.author()
+}
+
+// AuthorFromProfileView converts a bsky.ActorDefs_ProfileView to an Author.
+// It returns nil for a nil profile.
+func AuthorFromProfileView(profile *bsky.ActorDefs_ProfileView) *Author {
+	if profile == nil {
+		return nil
+	}
+	return profileView{
+		did:         profile.Did,
+		handle:      profile.Handle,
+		displayName: profile.DisplayName,
+		avatar:      profile.Avatar,
+		description: profile.Description,
+		indexedAt:   profile.IndexedAt,
+		createdAt:   profile.CreatedAt,
+		associated:  profile.Associated,
+		labels:      profile.Labels,
+		viewer:      profile.Viewer,
+	}.author()
+}
+
+// AuthorFromProfileViewDetailed converts a bsky.ActorDefs_ProfileViewDetailed,
+// as returned by app.bsky.actor.getProfile, to an Author. It returns nil for a
+// nil profile.
+func AuthorFromProfileViewDetailed(profile *bsky.ActorDefs_ProfileViewDetailed) *Author {
+	if profile == nil {
+		return nil
+	}
+	return profileView{
+		did:         profile.Did,
+		handle:      profile.Handle,
+		displayName: profile.DisplayName,
+		avatar:      profile.Avatar,
+		description: profile.Description,
+		indexedAt:   profile.IndexedAt,
+		createdAt:   profile.CreatedAt,
+		associated:  profile.Associated,
+		labels:      profile.Labels,
+		viewer:      profile.Viewer,
+	}.author()
+}
+
+// Viewer is the authenticated user's relationship to a post
+type Viewer struct {
+	// Like is the URI of the user's like of the post, if they liked it
+	Like string
+	// Repost is the URI of the user's repost of the post, if they reposted it
+	Repost            string
+	ThreadMuted       bool
+	ReplyDisabled     bool
+	EmbeddingDisabled bool
+	Pinned            bool
+}
+
+// viewerFromViewerState converts a bsky.FeedDefs_ViewerState to a Viewer
+func viewerFromViewerState(state *bsky.FeedDefs_ViewerState) *Viewer {
+	if state == nil {
+		return nil
+	}
+	flag := func(b *bool) bool { return b != nil && *b }
+	viewer := &Viewer{
+		ThreadMuted:       flag(state.ThreadMuted),
+		ReplyDisabled:     flag(state.ReplyDisabled),
+		EmbeddingDisabled: flag(state.EmbeddingDisabled),
+		Pinned:            flag(state.Pinned),
+	}
+	viewer.Like = stringValue(state.Like)
+	viewer.Repost = stringValue(state.Repost)
+	return viewer
+}
+
+// Reason explains why a post appears in a feed other than being posted by
+// someone the feed follows
+type Reason struct {
+	// RepostBy is the user who reposted the post into the feed
+	RepostBy *Author
+	// RepostedAt is when the repost was indexed
+	RepostedAt string
+	// Pinned is set when the post is pinned to the top of an author feed
+	Pinned bool
+}
+
+// ReplyContext holds the posts a reply in a feed responds to. Root or Parent
+// is nil when that post was deleted or is blocked; ReplyRef still has its URI.
+type ReplyContext struct {
+	Root   *Post
+	Parent *Post
+	// GrandparentAuthor is the author of the post the parent replies to
+	GrandparentAuthor *Author
+}
+
+// PostFromFeedViewPost converts an item of a feed, such as the timeline, to a
+// Post including why it's in the feed and the posts it replies to
+func PostFromFeedViewPost(item *bsky.FeedDefs_FeedViewPost) (*Post, error) {
+	p, err := PostFromFeedDefs_PostView(item.Post)
+	if err != nil {
+		return nil, err
+	}
+
+	if reason := item.Reason; reason != nil {
+		switch {
+		case reason.FeedDefs_ReasonRepost != nil:
+			p.Reason = &Reason{
+				RepostBy:   AuthorFromProfileViewBasic(reason.FeedDefs_ReasonRepost.By),
+				RepostedAt: reason.FeedDefs_ReasonRepost.IndexedAt,
+			}
+		case reason.FeedDefs_ReasonPin != nil:
+			p.Reason = &Reason{Pinned: true}
+		}
+	}
+
+	if reply := item.Reply; reply != nil {
+		p.ReplyContext = &ReplyContext{GrandparentAuthor: AuthorFromProfileViewBasic(reply.GrandparentAuthor)}
+		if reply.Root != nil && reply.Root.FeedDefs_PostView != nil {
+			if p.ReplyContext.Root, err = PostFromFeedDefs_PostView(reply.Root.FeedDefs_PostView); err != nil {
+				return nil, err
+			}
+		}
+		if reply.Parent != nil && reply.Parent.FeedDefs_PostView != nil {
+			if p.ReplyContext.Parent, err = PostFromFeedDefs_PostView(reply.Parent.FeedDefs_PostView); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return p, nil
+}
+
+// PostsFromFeed converts the items of a feed to Posts
+func PostsFromFeed(items []*bsky.FeedDefs_FeedViewPost) ([]*Post, error) {
+	posts := make([]*Post, 0, len(items))
+	for _, item := range items {
+		p, err := PostFromFeedViewPost(item)
+		if err != nil {
+			return nil, err
+		}
+		posts = append(posts, p)
+	}
+	return posts, nil
+}
@@ -0,0 +1,72 @@
+package post
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/bluesky-social/indigo/api/bsky"
+	"github.com/stretchr/testify/assert"
+)
+
+const testPostView = `{
+	"uri": "at://did:plc:alice/app.bsky.feed.post/3kabc",
+	"cid": "cid-alice",
+	"author": {
+		"did": "did:plc:alice",
+		"handle": "alice.test",
+		"displayName": "Alice",
+		"avatar": "https://cdn.example/alice.jpg",
+		"createdAt": "2023-04-01T00:00:00Z",
+		"associated": {"labeler": true},
+		"labels": [{"src": "did:plc:mod", "uri": "did:plc:alice", "val": "impersonation", "cts": "2024-01-01T00:00:00Z"}],
+		"viewer": {"following": "at://did:plc:me/app.bsky.graph.follow/3kf", "muted": true}
+	},
+	"record": {"$type": "app.bsky.feed.post", "text": "hello", "createdAt": "2024-05-06T08:00:00Z"},
+	"indexedAt": "2024-05-06T08:00:01Z",
+	"labels": [
+		{"src": "did:plc:mod", "uri": "at://did:plc:alice/app.bsky.feed.post/3kabc", "val": "spam", "cts": "2024-05-06T09:00:00Z"},
+		{"src": "did:plc:mod", "uri": "at://did:plc:alice/app.bsky.feed.post/3kabc", "val": "rude", "cts": "2024-05-06T09:00:00Z", "exp": "2024-06-01T00:00:00Z"},
+		{"src": "did:plc:mod", "uri": "at://did:plc:alice/app.bsky.feed.post/3kabc", "val": "rude", "neg": true, "cts": "2024-05-06T10:00:00Z"}
+	],
+	"likeCount": 7,
+	"viewer": {"like": "at://did:plc:me/app.bsky.feed.like/3kl", "repost": "at://did:plc:me/app.bsky.feed.repost/3kr"}
+}`
+
+func TestPostFromPostView(t *testing.T) {
+	var view bsky.FeedDefs_PostView
+	assert.NoError(t, json.Unmarshal([]byte(testPostView), &view))
+
+	p, err := PostFromFeedDefs_PostView(&view)
+	assert.NoError(t, err)
+
+	t.Run("post", func(t *testing.T) {
+		assert.Equal(t, "hello", p.Text)
+		assert.Equal(t, "2024-05-06T08:00:01Z", p.IndexedAt)
+		assert.Equal(t, int64(7), p.Likes)
+		assert.Equal(t, "at://did:plc:me/app.bsky.feed.like/3kl", p.Viewer.Like)
+		assert.Equal(t, "at://did:plc:me/app.bsky.feed.repost/3kr", p.Viewer.Repost)
+	})
+
+	t.Run("author", func(t *testing.T) {
+		assert.Equal(t, &Author{
+			Did:         "did:plc:alice",
+			Handle:      "alice.test",
+			DisplayName: "Alice",
+			Avatar:      "https://cdn.example/alice.jpg",
+			CreatedAt:   "2023-04-01T00:00:00Z",
+			Labeler:     true,
+			Labels: []ModerationLabel{
+				{Src: "did:plc:mod", Uri: "did:plc:alice", Val: "impersonation", CreatedAt: "2024-01-01T00:00:00Z"},
+			},
+			Relationship: &Relationship{Following: "at://did:plc:me/app.bsky.graph.follow/3kf", Muted: true},
+		}, p.Author)
+	})
+
+	t.Run("moderation labels", func(t *testing.T) {
+		assert.Len(t, p.ModerationLabels, 3)
+		assert.Equal(t, "2024-06-01T00:00:00Z", p.ModerationLabels[1].ExpiresAt)
+		assert.True(t, p.HasModerationLabel("spam"))
+		assert.False(t, p.HasModerationLabel("rude"))
+		assert.False(t, p.HasModerationLabel("porn"))
+	})
+}
@@ -0,0 +1,98 @@
+package post
+
+import (
+	"time"
+
+	"github.com/bluesky-social/indigo/api/bsky"
+)
+
+// Threadgate restricts who can reply to a post. The zero value allows nobody
+// to reply; set any of the Allow fields to open replies up to those users.
+type Threadgate struct {
+	// AllowEveryone lifts all reply restrictions, which is useful to keep
+	// HiddenReplies without limiting who can reply
+	AllowEveryone bool
+	// AllowMentioned allows users mentioned in the post to reply
+	AllowMentioned bool
+	// AllowFollowing allows users followed by the author to reply
+	AllowFollowing bool
+	// AllowLists allows members of the given lists (AT URIs) to reply
+	AllowLists []string
+	// HiddenReplies lists the AT URIs of replies hidden from the thread
+	HiddenReplies []string
+}
+
+// Record converts the threadgate into an app.bsky.feed.threadgate record for
+// the post at postUri. When nobody is allowed to reply, Allow is an empty,
+// non-nil slice.
+func (g Threadgate) Record(postUri string) *bsky.FeedThreadgate {
+	record := &bsky.FeedThreadgate{
+		LexiconTypeID: "app.bsky.feed.threadgate",
+		Post:          postUri,
+		CreatedAt:     time.Now().Format(time.RFC3339),
+		HiddenReplies: g.HiddenReplies,
+	}
+
+	if g.AllowEveryone {
+		return record
+	}
+
+	record.Allow = []*bsky.FeedThreadgate_Allow_Elem{}
+	if g.AllowMentioned {
+		record.Allow = append(record.Allow, &bsky.FeedThreadgate_Allow_Elem{
+			FeedThreadgate_MentionRule: &bsky.FeedThreadgate_MentionRule{},
+		})
+	}
+	if g.AllowFollowing {
+		record.Allow = append(record.Allow, &bsky.FeedThreadgate_Allow_Elem{
+			FeedThreadgate_FollowingRule: &bsky.FeedThreadgate_FollowingRule{},
+		})
+	}
+	for _, list := range g.AllowLists {
+		record.Allow = append(record.Allow, &bsky.FeedThreadgate_Allow_Elem{
+			FeedThreadgate_ListRule: &bsky.FeedThreadgate_ListRule{List: list},
+		})
+	}
+
+	return record
+}
+
+// Postgate controls how a post can be embedded by others
+type Postgate struct {
+	// DisableQuotes prevents other posts from quoting this one
+	DisableQuotes bool
+	// DetachedQuotes lists the AT URIs of quote posts detached from this post
+	DetachedQuotes []string
+}
+
+// Record converts the postgate into an app.bsky.feed.postgate record for the
+// post at postUri
+func (g Postgate) Record(postUri string) *bsky.FeedPostgate {
+	record := &bsky.FeedPostgate{
+		LexiconTypeID:         "app.bsky.feed.postgate",
+		Post:                  postUri,
+		CreatedAt:             time.Now().Format(time.RFC3339),
+		DetachedEmbeddingUris: g.DetachedQuotes,
+	}
+
+	if g.DisableQuotes {
+		record.EmbeddingRules = []*bsky.FeedPostgate_EmbeddingRules_Elem{{
+			FeedPostgate_DisableRule: &bsky.FeedPostgate_DisableRule{},
+		}}
+	}
+
+	return record
+}
+
+// PostgateFromRecord converts an app.bsky.feed.postgate record into a Postgate
+func PostgateFromRecord(record *bsky.FeedPostgate) Postgate {
+	gate := Postgate{
+		DetachedQuotes: record.DetachedEmbeddingUris,
+	}
+	for _, rule := range record.EmbeddingRules {
+		if rule != nil && rule.FeedPostgate_DisableRule != nil {
+			gate.DisableQuotes = true
+		}
+	}
+	return gate
+}
@@ -0,0 +1,52 @@
+package post
+
+import (
+	"testing"
+
+	"github.com/bluesky-social/indigo/api/bsky"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestThreadgateRecord(t *testing.T) {
+	uri := "at://did:plc:test/app.bsky.feed.post/3kabc"
+
+	t.Run("nobody can reply", func(t *testing.T) {
+		record := Threadgate{}.Record(uri)
+		assert.Equal(t, uri, record.Post)
+		assert.NotNil(t, record.Allow)
+		assert.Empty(t, record.Allow)
+	})
+
+	t.Run("everyone can reply", func(t *testing.T) {
+		record := Threadgate{AllowEveryone: true, AllowMentioned: true, HiddenReplies: []string{"at://reply"}}.Record(uri)
+		assert.Nil(t, record.Allow)
+		assert.Equal(t, []string{"at://reply"}, record.HiddenReplies)
+	})
+
+	t.Run("allow rules", func(t *testing.T) {
+		record := Threadgate{
+			AllowMentioned: true,
+			AllowFollowing: true,
+			AllowLists:     []string{"at://did:plc:test/app.bsky.graph.list/friends"},
+		}.Record(uri)
+
+		assert.Len(t, record.Allow, 3)
+		assert.NotNil(t, record.Allow[0].FeedThreadgate_MentionRule)
+		assert.NotNil(t, record.Allow[1].FeedThreadgate_FollowingRule)
+		assert.Equal(t, "at://did:plc:test/app.bsky.graph.list/friends", record.Allow[2].FeedThreadgate_ListRule.List)
+	})
+}
+
+func TestPostgateRecord(t *testing.T) {
+	uri := "at://did:plc:test/app.bsky.feed.post/3kabc"
+
+	record := Postgate{DisableQuotes: true, DetachedQuotes: []string{"at://quote"}}.Record(uri)
+	assert.Equal(t, uri, record.Post)
+	assert.Len(t, record.EmbeddingRules, 1)
+	assert.NotNil(t, record.EmbeddingRules[0].FeedPostgate_DisableRule)
+	assert.Equal(t, []string{"at://quote"}, record.DetachedEmbeddingUris)
+
+	assert.Equal(t, Postgate{DisableQuotes: true, DetachedQuotes: []string{"at://quote"}}, PostgateFromRecord(record))
+	assert.Equal(t, Postgate{}, PostgateFromRecord(&bsky.FeedPostgate{}))
+	assert.Empty(t, Postgate{}.Record(uri).EmbeddingRules)
+}
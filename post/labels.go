@@ -0,0 +1,197 @@
+package post
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/bluesky-social/indigo/api/atproto"
+	"github.com/bluesky-social/indigo/api/bsky"
+	lexutil "github.com/bluesky-social/indigo/lex/util"
+	"github.com/watzon/lining/models"
+)
+
+// Self-label values that Bluesky clients understand on posts
+const (
+	LabelSexual       = "sexual"
+	LabelNudity       = "nudity"
+	LabelPorn         = "porn"
+	LabelGraphicMedia = "graphic-media"
+)
+
+// KnownSelfLabels lists the self-label values accepted by the Builder
+var KnownSelfLabels = []string{LabelSexual, LabelNudity, LabelPorn, LabelGraphicMedia}
+
+// ErrInvalidLabel is returned when a self-label is not one of KnownSelfLabels,
+// or by ValidateSelfLabels when it isn't a well-formed label value
+var ErrInvalidLabel = errors.New("invalid self-label")
+
+// labelValueRegex matches label values: lowercase ASCII letters and hyphens,
+// with a leading "!" for global labels such as "!no-unauthenticated"
+var labelValueRegex = regexp.MustCompile(`^!?[a-z-]{1,128}$`)
+
+// ErrMissingLabel is returned when a LabelPolicy requires a label the post doesn't have
+var ErrMissingLabel = errors.New("post is missing a required self-label")
+
+// Media is an image or video embedded in a post, including media attached to
+// a quote
+type Media struct {
+	// Kind is "image" or "video"
+	Kind string
+	// Index is the position of the media in the post, starting at 0
+	Index int
+	// Image holds the data of images added with WithImages. It is nil for
+	// videos and for media copied from another post.
+	Image *models.Image
+	// Alt is the media's alt text
+	Alt string
+	// Blob is the uploaded image or video
+	Blob *lexutil.LexBlob
+}
+
+// LabelPolicy checks the self-labels of a post against the media it embeds. It
+// should return an error wrapping ErrMissingLabel when a required label is absent.
+type LabelPolicy func(labels []string, media []Media) error
+
+// RequireLabel returns a LabelPolicy that requires at least one of the given
+// labels whenever match reports true for any of the post's images or videos.
+//
+// Example:
+//
+//	// Require a content warning on anything our classifier flags, and on
+//	// every video
+//	policy := post.RequireLabel(func(m post.Media) bool {
+//	    return m.Kind == "video" || classifier.IsSensitive(m.Image.Data)
+//	}, post.LabelSexual, post.LabelNudity, post.LabelPorn)
+func RequireLabel(match func(m Media) bool, oneOf ...string) LabelPolicy {
+	return func(labels []string, media []Media) error {
+		for _, m := range media {
+			if !match(m) {
+				continue
+			}
+			for _, want := range oneOf {
+				for _, have := range labels {
+					if have == want {
+						return nil
+					}
+				}
+			}
+			return fmt.Errorf("%w: %s %d requires one of %s", ErrMissingLabel, m.Kind, m.Index+1, strings.Join(oneOf, ", "))
+		}
+		return nil
+	}
+}
+
+// WithLabelPolicy returns a BuilderOption that adds a policy checked by Build
+func WithLabelPolicy(policy LabelPolicy) BuilderOption {
+	return func(opts *BuilderOptions) {
+		opts.LabelPolicies = append(opts.LabelPolicies, policy)
+	}
+}
+
+// ValidateSelfLabels checks that every self-label on the post is a well-formed
+// label value. Unlike the Builder, which only accepts KnownSelfLabels, it lets
+// through any other valid value, such as "!no-unauthenticated".
+func ValidateSelfLabels(post *bsky.FeedPost) error {
+	if post.Labels == nil || post.Labels.LabelDefs_SelfLabels == nil {
+		return nil
+	}
+	for _, label := range post.Labels.LabelDefs_SelfLabels.Values {
+		if label == nil || !labelValueRegex.MatchString(label.Val) {
+			val := ""
+			if label != nil {
+				val = label.Val
+			}
+			return fmt.Errorf("%w: %q", ErrInvalidLabel, val)
+		}
+	}
+	return nil
+}
+
+func isKnownSelfLabel(label string) bool {
+	for _, known := range KnownSelfLabels {
+		if label == known {
+			return true
+		}
+	}
+	return false
+}
+
+// WithLabels adds self-labels (content warnings) to the post. Each label must
+// be one of KnownSelfLabels; duplicates are ignored.
+//
+// Example:
+//
+//	builder.WithLabels(post.LabelGraphicMedia)
+func (b *Builder) WithLabels(labels ...string) *Builder {
+	if b.err != nil {
+		return b
+	}
+	for _, label := range labels {
+		if !isKnownSelfLabel(label) {
+			b.err = fmt.Errorf("%w: %q", ErrInvalidLabel, label)
+			return b
+		}
+		duplicate := false
+		for _, existing := range b.labels {
+			if existing == label {
+				duplicate = true
+				break
+			}
+		}
+		if !duplicate {
+			b.labels = append(b.labels, label)
+		}
+	}
+	return b
+}
+
+// checkLabelPolicies runs the configured label policies against the media of
+// the post's embed
+func (b *Builder) checkLabelPolicies(embed *bsky.FeedPost_Embed) error {
+	if len(b.options.LabelPolicies) == 0 {
+		return nil
+	}
+
+	var media []Media
+	images, video := embedMedia(embed)
+	for i, img := range images {
+		m := Media{Kind: "image", Index: i, Alt: img.Alt, Blob: img.Image}
+		if embed != b.sourceEmbed && i < len(b.embed.Images) {
+			m.Image = &b.embed.Images[i]
+		}
+		media = append(media, m)
+	}
+	if video != nil {
+		m := Media{Kind: "video", Blob: video.Video}
+		if video.Alt != nil {
+			m.Alt = *video.Alt
+		}
+		media = append(media, m)
+	}
+
+	for _, policy := range b.options.LabelPolicies {
+		if err := policy(b.labels, media); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// selfLabels converts the builder's labels into the record format
+func (b *Builder) selfLabels() *bsky.FeedPost_Labels {
+	if len(b.labels) == 0 {
+		return nil
+	}
+	values := make([]*atproto.LabelDefs_SelfLabel, len(b.labels))
+	for i, label := range b.labels {
+		values[i] = &atproto.LabelDefs_SelfLabel{Val: label}
+	}
+	return &bsky.FeedPost_Labels{
+		LabelDefs_SelfLabels: &atproto.LabelDefs_SelfLabels{
+			LexiconTypeID: "com.atproto.label.defs#selfLabels",
+			Values:        values,
+		},
+	}
+}
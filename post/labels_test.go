@@ -0,0 +1,109 @@
+package post
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/bluesky-social/indigo/api/atproto"
+	"github.com/bluesky-social/indigo/api/bsky"
+	lexutil "github.com/bluesky-social/indigo/lex/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/watzon/lining/models"
+)
+
+func TestBuilderLabels(t *testing.T) {
+	t.Run("adds self-labels", func(t *testing.T) {
+		post, err := NewBuilder().
+			AddText("spooky").
+			WithLabels(LabelGraphicMedia, LabelNudity, LabelGraphicMedia).
+			Build()
+
+		assert.NoError(t, err)
+		assert.NotNil(t, post.Labels)
+		assert.Equal(t, "com.atproto.label.defs#selfLabels", post.Labels.LabelDefs_SelfLabels.LexiconTypeID)
+		assert.Equal(t, []*atproto.LabelDefs_SelfLabel{
+			{Val: LabelGraphicMedia},
+			{Val: LabelNudity},
+		}, post.Labels.LabelDefs_SelfLabels.Values)
+
+		p, err := PostFromFeedPost(&post, "did:plc:me", "1")
+		assert.NoError(t, err)
+		assert.Equal(t, []string{LabelGraphicMedia, LabelNudity}, p.Labels)
+	})
+
+	t.Run("no labels", func(t *testing.T) {
+		post, err := NewBuilder().AddText("hi").Build()
+		assert.NoError(t, err)
+		assert.Nil(t, post.Labels)
+	})
+
+	t.Run("rejects unknown labels", func(t *testing.T) {
+		_, err := NewBuilder().WithLabels("spoilers").Build()
+		assert.ErrorIs(t, err, ErrInvalidLabel)
+	})
+
+	t.Run("label policies", func(t *testing.T) {
+		flagged := func(m Media) bool {
+			return m.Image != nil && strings.Contains(m.Image.Title, "nsfw")
+		}
+		images := []models.UploadedImage{{
+			LexBlob: &lexutil.LexBlob{MimeType: "image/png"},
+			Image:   models.Image{Title: "nsfw photo"},
+		}}
+		policy := WithLabelPolicy(RequireLabel(flagged, LabelSexual, LabelNudity, LabelPorn))
+
+		_, err := NewBuilder(policy).WithImages(images).Build()
+		assert.ErrorIs(t, err, ErrMissingLabel)
+
+		_, err = NewBuilder(policy).WithImages(images).WithLabels(LabelNudity).Build()
+		assert.NoError(t, err)
+
+		_, err = NewBuilder(policy).AddText("no media").Build()
+		assert.NoError(t, err)
+	})
+
+	t.Run("label policies check videos", func(t *testing.T) {
+		videos := WithLabelPolicy(RequireLabel(func(m Media) bool {
+			return m.Kind == "video"
+		}, LabelGraphicMedia))
+		video := &EmbedVideo{Alt: "crash test", Ref: testBlobCid, MimeType: "video/mp4"}
+		quote := &EmbedRecord{Uri: "at://did:plc:carol/app.bsky.feed.post/3k", Cid: testBlobCid}
+
+		for _, embed := range []*Embed{
+			{Video: video},
+			{RecordWithMedia: &EmbedRecordWithMedia{Record: quote, Media: &EmbedRecordWithMedia_Media{Video: video}}},
+		} {
+			builder, err := NewBuilderFromPost(&Post{Text: "clip", Repo: "did:plc:bob", Embed: embed}, videos)
+			assert.NoError(t, err)
+			_, err = builder.Build()
+			assert.ErrorIs(t, err, ErrMissingLabel)
+			assert.ErrorContains(t, err, "video 1")
+
+			builder, err = NewBuilderFromPost(&Post{Text: "clip", Repo: "did:plc:bob", Embed: embed, Labels: []string{LabelGraphicMedia}}, videos)
+			assert.NoError(t, err)
+			_, err = builder.Build()
+			assert.NoError(t, err)
+		}
+
+		builder, err := NewBuilderFromPost(&Post{Text: "quote", Repo: "did:plc:bob", Embed: &Embed{Record: quote}}, videos)
+		assert.NoError(t, err)
+		_, err = builder.Build()
+		assert.NoError(t, err)
+	})
+}
+
+func TestValidateSelfLabels(t *testing.T) {
+	post := &bsky.FeedPost{
+		Labels: &bsky.FeedPost_Labels{
+			LabelDefs_SelfLabels: &atproto.LabelDefs_SelfLabels{
+				Values: []*atproto.LabelDefs_SelfLabel{{Val: LabelPorn}, {Val: "!no-unauthenticated"}},
+			},
+		},
+	}
+	assert.NoError(t, ValidateSelfLabels(post))
+
+	post.Labels.LabelDefs_SelfLabels.Values = append(post.Labels.LabelDefs_SelfLabels.Values, &atproto.LabelDefs_SelfLabel{Val: "Not A Label"})
+	assert.ErrorIs(t, ValidateSelfLabels(post), ErrInvalidLabel)
+
+	assert.NoError(t, ValidateSelfLabels(&bsky.FeedPost{}))
+}
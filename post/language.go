@@ -0,0 +1,126 @@
+package post
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/bluesky-social/indigo/api/bsky"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+)
+
+// Maximum number of languages a post can declare
+const maxLangs = 3
+
+// ErrInvalidLanguage is returned when a language is not a valid BCP-47 tag, or
+// when a post declares too many languages
+var ErrInvalidLanguage = errors.New("invalid language")
+
+// LanguageDetector guesses the languages of a post's text. Detect should return
+// BCP-47 tags, most prominent first, or nil if it can't tell. The
+// langdetect.Detector type satisfies this interface.
+type LanguageDetector interface {
+	Detect(text string) []string
+}
+
+// WithLanguageDetector returns a BuilderOption that sets the detector used to
+// fill in the post's languages when none are set explicitly
+func WithLanguageDetector(detector LanguageDetector) BuilderOption {
+	return func(opts *BuilderOptions) {
+		opts.LanguageDetector = detector
+	}
+}
+
+// validateLang checks that lang is a valid BCP-47 language tag
+func validateLang(lang string) error {
+	if _, err := syntax.ParseLanguage(lang); err != nil {
+		return fmt.Errorf("%w: %q", ErrInvalidLanguage, lang)
+	}
+	return nil
+}
+
+// ValidateLangs checks that the post declares at most three languages and
+// that each of them is a valid BCP-47 tag
+func ValidateLangs(post *bsky.FeedPost) error {
+	if len(post.Langs) > maxLangs {
+		return fmt.Errorf("%w: a post can declare at most %d languages", ErrInvalidLanguage, maxLangs)
+	}
+	for _, lang := range post.Langs {
+		if err := validateLang(lang); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WithLangs sets the languages the post is written in as BCP-47 tags, such
+// as "en", "pt-BR" or "ja", replacing any set before. Up to three languages
+// can be set; duplicates are ignored. Languages set this way take precedence
+// over the LanguageDetector and DefaultLanguage.
+//
+// Example:
+//
+//	builder.WithLangs("en", "es")
+func (b *Builder) WithLangs(langs ...string) *Builder {
+	if b.err != nil {
+		return b
+	}
+
+	b.langs = nil
+	for _, lang := range langs {
+		if err := validateLang(lang); err != nil {
+			b.err = err
+			return b
+		}
+		duplicate := false
+		for _, existing := range b.langs {
+			if existing == lang {
+				duplicate = true
+				break
+			}
+		}
+		if !duplicate {
+			b.langs = append(b.langs, lang)
+		}
+	}
+	if len(b.langs) > maxLangs {
+		b.err = fmt.Errorf("%w: a post can declare at most %d languages", ErrInvalidLanguage, maxLangs)
+	}
+	return b
+}
+
+// languages determines the languages of the post. Explicitly set languages
+// win, then those found by the LanguageDetector in the plain text of the post,
+// and finally the DefaultLanguage.
+func (b *Builder) languages() ([]string, error) {
+	if len(b.langs) > 0 {
+		return b.langs, nil
+	}
+
+	if b.options.LanguageDetector != nil {
+		var text []byte
+		for _, seg := range b.segments {
+			// Mentions, tags and links say little about the language
+			if seg.facet == nil {
+				text = append(text, seg.text...)
+			}
+		}
+
+		var langs []string
+		for _, lang := range b.options.LanguageDetector.Detect(string(text)) {
+			if validateLang(lang) == nil && len(langs) < maxLangs {
+				langs = append(langs, lang)
+			}
+		}
+		if len(langs) > 0 {
+			return langs, nil
+		}
+	}
+
+	if b.options.DefaultLanguage == "" {
+		return nil, nil
+	}
+	if err := validateLang(b.options.DefaultLanguage); err != nil {
+		return nil, err
+	}
+	return []string{b.options.DefaultLanguage}, nil
+}
@@ -0,0 +1,83 @@
+package post
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/bluesky-social/indigo/api/bsky"
+	"github.com/stretchr/testify/assert"
+	"github.com/watzon/lining/langdetect"
+)
+
+// fixedDetector always detects the same languages
+type fixedDetector []string
+
+func (d fixedDetector) Detect(text string) []string {
+	return d
+}
+
+func TestBuilderLangs(t *testing.T) {
+	t.Run("default language", func(t *testing.T) {
+		post, err := NewBuilder().AddText("Hello").Build()
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"en"}, post.Langs)
+
+		post, err = NewBuilder(WithDefaultLanguage("")).AddText("Hello").Build()
+		assert.NoError(t, err)
+		assert.Nil(t, post.Langs)
+
+		_, err = NewBuilder(WithDefaultLanguage("not a language")).AddText("Hello").Build()
+		assert.True(t, errors.Is(err, ErrInvalidLanguage))
+	})
+
+	t.Run("explicit languages", func(t *testing.T) {
+		post, err := NewBuilder(WithLanguageDetector(fixedDetector{"fr"})).
+			AddText("Hello / Hola").
+			WithLangs("en", "es", "en").
+			Build()
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"en", "es"}, post.Langs)
+
+		post, err = NewBuilder().AddText("Olá").WithLangs("pt-BR").Build()
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"pt-BR"}, post.Langs)
+	})
+
+	t.Run("invalid languages", func(t *testing.T) {
+		_, err := NewBuilder().AddText("Hello").WithLangs("english!").Build()
+		assert.True(t, errors.Is(err, ErrInvalidLanguage))
+
+		_, err = NewBuilder().AddText("Hello").WithLangs("en", "es", "fr", "de").Build()
+		assert.True(t, errors.Is(err, ErrInvalidLanguage))
+	})
+
+	t.Run("detected languages", func(t *testing.T) {
+		post, err := NewBuilder(WithLanguageDetector(langdetect.New())).
+			AddText("Good morning everyone, the new release is out!").
+			AddNewLine().
+			AddText("¡Buenos días a todos, ya está disponible la nueva versión! ").
+			AddLink("Notas", "https://example.com/notes").
+			Build()
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"es", "en"}, post.Langs)
+
+		// Falls back to the default language when nothing is detected
+		post, err = NewBuilder(WithLanguageDetector(langdetect.New()), WithDefaultLanguage("de")).
+			AddText("lol").
+			Build()
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"de"}, post.Langs)
+
+		// Invalid tags from the detector are dropped
+		post, err = NewBuilder(WithLanguageDetector(fixedDetector{"??", "ja"})).AddText("x").Build()
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"ja"}, post.Langs)
+	})
+}
+
+func TestValidateLangs(t *testing.T) {
+	assert.NoError(t, ValidateLangs(&bsky.FeedPost{}))
+	assert.NoError(t, ValidateLangs(&bsky.FeedPost{Langs: []string{"en", "zh-Hant"}}))
+	assert.True(t, errors.Is(ValidateLangs(&bsky.FeedPost{Langs: []string{"en_US!"}}), ErrInvalidLanguage))
+	assert.True(t, errors.Is(ValidateLangs(&bsky.FeedPost{Langs: []string{"en", "es", "fr", "de"}}), ErrInvalidLanguage))
+}
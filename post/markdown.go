@@ -0,0 +1,363 @@
+package post
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/bluesky-social/indigo/api/bsky"
+	"github.com/watzon/lining/models"
+)
+
+// ErrUnsupportedMarkdown is returned when Markdown passed to AddMarkdown uses
+// syntax that can't be represented in a Bluesky post
+var ErrUnsupportedMarkdown = errors.New("unsupported markdown syntax")
+
+// MarkdownError describes a piece of unsupported Markdown syntax and where it
+// was found. It wraps ErrUnsupportedMarkdown.
+type MarkdownError struct {
+	Line   int    // 1-based line number
+	Column int    // 1-based column, in characters
+	Syntax string // Description of the unsupported syntax
+}
+
+func (e *MarkdownError) Error() string {
+	return fmt.Sprintf("%s at line %d, column %d: %s", ErrUnsupportedMarkdown, e.Line, e.Column, e.Syntax)
+}
+
+func (e *MarkdownError) Unwrap() error {
+	return ErrUnsupportedMarkdown
+}
+
+var (
+	headingRegex     = regexp.MustCompile(`^#{1,6}(\s|$)`)
+	profileLinkRegex = regexp.MustCompile(`^https://bsky\.app/profile/(did:[a-z]+:[a-zA-Z0-9._:%-]+)$`)
+	hashtagLinkRegex = regexp.MustCompile(`^https://bsky\.app/hashtag/([^/?#]+)$`)
+	bareURLRegex     = regexp.MustCompile(`^https?://\S+`)
+)
+
+// mdToken is a piece of parsed Markdown, either plain text or text with a facet
+type mdToken struct {
+	ftype models.FacetType // zero for plain text
+	text  string
+	value string
+}
+
+// mdParser turns a Markdown subset into tokens
+type mdParser struct {
+	src    string
+	pos    int
+	text   strings.Builder
+	tokens []mdToken
+	errs   []error
+}
+
+// parseMarkdown parses md into tokens, collecting a MarkdownError for every
+// piece of unsupported syntax
+func parseMarkdown(md string) ([]mdToken, error) {
+	p := &mdParser{src: md}
+	p.parse()
+	return p.tokens, errors.Join(p.errs...)
+}
+
+func (p *mdParser) fail(at int, syntax string) {
+	line := strings.Count(p.src[:at], "\n") + 1
+	lineStart := strings.LastIndex(p.src[:at], "\n") + 1
+	column := utf8.RuneCountInString(p.src[lineStart:at]) + 1
+	p.errs = append(p.errs, &MarkdownError{Line: line, Column: column, Syntax: syntax})
+}
+
+func (p *mdParser) flush() {
+	if p.text.Len() > 0 {
+		p.tokens = append(p.tokens, mdToken{text: p.text.String()})
+		p.text.Reset()
+	}
+}
+
+func (p *mdParser) emit(tok mdToken) {
+	p.flush()
+	p.tokens = append(p.tokens, tok)
+}
+
+// atBoundary reports whether the position i is at the start of the input or
+// follows whitespace or an opening bracket
+func (p *mdParser) atBoundary(i int) bool {
+	if i == 0 {
+		return true
+	}
+	r, _ := utf8.DecodeLastRuneInString(p.src[:i])
+	return unicode.IsSpace(r) || r == '(' || r == '['
+}
+
+// isEmphasis reports whether the run of n '*' or '_' delimiters at i could
+// open or close emphasis, following CommonMark's flanking rules. A delimiter
+// run surrounded by spaces, as in "2 * 3", or inside a word made of
+// underscores, as in "snake_case", is plain text.
+func (p *mdParser) isEmphasis(i, n int) bool {
+	before, after := ' ', ' '
+	if i > 0 {
+		before, _ = utf8.DecodeLastRuneInString(p.src[:i])
+	}
+	if i+n < len(p.src) {
+		after, _ = utf8.DecodeRuneInString(p.src[i+n:])
+	}
+
+	left := !unicode.IsSpace(after) && (!isPunctRune(after) || unicode.IsSpace(before) || isPunctRune(before))
+	right := !unicode.IsSpace(before) && (!isPunctRune(before) || unicode.IsSpace(after) || isPunctRune(after))
+	if p.src[i] == '*' {
+		return left || right
+	}
+	return (left && (!right || isPunctRune(before))) || (right && (!left || isPunctRune(after)))
+}
+
+func (p *mdParser) parse() {
+	for p.pos < len(p.src) {
+		rest := p.src[p.pos:]
+
+		if p.pos == 0 || p.src[p.pos-1] == '\n' {
+			switch {
+			case headingRegex.MatchString(rest):
+				p.fail(p.pos, "headings are not supported")
+			case strings.HasPrefix(rest, "```"):
+				p.fail(p.pos, "code blocks are not supported")
+			case strings.HasPrefix(rest, ">"):
+				p.fail(p.pos, "block quotes are not supported")
+			}
+		}
+
+		switch c := rest[0]; {
+		case c == '\\' && len(rest) > 1 && isASCIIPunct(rest[1]):
+			p.text.WriteByte(rest[1])
+			p.pos += 2
+		case strings.HasPrefix(rest, "!["):
+			p.fail(p.pos, "images are not supported")
+			p.pos++
+		case c == '[':
+			if !p.parseLink() {
+				p.text.WriteByte(c)
+				p.pos++
+			}
+		case c == '<':
+			if !p.parseAutolink() {
+				p.text.WriteByte(c)
+				p.pos++
+			}
+		case c == '`':
+			p.fail(p.pos, "inline code is not supported")
+			p.pos++
+		case c == '*' || c == '_':
+			n := len(rest) - len(strings.TrimLeft(rest, string(c)))
+			if p.isEmphasis(p.pos, n) {
+				p.fail(p.pos, "emphasis is not supported")
+			} else {
+				p.text.WriteString(rest[:n])
+			}
+			p.pos += n
+		case strings.HasPrefix(rest, "~~"):
+			p.fail(p.pos, "strikethrough is not supported")
+			p.pos += 2
+		case c == '@' && p.atBoundary(p.pos) && p.parseMention():
+		case c == '#' && p.atBoundary(p.pos) && p.parseTag():
+		case c == 'h' && p.atBoundary(p.pos) && p.parseBareURL():
+		default:
+			_, size := utf8.DecodeRuneInString(rest)
+			p.text.WriteString(rest[:size])
+			p.pos += size
+		}
+	}
+	p.flush()
+}
+
+// parseLink parses an inline link of the form [label](url)
+func (p *mdParser) parseLink() bool {
+	var label strings.Builder
+	i := p.pos + 1
+	for ; i < len(p.src) && p.src[i] != ']'; i++ {
+		switch {
+		case p.src[i] == '\\' && i+1 < len(p.src) && isASCIIPunct(p.src[i+1]):
+			i++
+			label.WriteByte(p.src[i])
+		case p.src[i] == '[' || p.src[i] == '\n':
+			return false
+		default:
+			label.WriteByte(p.src[i])
+		}
+	}
+	if i+1 >= len(p.src) || p.src[i+1] != '(' {
+		return false
+	}
+
+	start := i + 2
+	depth := 0
+	end := -1
+	for j := start; j < len(p.src) && end < 0; j++ {
+		switch p.src[j] {
+		case '(':
+			depth++
+		case ')':
+			if depth == 0 {
+				end = j
+			}
+			depth--
+		case ' ', '\n':
+			return false
+		}
+	}
+	if end < 0 || label.Len() == 0 {
+		return false
+	}
+
+	p.emit(linkToken(label.String(), p.src[start:end]))
+	p.pos = end + 1
+	return true
+}
+
+// linkToken creates the token for a link. Links to Bluesky profiles and
+// hashtags labelled with @ or # become mentions and tags, which is how
+// RenderMarkdown writes them.
+func linkToken(label, uri string) mdToken {
+	if m := profileLinkRegex.FindStringSubmatch(uri); m != nil && strings.HasPrefix(label, "@") {
+		return mdToken{ftype: models.FacetMention, text: strings.TrimPrefix(label, "@"), value: m[1]}
+	}
+	if m := hashtagLinkRegex.FindStringSubmatch(uri); m != nil && strings.HasPrefix(label, "#") {
+		if tag, err := url.PathUnescape(m[1]); err == nil {
+			return mdToken{ftype: models.FacetTag, text: label, value: tag}
+		}
+	}
+	return mdToken{ftype: models.FacetLink, text: label, value: uri}
+}
+
+// parseAutolink parses a link of the form <https://example.com>
+func (p *mdParser) parseAutolink() bool {
+	end := strings.IndexAny(p.src[p.pos:], "> \n")
+	if end < 0 || p.src[p.pos+end] != '>' {
+		return false
+	}
+	uri := p.src[p.pos+1 : p.pos+end]
+	if validateURL(uri) != nil {
+		return false
+	}
+	p.emit(mdToken{ftype: models.FacetLink, text: uri, value: uri})
+	p.pos += end + 1
+	return true
+}
+
+// parseBareURL parses a URL written directly in the text. Incomplete URLs,
+// such as a lone "https://", are left as plain text.
+func (p *mdParser) parseBareURL() bool {
+	uri := bareURLRegex.FindString(p.src[p.pos:])
+	// Trailing punctuation belongs to the sentence, not the URL
+	uri = strings.TrimRight(uri, ".,;:!?)'\"")
+	if validateURL(uri) != nil {
+		return false
+	}
+	p.emit(mdToken{ftype: models.FacetLink, text: uri, value: uri})
+	p.pos += len(uri)
+	return true
+}
+
+// parseMention parses a mention of the form @handle
+func (p *mdParser) parseMention() bool {
+	end := p.pos + 1
+	for end < len(p.src) {
+		r, size := utf8.DecodeRuneInString(p.src[end:])
+		if !unicode.IsLetter(r) && !unicode.IsNumber(r) && r != '-' && r != '_' && r != '.' {
+			break
+		}
+		end += size
+	}
+	handle := strings.TrimRight(p.src[p.pos+1:end], ".")
+	if handle == "" {
+		return false
+	}
+	p.emit(mdToken{ftype: models.FacetMention, text: handle})
+	p.pos += len(handle) + 1
+	return true
+}
+
+// parseTag parses a hashtag of the form #tag
+func (p *mdParser) parseTag() bool {
+	end := p.pos + 1
+	for end < len(p.src) {
+		r, size := utf8.DecodeRuneInString(p.src[end:])
+		if !unicode.IsLetter(r) && !unicode.IsNumber(r) && r != '-' && r != '_' {
+			break
+		}
+		end += size
+	}
+	if end == p.pos+1 {
+		return false
+	}
+	tag := p.src[p.pos:end]
+	p.emit(mdToken{ftype: models.FacetTag, text: tag, value: tag[1:]})
+	p.pos = end
+	return true
+}
+
+func isASCIIPunct(c byte) bool {
+	return c < utf8.RuneSelf && unicode.IsPunct(rune(c)) || strings.IndexByte("$+<=>^`|~", c) >= 0
+}
+
+func isPunctRune(r rune) bool {
+	return unicode.IsPunct(r) || unicode.IsSymbol(r)
+}
+
+// AddMarkdown parses a subset of Markdown and adds the result to the post.
+// Supported syntax is inline links ([label](url) and <url>), bare URLs,
+// mentions (@handle), hashtags (#tag) and backslash escapes. Mentions are
+// resolved using the builder's MentionResolver, like AddMention. Any other
+// Markdown, such as emphasis, headings or code, is reported as a MarkdownError.
+//
+// Segments added by AddMarkdown are joined exactly as written, regardless of
+// the builder's JoinStrategy.
+//
+// Example:
+//
+//	builder.AddMarkdown("Release notes are [on the blog](https://example.com) #golang")
+func (b *Builder) AddMarkdown(md string) *Builder {
+	if b.err != nil {
+		return b
+	}
+
+	tokens, err := parseMarkdown(md)
+	if err != nil {
+		b.err = err
+		return b
+	}
+
+	first := len(b.segments)
+	for _, tok := range tokens {
+		switch tok.ftype {
+		case models.FacetLink:
+			b.AddLink(tok.text, tok.value)
+		case models.FacetMention:
+			b.AddMention(tok.text, tok.value)
+		case models.FacetTag:
+			b.addTag(tok.text, tok.value)
+		default:
+			if err := b.validatePostLength(tok.text); err != nil {
+				b.err = err
+			} else {
+				b.segments = append(b.segments, segment{text: tok.text})
+			}
+		}
+		if b.err != nil {
+			return b
+		}
+	}
+
+	for i := first + 1; i < len(b.segments); i++ {
+		b.segments[i].attached = true
+	}
+	return b
+}
+
+// ParseMarkdown builds a post from a Markdown template using a new Builder
+// configured with opts. See Builder.AddMarkdown for the supported syntax.
+func ParseMarkdown(md string, opts ...BuilderOption) (bsky.FeedPost, error) {
+	return NewBuilder(opts...).AddMarkdown(md).Build()
+}
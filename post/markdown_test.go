@@ -0,0 +1,148 @@
+package post
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAddMarkdown(t *testing.T) {
+	t.Run("links, mentions and tags", func(t *testing.T) {
+		post, err := NewBuilder(WithResolver(testResolver)).
+			AddMarkdown("Hey @carol.bsky.social, the [release notes](https://example.com/a_(b)) are out! #golang").
+			Build()
+
+		assert.NoError(t, err)
+		assert.Equal(t, "Hey @carol.bsky.social, the release notes are out! #golang", post.Text)
+		assert.Len(t, post.Facets, 3)
+
+		mention := post.Facets[0]
+		assert.Equal(t, int64(4), mention.Index.ByteStart)
+		assert.Equal(t, int64(22), mention.Index.ByteEnd)
+		assert.Equal(t, "did:plc:carol", mention.Features[0].RichtextFacet_Mention.Did)
+
+		link := post.Facets[1]
+		assert.Equal(t, "release notes", post.Text[link.Index.ByteStart:link.Index.ByteEnd])
+		assert.Equal(t, "https://example.com/a_(b)", link.Features[0].RichtextFacet_Link.Uri)
+
+		tag := post.Facets[2]
+		assert.Equal(t, "#golang", post.Text[tag.Index.ByteStart:tag.Index.ByteEnd])
+		assert.Equal(t, "golang", tag.Features[0].RichtextFacet_Tag.Tag)
+	})
+
+	t.Run("byte indexes with multi-byte text", func(t *testing.T) {
+		post, err := ParseMarkdown("Café ☕ [menu](https://example.com)")
+
+		assert.NoError(t, err)
+		assert.Len(t, post.Facets, 1)
+		facet := post.Facets[0]
+		assert.Equal(t, "menu", post.Text[facet.Index.ByteStart:facet.Index.ByteEnd])
+	})
+
+	t.Run("autolinks and bare URLs", func(t *testing.T) {
+		post, err := ParseMarkdown("See <https://a.example> and https://b.example/x.")
+
+		assert.NoError(t, err)
+		assert.Equal(t, "See https://a.example and https://b.example/x.", post.Text)
+		assert.Len(t, post.Facets, 2)
+		assert.Equal(t, "https://b.example/x", post.Facets[1].Features[0].RichtextFacet_Link.Uri)
+	})
+
+	t.Run("tag links keep their text", func(t *testing.T) {
+		post, err := ParseMarkdown("[#go](https://bsky.app/hashtag/golang) [#café](https://bsky.app/hashtag/caf%C3%A9)")
+
+		assert.NoError(t, err)
+		assert.Equal(t, "#go #café", post.Text)
+		assert.Len(t, post.Facets, 2)
+		tag := post.Facets[0]
+		assert.Equal(t, "#go", post.Text[tag.Index.ByteStart:tag.Index.ByteEnd])
+		assert.Equal(t, "golang", tag.Features[0].RichtextFacet_Tag.Tag)
+		assert.Equal(t, "café", post.Facets[1].Features[0].RichtextFacet_Tag.Tag)
+	})
+
+	t.Run("incomplete bare URLs are plain text", func(t *testing.T) {
+		post, err := ParseMarkdown("broken link https://")
+
+		assert.NoError(t, err)
+		assert.Equal(t, "broken link https://", post.Text)
+		assert.Empty(t, post.Facets)
+
+		post, err = ParseMarkdown("see https:// and https://x.com now")
+
+		assert.NoError(t, err)
+		assert.Equal(t, "see https:// and https://x.com now", post.Text)
+		assert.Len(t, post.Facets, 1)
+		link := post.Facets[0]
+		assert.Equal(t, "https://x.com", post.Text[link.Index.ByteStart:link.Index.ByteEnd])
+		assert.Equal(t, "https://x.com", link.Features[0].RichtextFacet_Link.Uri)
+	})
+
+	t.Run("escapes", func(t *testing.T) {
+		post, err := ParseMarkdown(`\*not bold\* \[x\] \#notatag \@nobody`)
+
+		assert.NoError(t, err)
+		assert.Equal(t, "*not bold* [x] #notatag @nobody", post.Text)
+		assert.Empty(t, post.Facets)
+	})
+
+	t.Run("asterisks and underscores outside emphasis", func(t *testing.T) {
+		post, err := ParseMarkdown("2 * 3 = 6, a ** b and snake_case_name")
+		assert.NoError(t, err)
+		assert.Equal(t, "2 * 3 = 6, a ** b and snake_case_name", post.Text)
+
+		for _, src := range []string{"*bold*", "some _italic_ text", "in**word**", "(*x*)"} {
+			_, err := ParseMarkdown(src)
+			assert.ErrorIs(t, err, ErrUnsupportedMarkdown, src)
+		}
+	})
+
+	t.Run("email addresses are not mentions", func(t *testing.T) {
+		post, err := ParseMarkdown("write to me@example.com")
+
+		assert.NoError(t, err)
+		assert.Empty(t, post.Facets)
+	})
+
+	t.Run("ignores join strategy", func(t *testing.T) {
+		post, err := NewBuilder(WithJoinStrategy(JoinWithSpaces)).
+			AddText("Intro").
+			AddMarkdown("[a](https://a.example), [b](https://b.example)").
+			Build()
+
+		assert.NoError(t, err)
+		assert.Equal(t, "Intro a, b", post.Text)
+	})
+
+	t.Run("round trips rendered markdown", func(t *testing.T) {
+		original, err := NewBuilder().
+			AddText("Hi ").
+			AddMention("alice", "did:plc:alice").
+			AddText(" (see ").
+			AddLink("docs", "https://example.com").
+			AddText(") ").
+			AddTag("go").
+			Build()
+		assert.NoError(t, err)
+
+		parsed, err := ParseMarkdown(RenderFeedPostMarkdown(&original))
+		assert.NoError(t, err)
+		assert.Equal(t, original.Text, parsed.Text)
+		assert.Equal(t, original.Facets, parsed.Facets)
+	})
+
+	t.Run("reports unsupported syntax", func(t *testing.T) {
+		_, err := ParseMarkdown("# Title\nSome **bold** and `code`\n![img](https://example.com/a.png)")
+
+		assert.ErrorIs(t, err, ErrUnsupportedMarkdown)
+
+		var mdErr *MarkdownError
+		assert.True(t, errors.As(err, &mdErr))
+		assert.Equal(t, 1, mdErr.Line)
+		assert.Equal(t, 1, mdErr.Column)
+
+		assert.Contains(t, err.Error(), "line 2, column 6: emphasis")
+		assert.Contains(t, err.Error(), "line 2, column 19: inline code")
+		assert.Contains(t, err.Error(), "line 3, column 1: images")
+	})
+}
@@ -31,6 +31,15 @@ type Post struct {
 	// Reply
 	ReplyUri string
 	ReplyRef *bsky.FeedPost_ReplyRef
+
+	// Hydrated views, set when the post comes from the AppView
+	IndexedAt string
+	// ModerationLabels are the labels applied to the post by labelers
+	ModerationLabels []ModerationLabel
+	Author           *Author
+	Viewer           *Viewer
+	Reason           *Reason
+	ReplyContext     *ReplyContext
 }
 
 // Uri returns the AT URI for the post
@@ -71,44 +80,31 @@ func (p *Post) HasTag(tag string) bool {
 	return false
 }
 
-// PostsFromGetPostsResponse converts a bsky.FeedGetPosts_Output to a slice of Post
-func PostsFromGetPostsResponse(resp *bsky.FeedGetPosts_Output) (posts []*Post, err error) {
-	for _, post := range resp.Posts {
-		feedPost, ok := post.Record.Val.(*bsky.FeedPost)
-		if !ok {
-			return nil, fmt.Errorf("unexpected record type: %T", post.Record.Val)
+// HasModerationLabel returns true if a labeler applied the given label to the
+// post and didn't later negate it
+func (p *Post) HasModerationLabel(val string) bool {
+	applied := make(map[string]bool)
+	for _, label := range p.ModerationLabels {
+		if label.Val == val {
+			applied[label.Src] = !label.Neg
 		}
-
-		// Extract labels
-		var labels []string
-		if feedPost.Labels != nil && feedPost.Labels.LabelDefs_SelfLabels != nil {
-			for _, label := range feedPost.Labels.LabelDefs_SelfLabels.Values {
-				labels = append(labels, label.Val)
-			}
+	}
+	for _, ok := range applied {
+		if ok {
+			return true
 		}
+	}
+	return false
+}
 
-		embed, err := ExtractEmbedFromFeedPost(feedPost)
+// PostsFromGetPostsResponse converts a bsky.FeedGetPosts_Output to a slice of Post
+func PostsFromGetPostsResponse(resp *bsky.FeedGetPosts_Output) (posts []*Post, err error) {
+	for _, view := range resp.Posts {
+		post, err := PostFromFeedDefs_PostView(view)
 		if err != nil {
 			return nil, err
 		}
-
-		replyUri := ""
-		if feedPost.Reply != nil && feedPost.Reply.Root != nil {
-			replyUri = feedPost.Reply.Root.Uri
-		}
-
-		posts = append(posts, &Post{
-			Text:      feedPost.Text,
-			CreatedAt: feedPost.CreatedAt,
-			Embed:     embed,
-			Facets:    ExtractFacetsFromFeedPost(feedPost),
-			Labels:    labels,
-			Langs:     feedPost.Langs,
-			Tags:      feedPost.Tags,
-			ReplyUri:  replyUri,
-			ReplyRef:  feedPost.Reply,
-			Cid:       post.Cid,
-		})
+		posts = append(posts, post)
 	}
 	return
 }
@@ -133,6 +129,21 @@ func PostFromFeedDefs_PostView(post *bsky.FeedDefs_PostView) (*Post, error) {
 	extracted.Repo = repo
 	extracted.Rkey = rkey
 	extracted.Cid = post.Cid
+	extracted.Author = AuthorFromProfileViewBasic(post.Author)
+	extracted.Viewer = viewerFromViewerState(post.Viewer)
+	extracted.IndexedAt = post.IndexedAt
+	extracted.ModerationLabels = moderationLabels(post.Labels)
+
+	count := func(n *int64) int64 {
+		if n == nil {
+			return 0
+		}
+		return *n
+	}
+	extracted.Likes = count(post.LikeCount)
+	extracted.Quotes = count(post.QuoteCount)
+	extracted.Replies = count(post.ReplyCount)
+	extracted.Reposts = count(post.RepostCount)
 
 	return extracted, nil
 }
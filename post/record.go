@@ -0,0 +1,386 @@
+package post
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/bluesky-social/indigo/api/atproto"
+	"github.com/bluesky-social/indigo/api/bsky"
+	lexutil "github.com/bluesky-social/indigo/lex/util"
+	"github.com/ipfs/go-cid"
+	"github.com/watzon/lining/models"
+)
+
+// ToFeedPost converts the post back into an app.bsky.feed.post record,
+// reconstructing its text, facets, embed, self-labels, languages, tags and
+// reply references. Blobs in the embed keep referencing the original post's
+// repo; use NewBuilderFromPost with WithReuploadedBlobs to copy a post to
+// another account.
+//
+// CreatedAt is left empty, so that PostToFeed stamps the record with the time
+// it is published again. Only set it to p.CreatedAt when retrying the write of
+// this very post under its original record key.
+//
+// Example:
+//
+//	record, err := p.ToFeedPost()
+//	record.Text = strings.ReplaceAll(record.Text, "teh", "the")
+//	_, _, err = client.PostToFeed(ctx, record)
+func (p *Post) ToFeedPost() (bsky.FeedPost, error) {
+	record := bsky.FeedPost{
+		LexiconTypeID: "app.bsky.feed.post",
+		Text:          p.Text,
+		Facets:        richtextFacets(p.Facets),
+		Langs:         p.Langs,
+		Tags:          p.Tags,
+		Reply:         p.ReplyRef,
+	}
+
+	if len(p.Labels) > 0 {
+		values := make([]*atproto.LabelDefs_SelfLabel, len(p.Labels))
+		for i, label := range p.Labels {
+			values[i] = &atproto.LabelDefs_SelfLabel{Val: label}
+		}
+		record.Labels = &bsky.FeedPost_Labels{
+			LabelDefs_SelfLabels: &atproto.LabelDefs_SelfLabels{
+				LexiconTypeID: "com.atproto.label.defs#selfLabels",
+				Values:        values,
+			},
+		}
+	}
+
+	if p.Embed != nil {
+		embed, err := p.Embed.feedPostEmbed()
+		if err != nil {
+			return bsky.FeedPost{}, err
+		}
+		record.Embed = embed
+	}
+
+	return record, nil
+}
+
+// richtextFacets converts facets back into the record format. Facets covering
+// the same range are merged into a single facet with several features, which
+// is how ExtractFacetsFromFeedPost splits them up.
+func richtextFacets(facets []Facet) []*bsky.RichtextFacet {
+	var out []*bsky.RichtextFacet
+	for _, f := range facets {
+		feature := &bsky.RichtextFacet_Features_Elem{}
+		switch {
+		case f.Type.FacetTypeLink != nil:
+			feature.RichtextFacet_Link = &bsky.RichtextFacet_Link{
+				LexiconTypeID: models.FacetLink.String(),
+				Uri:           f.Type.FacetTypeLink.Uri,
+			}
+		case f.Type.FacetTypeMention != nil:
+			feature.RichtextFacet_Mention = &bsky.RichtextFacet_Mention{
+				LexiconTypeID: models.FacetMention.String(),
+				Did:           f.Type.FacetTypeMention.Did,
+			}
+		case f.Type.FacetTypeTag != nil:
+			feature.RichtextFacet_Tag = &bsky.RichtextFacet_Tag{
+				LexiconTypeID: models.FacetTag.String(),
+				Tag:           f.Type.FacetTypeTag.Tag,
+			}
+		default:
+			continue
+		}
+
+		if n := len(out); n > 0 && out[n-1].Index.ByteStart == f.Index.ByteStart && out[n-1].Index.ByteEnd == f.Index.ByteEnd {
+			out[n-1].Features = append(out[n-1].Features, feature)
+			continue
+		}
+		out = append(out, &bsky.RichtextFacet{
+			Index: &bsky.RichtextFacet_ByteSlice{
+				ByteStart: f.Index.ByteStart,
+				ByteEnd:   f.Index.ByteEnd,
+			},
+			Features: []*bsky.RichtextFacet_Features_Elem{feature},
+		})
+	}
+	return out
+}
+
+// blobFromRef rebuilds a blob reference from its CID string
+func blobFromRef(ref, mimeType string, size int64) (*lexutil.LexBlob, error) {
+	c, err := cid.Decode(ref)
+	if err != nil {
+		return nil, fmt.Errorf("invalid blob reference %q: %w", ref, err)
+	}
+	return &lexutil.LexBlob{
+		Ref:      lexutil.LexLink(c),
+		MimeType: mimeType,
+		Size:     size,
+	}, nil
+}
+
+func aspectRatio(ratio *AspectRatio) *bsky.EmbedDefs_AspectRatio {
+	if ratio == nil {
+		return nil
+	}
+	return &bsky.EmbedDefs_AspectRatio{Width: ratio.Width, Height: ratio.Height}
+}
+
+func imagesEmbed(images []*EmbedImage) (*bsky.EmbedImages, error) {
+	out := &bsky.EmbedImages{
+		LexiconTypeID: "app.bsky.embed.images",
+		Images:        make([]*bsky.EmbedImages_Image, len(images)),
+	}
+	for i, img := range images {
+		blob, err := blobFromRef(img.Ref, img.MimeType, img.Size)
+		if err != nil {
+			return nil, err
+		}
+		out.Images[i] = &bsky.EmbedImages_Image{
+			Alt:         img.Alt,
+			AspectRatio: aspectRatio(img.AspectRatio),
+			Image:       blob,
+		}
+	}
+	return out, nil
+}
+
+func videoEmbed(video *EmbedVideo) (*bsky.EmbedVideo, error) {
+	blob, err := blobFromRef(video.Ref, video.MimeType, video.Size)
+	if err != nil {
+		return nil, err
+	}
+	out := &bsky.EmbedVideo{
+		LexiconTypeID: "app.bsky.embed.video",
+		AspectRatio:   aspectRatio(video.AspectRatio),
+		Video:         blob,
+	}
+	if video.Alt != "" {
+		alt := video.Alt
+		out.Alt = &alt
+	}
+	for _, caption := range video.Captions {
+		file, err := blobFromRef(caption.Ref, caption.MimeType, caption.Size)
+		if err != nil {
+			return nil, err
+		}
+		out.Captions = append(out.Captions, &bsky.EmbedVideo_Caption{File: file, Lang: caption.Lang})
+	}
+	return out, nil
+}
+
+func externalEmbed(external *EmbedExternal) (*bsky.EmbedExternal, error) {
+	out := &bsky.EmbedExternal{
+		LexiconTypeID: "app.bsky.embed.external",
+		External: &bsky.EmbedExternal_External{
+			Description: external.Description,
+			Title:       external.Title,
+			Uri:         external.Uri,
+		},
+	}
+	if external.ThumbRef != "" {
+		thumb, err := blobFromRef(external.ThumbRef, external.ThumbMimeType, external.ThumbSize)
+		if err != nil {
+			return nil, err
+		}
+		out.External.Thumb = thumb
+	}
+	return out, nil
+}
+
+func recordEmbed(record *EmbedRecord) *bsky.EmbedRecord {
+	return &bsky.EmbedRecord{
+		LexiconTypeID: "app.bsky.embed.record",
+		Record:        &atproto.RepoStrongRef{Cid: record.Cid, Uri: record.Uri},
+	}
+}
+
+// feedPostEmbed converts the embed back into the record format. It returns
+// nil if the embed is empty.
+func (e *Embed) feedPostEmbed() (*bsky.FeedPost_Embed, error) {
+	var err error
+	out := &bsky.FeedPost_Embed{}
+	switch {
+	case len(e.Images) > 0:
+		out.EmbedImages, err = imagesEmbed(e.Images)
+	case e.Video != nil:
+		out.EmbedVideo, err = videoEmbed(e.Video)
+	case e.External != nil:
+		out.EmbedExternal, err = externalEmbed(e.External)
+	case e.Record != nil:
+		out.EmbedRecord = recordEmbed(e.Record)
+	case e.RecordWithMedia != nil:
+		if e.RecordWithMedia.Record == nil || e.RecordWithMedia.Media == nil {
+			return nil, errors.New("record with media embed must have both a record and media")
+		}
+		media := &bsky.EmbedRecordWithMedia_Media{}
+		switch m := e.RecordWithMedia.Media; {
+		case len(m.Images) > 0:
+			media.EmbedImages, err = imagesEmbed(m.Images)
+		case m.Video != nil:
+			media.EmbedVideo, err = videoEmbed(m.Video)
+		case m.External != nil:
+			media.EmbedExternal, err = externalEmbed(m.External)
+		default:
+			return nil, errors.New("record with media embed has no media")
+		}
+		out.EmbedRecordWithMedia = &bsky.EmbedRecordWithMedia{
+			LexiconTypeID: "app.bsky.embed.recordWithMedia",
+			Media:         media,
+			Record:        recordEmbed(e.RecordWithMedia.Record),
+		}
+	default:
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// NewBuilderFromPost creates a builder pre-populated with the text, facets,
+// embed, self-labels, languages, tags and reply references of an existing
+// post, so that it can be edited and published again, or copied to another
+// account. Facets that overlap earlier ones are dropped.
+//
+// Embedded blobs keep referencing the original post's repo. A PDS only
+// accepts blobs that were uploaded to it, so when publishing from a different
+// account, call WithReuploadedBlobs to copy them over.
+//
+// Example:
+//
+//	builder, err := post.NewBuilderFromPost(p)
+//	if err != nil {
+//	    return err
+//	}
+//	record, err := builder.
+//	    AddText(" (reposted)").
+//	    WithReuploadedBlobs(client).
+//	    Build()
+func NewBuilderFromPost(p *Post, opts ...BuilderOption) (*Builder, error) {
+	if p == nil {
+		return nil, errors.New("post cannot be nil")
+	}
+
+	b := NewBuilder(opts...)
+	for i, s := range splitFacets(p.Text, p.Facets) {
+		seg := segment{text: s.text, attached: i > 0}
+		if s.facet != nil {
+			switch {
+			case s.facet.Type.FacetTypeLink != nil:
+				seg.facet = &models.Facet{Type: models.FacetLink, Value: s.facet.Type.FacetTypeLink.Uri, Text: s.text}
+			case s.facet.Type.FacetTypeMention != nil:
+				seg.facet = &models.Facet{Type: models.FacetMention, Value: s.facet.Type.FacetTypeMention.Did, Text: s.text}
+			case s.facet.Type.FacetTypeTag != nil:
+				seg.facet = &models.Facet{Type: models.FacetTag, Value: s.facet.Type.FacetTypeTag.Tag, Text: s.text}
+			}
+		}
+		b.segments = append(b.segments, seg)
+	}
+
+	if p.ReplyRef != nil {
+		b.WithReply(p.ReplyRef)
+	}
+	b.WithLabels(p.Labels...)
+	b.WithLangs(p.Langs...)
+	b.WithTags(p.Tags...)
+	if b.err != nil {
+		return nil, b.err
+	}
+
+	if p.Embed != nil {
+		embed, err := p.Embed.feedPostEmbed()
+		if err != nil {
+			return nil, err
+		}
+		b.sourceEmbed = embed
+		b.sourceRepo = p.Repo
+	}
+
+	return b, nil
+}
+
+// BlobCopier downloads blobs from a repo and uploads them to the account's
+// own repo. The client.BskyClient type satisfies this interface.
+type BlobCopier interface {
+	DownloadBlob(ctx context.Context, cid string, did string) ([]byte, string, error)
+	UploadBlob(ctx context.Context, data []byte, mimeType string) (*lexutil.LexBlob, error)
+}
+
+// WithReuploadedBlobs makes Resolve download every blob embedded in a post
+// copied with NewBuilderFromPost and upload it again with its original MIME
+// type, so the post can be published from another account. Images, videos,
+// captions and link card thumbnails are all copied.
+func (b *Builder) WithReuploadedBlobs(copier BlobCopier) *Builder {
+	if b.err != nil {
+		return b
+	}
+	if b.sourceEmbed != nil && b.sourceRepo == "" {
+		b.err = errors.New("the source post's repo is required to re-upload blobs")
+		return b
+	}
+	b.pending.reupload = copier
+	return b
+}
+
+// sourceBlobs returns every blob in the copied embed
+func (b *Builder) sourceBlobs() []*lexutil.LexBlob {
+	var blobs []*lexutil.LexBlob
+	addImages := func(images *bsky.EmbedImages) {
+		for _, img := range images.Images {
+			blobs = append(blobs, img.Image)
+		}
+	}
+	addVideo := func(video *bsky.EmbedVideo) {
+		blobs = append(blobs, video.Video)
+		for _, caption := range video.Captions {
+			blobs = append(blobs, caption.File)
+		}
+	}
+	addExternal := func(external *bsky.EmbedExternal) {
+		if external.External.Thumb != nil {
+			blobs = append(blobs, external.External.Thumb)
+		}
+	}
+
+	embed := b.sourceEmbed
+	if embed == nil {
+		return nil
+	}
+	switch {
+	case embed.EmbedImages != nil:
+		addImages(embed.EmbedImages)
+	case embed.EmbedVideo != nil:
+		addVideo(embed.EmbedVideo)
+	case embed.EmbedExternal != nil:
+		addExternal(embed.EmbedExternal)
+	case embed.EmbedRecordWithMedia != nil:
+		media := embed.EmbedRecordWithMedia.Media
+		switch {
+		case media.EmbedImages != nil:
+			addImages(media.EmbedImages)
+		case media.EmbedVideo != nil:
+			addVideo(media.EmbedVideo)
+		case media.EmbedExternal != nil:
+			addExternal(media.EmbedExternal)
+		}
+	}
+	return blobs
+}
+
+// reuploadBlob downloads a blob from the source repo and uploads it again,
+// replacing the reference in place. The MIME type recorded in the post wins
+// over the one sniffed from the downloaded data, which can't tell captions
+// (text/vtt) from plain text.
+func (b *Builder) reuploadBlob(ctx context.Context, copier BlobCopier, blob *lexutil.LexBlob) error {
+	data, mimeType, err := copier.DownloadBlob(ctx, blob.Ref.String(), b.sourceRepo)
+	if err != nil {
+		return fmt.Errorf("failed to download blob: %w", err)
+	}
+	if blob.MimeType != "" {
+		mimeType = blob.MimeType
+	}
+	uploaded, err := copier.UploadBlob(ctx, data, mimeType)
+	if err != nil {
+		return fmt.Errorf("failed to upload blob: %w", err)
+	}
+	*blob = *uploaded
+	return nil
+}
@@ -0,0 +1,204 @@
+package post
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/bluesky-social/indigo/api/bsky"
+	lexutil "github.com/bluesky-social/indigo/lex/util"
+	"github.com/ipfs/go-cid"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	testBlobCid  = "bafkreie5737gdxlw5i64vzichcalba3z2v5n6icifvx5xytvske7mr3hpm"
+	otherBlobCid = "bafkreibme22gw2h7y2h7tg2fhqotaqjucnbc24deqo72b6mkl2egezxhvy"
+)
+
+// fakeCopier serves blob data for any CID, sniffed as plain text, and records
+// the downloads and the MIME types of the uploads
+type fakeCopier struct {
+	mu        sync.Mutex
+	requests  []string
+	mimeTypes []string
+	err       error
+}
+
+func (f *fakeCopier) DownloadBlob(ctx context.Context, cid string, did string) ([]byte, string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return nil, "", f.err
+	}
+	f.requests = append(f.requests, did+"/"+cid)
+	return []byte("blob " + cid), "text/plain; charset=utf-8", nil
+}
+
+func (f *fakeCopier) UploadBlob(ctx context.Context, data []byte, mimeType string) (*lexutil.LexBlob, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.mimeTypes = append(f.mimeTypes, mimeType)
+	ref, _ := cid.Decode(otherBlobCid)
+	return &lexutil.LexBlob{Ref: lexutil.LexLink(ref), MimeType: mimeType, Size: int64(len(data))}, nil
+}
+
+// testRecords are post records that should survive a round trip through Post
+var testRecords = map[string]string{
+	"quote with images": `{
+		"$type": "app.bsky.feed.post",
+		"text": "Hello @alice.bsky.social, see #golang and example.com",
+		"createdAt": "2024-01-01T00:00:00Z",
+		"facets": [
+			{"index": {"byteStart": 6, "byteEnd": 24}, "features": [{"$type": "app.bsky.richtext.facet#mention", "did": "did:plc:alice"}]},
+			{"index": {"byteStart": 30, "byteEnd": 37}, "features": [
+				{"$type": "app.bsky.richtext.facet#tag", "tag": "golang"},
+				{"$type": "app.bsky.richtext.facet#link", "uri": "https://go.dev"}
+			]},
+			{"index": {"byteStart": 42, "byteEnd": 53}, "features": [{"$type": "app.bsky.richtext.facet#link", "uri": "https://example.com"}]}
+		],
+		"embed": {
+			"$type": "app.bsky.embed.recordWithMedia",
+			"record": {"$type": "app.bsky.embed.record", "record": {"uri": "at://did:plc:bob/app.bsky.feed.post/quoted", "cid": "cid-quoted"}},
+			"media": {"$type": "app.bsky.embed.images", "images": [
+				{"alt": "A cat", "aspectRatio": {"width": 4, "height": 3}, "image": {"$type": "blob", "ref": {"$link": "` + testBlobCid + `"}, "mimeType": "image/jpeg", "size": 1234}}
+			]}
+		},
+		"labels": {"$type": "com.atproto.label.defs#selfLabels", "values": [{"val": "graphic-media"}]},
+		"langs": ["en", "pt-BR"],
+		"tags": ["extra"],
+		"reply": {
+			"root": {"uri": "at://did:plc:bob/app.bsky.feed.post/root", "cid": "cid-root"},
+			"parent": {"uri": "at://did:plc:bob/app.bsky.feed.post/parent", "cid": "cid-parent"}
+		}
+	}`,
+	"video with captions": `{
+		"$type": "app.bsky.feed.post",
+		"text": "Watch this",
+		"createdAt": "2024-01-01T00:00:00Z",
+		"embed": {"$type": "app.bsky.embed.video", "alt": "A video", "video": {"$type": "blob", "ref": {"$link": "` + testBlobCid + `"}, "mimeType": "video/mp4", "size": 99},
+			"captions": [{"lang": "en", "file": {"$type": "blob", "ref": {"$link": "` + otherBlobCid + `"}, "mimeType": "text/vtt", "size": 12}}]}
+	}`,
+	"link card": `{
+		"$type": "app.bsky.feed.post",
+		"text": "Read this",
+		"createdAt": "2024-01-01T00:00:00Z",
+		"embed": {"$type": "app.bsky.embed.external", "external": {"uri": "https://example.com", "title": "Example", "description": "An example",
+			"thumb": {"$type": "blob", "ref": {"$link": "` + testBlobCid + `"}, "mimeType": "image/png", "size": 55}}}
+	}`,
+}
+
+func TestPostToFeedPost(t *testing.T) {
+	for name, raw := range testRecords {
+		t.Run(name, func(t *testing.T) {
+			var original bsky.FeedPost
+			assert.NoError(t, json.Unmarshal([]byte(raw), &original))
+
+			p, err := PostFromFeedPost(&original, "did:plc:bob", "3kabc")
+			assert.NoError(t, err)
+
+			record, err := p.ToFeedPost()
+			assert.NoError(t, err)
+			assert.Empty(t, record.CreatedAt)
+
+			original.CreatedAt = ""
+			want, _ := json.Marshal(&original)
+			got, _ := json.Marshal(&record)
+			assert.JSONEq(t, string(want), string(got))
+		})
+	}
+
+	t.Run("invalid blob reference", func(t *testing.T) {
+		p := &Post{Text: "hi", Embed: &Embed{Images: []*EmbedImage{{Ref: "not-a-cid"}}}}
+		_, err := p.ToFeedPost()
+		assert.Error(t, err)
+	})
+}
+
+func TestNewBuilderFromPost(t *testing.T) {
+	var original bsky.FeedPost
+	assert.NoError(t, json.Unmarshal([]byte(testRecords["quote with images"]), &original))
+	p, err := PostFromFeedPost(&original, "did:plc:bob", "3kabc")
+	assert.NoError(t, err)
+
+	t.Run("copies the post", func(t *testing.T) {
+		builder, err := NewBuilderFromPost(p)
+		assert.NoError(t, err)
+
+		record, err := builder.Build()
+		assert.NoError(t, err)
+		assert.Equal(t, original.Text, record.Text)
+		assert.Equal(t, original.Langs, record.Langs)
+		assert.Equal(t, original.Tags, record.Tags)
+		assert.Equal(t, original.Labels, record.Labels)
+		assert.Equal(t, original.Reply, record.Reply)
+		assert.Equal(t, original.Embed, record.Embed)
+
+		// The second feature of the overlapping tag/link facet is dropped
+		assert.Len(t, record.Facets, 3)
+		assert.Equal(t, "did:plc:alice", record.Facets[0].Features[0].RichtextFacet_Mention.Did)
+		assert.Equal(t, "golang", record.Facets[1].Features[0].RichtextFacet_Tag.Tag)
+		assert.Equal(t, original.Facets[2].Index, record.Facets[2].Index)
+	})
+
+	t.Run("edits the copy", func(t *testing.T) {
+		builder, err := NewBuilderFromPost(p, WithJoinStrategy(JoinWithSpaces))
+		assert.NoError(t, err)
+
+		record, err := builder.AddText("(edited)").Build()
+		assert.NoError(t, err)
+		assert.Equal(t, original.Text+" (edited)", record.Text)
+	})
+
+	t.Run("re-uploads blobs", func(t *testing.T) {
+		copier := &fakeCopier{}
+		builder, err := NewBuilderFromPost(p)
+		assert.NoError(t, err)
+
+		record, err := builder.WithReuploadedBlobs(copier).Build()
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"did:plc:bob/" + testBlobCid}, copier.requests)
+		assert.Equal(t, []string{"image/jpeg"}, copier.mimeTypes)
+
+		image := record.Embed.EmbedRecordWithMedia.Media.EmbedImages.Images[0]
+		assert.Equal(t, "A cat", image.Alt)
+		assert.Equal(t, otherBlobCid, image.Image.Ref.String())
+		assert.Equal(t, int64(len("blob "+testBlobCid)), image.Image.Size)
+	})
+
+	t.Run("re-uploads videos with captions", func(t *testing.T) {
+		video := &Post{Text: "clip", Repo: "did:plc:bob", Embed: &Embed{Video: &EmbedVideo{
+			Alt:      "a clip",
+			Ref:      testBlobCid,
+			MimeType: "video/mp4",
+			Captions: []*EmbedVideoCaption{{Lang: "en", Ref: otherBlobCid, MimeType: "text/vtt"}},
+		}}}
+		copier := &fakeCopier{}
+		builder, err := NewBuilderFromPost(video)
+		assert.NoError(t, err)
+
+		record, err := builder.WithReuploadedBlobs(copier).Build()
+		assert.NoError(t, err)
+		assert.ElementsMatch(t, []string{"video/mp4", "text/vtt"}, copier.mimeTypes)
+		assert.Equal(t, "video/mp4", record.Embed.EmbedVideo.Video.MimeType)
+		assert.Equal(t, "text/vtt", record.Embed.EmbedVideo.Captions[0].File.MimeType)
+	})
+
+	t.Run("reports failed re-uploads", func(t *testing.T) {
+		builder, err := NewBuilderFromPost(p)
+		assert.NoError(t, err)
+
+		err = builder.WithReuploadedBlobs(&fakeCopier{err: errors.New("gone")}).Resolve(context.Background())
+		var resolveErr *ResolveError
+		assert.ErrorAs(t, err, &resolveErr)
+		assert.Equal(t, ResolveBlob, resolveErr.Op)
+		assert.Equal(t, testBlobCid, resolveErr.Target)
+	})
+
+	t.Run("rejects unknown labels", func(t *testing.T) {
+		_, err := NewBuilderFromPost(&Post{Text: "hi", Labels: []string{"spoiler"}})
+		assert.ErrorIs(t, err, ErrInvalidLabel)
+	})
+}
@@ -0,0 +1,374 @@
+package post
+
+import (
+	"html"
+	"net/url"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/bluesky-social/indigo/api/bsky"
+)
+
+// ANSI escape sequences used by RenderText
+const (
+	ansiReset     = "\x1b[0m"
+	ansiUnderline = "\x1b[4m"
+	ansiCyan      = "\x1b[36m"
+	ansiMagenta   = "\x1b[35m"
+)
+
+// RenderOptions configures how posts are rendered by RenderHTML,
+// RenderMarkdown and RenderText
+type RenderOptions struct {
+	// ProfileURL builds the URL a mention links to
+	ProfileURL func(did string) string
+	// TagURL builds the URL a hashtag links to
+	TagURL func(tag string) string
+	// ANSI enables terminal colors and underlines in RenderText
+	ANSI bool
+}
+
+// RenderOption is a function that configures a RenderOptions struct
+type RenderOption func(*RenderOptions)
+
+// WithProfileURL returns a RenderOption that sets how mention URLs are built
+func WithProfileURL(fn func(did string) string) RenderOption {
+	return func(opts *RenderOptions) {
+		opts.ProfileURL = fn
+	}
+}
+
+// WithTagURL returns a RenderOption that sets how hashtag URLs are built
+func WithTagURL(fn func(tag string) string) RenderOption {
+	return func(opts *RenderOptions) {
+		opts.TagURL = fn
+	}
+}
+
+// WithANSI returns a RenderOption that enables terminal styling in RenderText
+func WithANSI(enabled bool) RenderOption {
+	return func(opts *RenderOptions) {
+		opts.ANSI = enabled
+	}
+}
+
+// DefaultRenderOptions returns the default RenderOptions, which link mentions
+// and hashtags to bsky.app
+func DefaultRenderOptions() RenderOptions {
+	return RenderOptions{
+		ProfileURL: func(did string) string {
+			return "https://bsky.app/profile/" + url.PathEscape(did)
+		},
+		TagURL: func(tag string) string {
+			return "https://bsky.app/hashtag/" + url.PathEscape(tag)
+		},
+	}
+}
+
+// span is a piece of post text with at most one facet applied to it
+type span struct {
+	text  string
+	facet *Facet
+}
+
+// splitFacets splits text into spans according to facets. Facets with ranges
+// that are out of bounds, empty, not on UTF-8 boundaries or that overlap an
+// earlier facet are ignored, so the text is always rendered in full.
+func splitFacets(text string, facets []Facet) []span {
+	valid := make([]Facet, 0, len(facets))
+	for _, f := range facets {
+		start, end := f.Index.ByteStart, f.Index.ByteEnd
+		if start < 0 || end > int64(len(text)) || start >= end {
+			continue
+		}
+		if !utf8.RuneStart(text[start]) || (end < int64(len(text)) && !utf8.RuneStart(text[end])) {
+			continue
+		}
+		valid = append(valid, f)
+	}
+
+	sort.SliceStable(valid, func(i, j int) bool {
+		return valid[i].Index.ByteStart < valid[j].Index.ByteStart
+	})
+
+	var spans []span
+	var pos int64
+	for i := range valid {
+		f := &valid[i]
+		if f.Index.ByteStart < pos {
+			// Overlaps a facet we've already rendered
+			continue
+		}
+		if f.Index.ByteStart > pos {
+			spans = append(spans, span{text: text[pos:f.Index.ByteStart]})
+		}
+		spans = append(spans, span{text: text[f.Index.ByteStart:f.Index.ByteEnd], facet: f})
+		pos = f.Index.ByteEnd
+	}
+	if pos < int64(len(text)) {
+		spans = append(spans, span{text: text[pos:]})
+	}
+	return spans
+}
+
+// facetURL returns the URL a facet points to, or an empty string if it has
+// none or the URL isn't safe to link to
+func facetURL(f *Facet, opts RenderOptions) string {
+	switch {
+	case f.Type.FacetTypeLink != nil:
+		u, err := url.Parse(f.Type.FacetTypeLink.Uri)
+		if err != nil {
+			return ""
+		}
+		switch strings.ToLower(u.Scheme) {
+		case "http", "https", "mailto":
+			return u.String()
+		}
+		return ""
+	case f.Type.FacetTypeMention != nil && opts.ProfileURL != nil:
+		return opts.ProfileURL(f.Type.FacetTypeMention.Did)
+	case f.Type.FacetTypeTag != nil && opts.TagURL != nil:
+		return opts.TagURL(f.Type.FacetTypeTag.Tag)
+	}
+	return ""
+}
+
+func renderOptions(opts []RenderOption) RenderOptions {
+	options := DefaultRenderOptions()
+	for _, opt := range opts {
+		opt(&options)
+	}
+	return options
+}
+
+// RenderHTML renders the post text as escaped HTML, with links, mentions and
+// hashtags turned into anchors and newlines into <br> tags. Links with schemes
+// other than http, https and mailto are rendered as plain text.
+//
+// Example:
+//
+//	html := post.RenderHTML(p)
+//	// Hello <a href="https://bsky.app/profile/did:plc:alice">@alice</a>!
+func RenderHTML(p *Post, opts ...RenderOption) string {
+	return renderHTML(p.Text, p.Facets, renderOptions(opts))
+}
+
+// RenderMarkdown renders the post text as Markdown, with links, mentions and
+// hashtags turned into inline links. Markdown syntax characters in the text are
+// escaped so they show up literally.
+func RenderMarkdown(p *Post, opts ...RenderOption) string {
+	return renderMarkdown(p.Text, p.Facets, renderOptions(opts))
+}
+
+// RenderText renders the post text for display in a terminal. Links whose label
+// differs from their URL are followed by the URL in angle brackets, unless the
+// URL has an unsafe scheme. When ANSI styling is enabled, links are underlined
+// and mentions and hashtags are colored. Control characters other than
+// newlines and tabs, and the escape sequences they start, are replaced with
+// U+FFFD so that a post can't take over the terminal it's printed to.
+func RenderText(p *Post, opts ...RenderOption) string {
+	return renderText(p.Text, p.Facets, renderOptions(opts))
+}
+
+// RenderFeedPostHTML works like RenderHTML for a bsky.FeedPost
+func RenderFeedPostHTML(fp *bsky.FeedPost, opts ...RenderOption) string {
+	return renderHTML(fp.Text, ExtractFacetsFromFeedPost(fp), renderOptions(opts))
+}
+
+// RenderFeedPostMarkdown works like RenderMarkdown for a bsky.FeedPost
+func RenderFeedPostMarkdown(fp *bsky.FeedPost, opts ...RenderOption) string {
+	return renderMarkdown(fp.Text, ExtractFacetsFromFeedPost(fp), renderOptions(opts))
+}
+
+// RenderFeedPostText works like RenderText for a bsky.FeedPost
+func RenderFeedPostText(fp *bsky.FeedPost, opts ...RenderOption) string {
+	return renderText(fp.Text, ExtractFacetsFromFeedPost(fp), renderOptions(opts))
+}
+
+func renderHTML(text string, facets []Facet, opts RenderOptions) string {
+	var out strings.Builder
+	for _, s := range splitFacets(text, facets) {
+		escaped := strings.ReplaceAll(html.EscapeString(s.text), "\n", "<br>")
+		href := ""
+		if s.facet != nil {
+			href = facetURL(s.facet, opts)
+		}
+		if href == "" {
+			out.WriteString(escaped)
+			continue
+		}
+		out.WriteString(`<a href="`)
+		out.WriteString(html.EscapeString(href))
+		out.WriteString(`">`)
+		out.WriteString(escaped)
+		out.WriteString("</a>")
+	}
+	return out.String()
+}
+
+// markdownEscaper escapes characters with special meaning in Markdown
+var markdownEscaper = strings.NewReplacer(
+	`\`, `\\`,
+	"`", "\\`",
+	`*`, `\*`,
+	`_`, `\_`,
+	`[`, `\[`,
+	`]`, `\]`,
+	`(`, `\(`,
+	`)`, `\)`,
+	`<`, `\<`,
+	`>`, `\>`,
+	`#`, `\#`,
+	`~`, `\~`,
+	`|`, `\|`,
+)
+
+// markdownURLEscaper escapes characters that would end a Markdown link target
+var markdownURLEscaper = strings.NewReplacer(
+	` `, `%20`,
+	`(`, `%28`,
+	`)`, `%29`,
+	`<`, `%3C`,
+	`>`, `%3E`,
+)
+
+func renderMarkdown(text string, facets []Facet, opts RenderOptions) string {
+	var out strings.Builder
+	for _, s := range splitFacets(text, facets) {
+		escaped := markdownEscaper.Replace(s.text)
+		href := ""
+		if s.facet != nil {
+			href = facetURL(s.facet, opts)
+		}
+		if href == "" {
+			out.WriteString(escaped)
+			continue
+		}
+		out.WriteString("[")
+		out.WriteString(escaped)
+		out.WriteString("](")
+		out.WriteString(markdownURLEscaper.Replace(href))
+		out.WriteString(")")
+	}
+	return out.String()
+}
+
+func renderText(text string, facets []Facet, opts RenderOptions) string {
+	var out strings.Builder
+	for _, s := range splitFacets(text, facets) {
+		s.text = sanitizeTerminal(s.text)
+		switch {
+		case s.facet == nil:
+			out.WriteString(s.text)
+		case s.facet.Type.FacetTypeLink != nil:
+			uri := sanitizeTerminal(facetURL(s.facet, opts))
+			if uri == "" {
+				out.WriteString(s.text)
+				continue
+			}
+			if opts.ANSI {
+				out.WriteString(ansiUnderline + s.text + ansiReset)
+			} else {
+				out.WriteString(s.text)
+			}
+			if !linkLabelMatches(s.text, uri) {
+				out.WriteString(" <" + uri + ">")
+			}
+		case s.facet.Type.FacetTypeMention != nil && opts.ANSI:
+			out.WriteString(ansiCyan + s.text + ansiReset)
+		case s.facet.Type.FacetTypeTag != nil && opts.ANSI:
+			out.WriteString(ansiMagenta + s.text + ansiReset)
+		default:
+			out.WriteString(s.text)
+		}
+	}
+	return out.String()
+}
+
+// isTerminalControl reports whether r is a C0 or C1 control character other
+// than a newline or tab
+func isTerminalControl(r rune) bool {
+	return (r < 0x20 && r != '\n' && r != '\t') || (r >= 0x7f && r <= 0x9f)
+}
+
+// sanitizeTerminal replaces control characters, other than newlines and tabs,
+// with U+FFFD. Escape sequences are replaced as a whole, so that none of
+// their parameters are left behind.
+func sanitizeTerminal(s string) string {
+	if strings.IndexFunc(s, isTerminalControl) < 0 {
+		return s
+	}
+
+	var out strings.Builder
+	for i := 0; i < len(s); {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		i += size
+		if !isTerminalControl(r) {
+			out.WriteRune(r)
+			continue
+		}
+		out.WriteRune(utf8.RuneError)
+
+		switch {
+		case r == '\x1b' && i < len(s) && s[i] == '[', r == '\u009b':
+			// Control sequence: parameters and intermediates, then a final byte
+			if r == '\x1b' {
+				i++
+			}
+			for i < len(s) && s[i] >= 0x20 && s[i] <= 0x3f {
+				i++
+			}
+			if i < len(s) && s[i] >= 0x40 && s[i] <= 0x7e {
+				i++
+			}
+		case r == '\x1b' && i < len(s) && strings.IndexByte("]P_^X", s[i]) >= 0, r == '\u009d':
+			// Operating system command or other string, up to BEL or ST
+			if r == '\x1b' {
+				i++
+			}
+			end := strings.IndexAny(s[i:], "\a\x1b\u009c")
+			switch {
+			case end < 0:
+				i = len(s)
+			case strings.HasPrefix(s[i+end:], "\x1b\\"):
+				i += end + 2
+			case strings.HasPrefix(s[i+end:], "\u009c"):
+				i += end + len("\u009c")
+			case s[i+end] == '\a':
+				i += end + 1
+			default:
+				i += end
+			}
+		case r == '\x1b':
+			// Other escape sequences: intermediates, then a final byte
+			for i < len(s) && s[i] >= 0x20 && s[i] <= 0x2f {
+				i++
+			}
+			if i < len(s) && s[i] >= 0x30 && s[i] <= 0x7e {
+				i++
+			}
+		}
+	}
+	return out.String()
+}
+
+// linkLabelMatches reports whether label is the URL itself, possibly shortened
+// the way Bluesky clients display links (without the scheme, or truncated
+// with an ellipsis)
+func linkLabelMatches(label, uri string) bool {
+	if label == uri {
+		return true
+	}
+	bare := strings.TrimPrefix(strings.TrimPrefix(uri, "https://"), "http://")
+	if label == bare {
+		return true
+	}
+	if prefix, ok := strings.CutSuffix(label, "..."); ok {
+		return strings.HasPrefix(bare, prefix)
+	}
+	if prefix, ok := strings.CutSuffix(label, "…"); ok {
+		return strings.HasPrefix(bare, prefix)
+	}
+	return false
+}
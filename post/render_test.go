@@ -0,0 +1,117 @@
+package post
+
+import (
+	"testing"
+
+	"github.com/bluesky-social/indigo/api/bsky"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRender(t *testing.T) {
+	feedPost, err := NewBuilder().
+		AddText("Hi <").
+		AddMention("alice", "did:plc:alice").
+		AddText("> read ").
+		AddLink("the *docs*", "https://docs.bsky.app/a_(b)").
+		AddText(" or ").
+		AddURLLink("https://example.com").
+		AddText("\n").
+		AddTag("go").
+		Build()
+	assert.NoError(t, err)
+
+	p, err := PostFromFeedPost(&feedPost, "did:plc:me", "1")
+	assert.NoError(t, err)
+
+	t.Run("html", func(t *testing.T) {
+		assert.Equal(t,
+			`Hi &lt;<a href="https://bsky.app/profile/did:plc:alice">@alice</a>&gt; read `+
+				`<a href="https://docs.bsky.app/a_(b)">the *docs*</a> or `+
+				`<a href="https://example.com">https://example.com</a><br>`+
+				`<a href="https://bsky.app/hashtag/go">#go</a>`,
+			RenderHTML(p))
+	})
+
+	t.Run("markdown", func(t *testing.T) {
+		assert.Equal(t,
+			`Hi \<[@alice](https://bsky.app/profile/did:plc:alice)\> read `+
+				`[the \*docs\*](https://docs.bsky.app/a_%28b%29) or `+
+				"[https://example.com](https://example.com)\n"+
+				`[\#go](https://bsky.app/hashtag/go)`,
+			RenderMarkdown(p))
+	})
+
+	t.Run("text", func(t *testing.T) {
+		assert.Equal(t,
+			"Hi <@alice> read the *docs* <https://docs.bsky.app/a_(b)> or https://example.com\n#go",
+			RenderText(p))
+	})
+
+	t.Run("text with ANSI", func(t *testing.T) {
+		out := RenderText(p, WithANSI(true))
+		assert.Contains(t, out, ansiCyan+"@alice"+ansiReset)
+		assert.Contains(t, out, ansiMagenta+"#go"+ansiReset)
+	})
+
+	t.Run("custom URLs", func(t *testing.T) {
+		out := RenderHTML(p,
+			WithProfileURL(func(did string) string { return "/u/" + did }),
+			WithTagURL(func(tag string) string { return "/t/" + tag }),
+		)
+		assert.Contains(t, out, `<a href="/u/did:plc:alice">@alice</a>`)
+		assert.Contains(t, out, `<a href="/t/go">#go</a>`)
+	})
+
+	t.Run("feed post", func(t *testing.T) {
+		assert.Equal(t, RenderHTML(p), RenderFeedPostHTML(&feedPost))
+		assert.Equal(t, RenderMarkdown(p), RenderFeedPostMarkdown(&feedPost))
+		assert.Equal(t, RenderText(p), RenderFeedPostText(&feedPost))
+	})
+}
+
+func TestRenderInvalidFacets(t *testing.T) {
+	link := func(start, end int64, uri string) *bsky.RichtextFacet {
+		return &bsky.RichtextFacet{
+			Index: &bsky.RichtextFacet_ByteSlice{ByteStart: start, ByteEnd: end},
+			Features: []*bsky.RichtextFacet_Features_Elem{
+				{RichtextFacet_Link: &bsky.RichtextFacet_Link{Uri: uri}},
+			},
+		}
+	}
+
+	feedPost := &bsky.FeedPost{
+		Text: "héllo world",
+		Facets: []*bsky.RichtextFacet{
+			link(0, 6, "https://a.example"),   // valid
+			link(3, 8, "https://b.example"),   // overlaps the first facet
+			link(2, 4, "https://c.example"),   // splits a multi-byte rune
+			link(9, 4, "https://d.example"),   // reversed
+			link(50, 60, "https://e.example"), // out of bounds
+			link(7, 12, "javascript:alert(1)"),
+			{Index: nil},
+		},
+	}
+
+	assert.NotPanics(t, func() {
+		assert.Equal(t, `<a href="https://a.example">héllo</a> world`, RenderFeedPostHTML(feedPost))
+		assert.Equal(t, "[héllo](https://a.example) world", RenderFeedPostMarkdown(feedPost))
+		assert.Equal(t, "héllo <https://a.example> world", RenderFeedPostText(feedPost))
+	})
+}
+
+func TestRenderTextControlCharacters(t *testing.T) {
+	feedPost := &bsky.FeedPost{
+		Text: "a\x1b]0;pwned\x07b\x1b[2Jc\rd\u009b31me\x1bcf\x1b]8;;https://x\x1b\\g\n\th\x00",
+		Facets: []*bsky.RichtextFacet{{
+			Index: &bsky.RichtextFacet_ByteSlice{ByteStart: 0, ByteEnd: 1},
+			Features: []*bsky.RichtextFacet_Features_Elem{
+				{RichtextFacet_Link: &bsky.RichtextFacet_Link{Uri: "https://example.com"}},
+			},
+		}},
+	}
+
+	assert.Equal(t,
+		"a <https://example.com>�b�c�d�e�f�g\n\th�",
+		RenderFeedPostText(feedPost))
+	assert.Equal(t, "plain\ttext\n", sanitizeTerminal("plain\ttext\n"))
+}
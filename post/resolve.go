@@ -0,0 +1,500 @@
+package post
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bluesky-social/indigo/api/atproto"
+	"github.com/bluesky-social/indigo/api/bsky"
+	lexutil "github.com/bluesky-social/indigo/lex/util"
+	"github.com/watzon/lining/models"
+)
+
+// Maximum size of a page fetched for a link card, and of its thumbnail
+const (
+	maxCardPageBytes  = 1 << 20
+	maxCardThumbBytes = 1000000
+)
+
+// ImageUploader uploads images as blobs. The client.BskyClient type satisfies
+// this interface.
+type ImageUploader interface {
+	UploadImage(ctx context.Context, image models.Image) (*models.UploadedImage, error)
+}
+
+// WithUploader returns a BuilderOption that sets the uploader used for images
+// added with WithImageFromFile and for link card thumbnails
+func WithUploader(uploader ImageUploader) BuilderOption {
+	return func(opts *BuilderOptions) {
+		opts.Uploader = uploader
+	}
+}
+
+// WithHTTPClient returns a BuilderOption that sets the HTTP client used to
+// fetch link cards
+func WithHTTPClient(client *http.Client) BuilderOption {
+	return func(opts *BuilderOptions) {
+		opts.HTTPClient = client
+	}
+}
+
+// ResolveOp identifies the kind of work performed by Resolve
+type ResolveOp string
+
+const (
+	// ResolveMention resolves a mentioned handle to a DID
+	ResolveMention ResolveOp = "mention"
+	// ResolveReply fetches the post being replied to
+	ResolveReply ResolveOp = "reply"
+	// ResolveLinkCard fetches the page behind a link card
+	ResolveLinkCard ResolveOp = "link card"
+	// ResolveImage reads and uploads an image
+	ResolveImage ResolveOp = "image"
+	// ResolveBlob copies a blob from another repo
+	ResolveBlob ResolveOp = "blob"
+)
+
+// ResolveError describes one piece of work that failed during Resolve
+type ResolveError struct {
+	Op ResolveOp
+	// Segment is the index of the text segment the error belongs to, or -1
+	// if it isn't tied to the text
+	Segment int
+	// Target is the handle, URI, URL or file path being resolved
+	Target string
+	Err    error
+}
+
+func (e *ResolveError) Error() string {
+	return fmt.Sprintf("failed to resolve %s %s: %v", e.Op, e.Target, e.Err)
+}
+
+func (e *ResolveError) Unwrap() error {
+	return e.Err
+}
+
+// ResolveErrors is returned by Resolve when one or more pieces of work fail.
+// It works with errors.Is and errors.As for each of the errors it contains.
+type ResolveErrors []*ResolveError
+
+func (e ResolveErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+func (e ResolveErrors) Unwrap() []error {
+	errs := make([]error, len(e))
+	for i, err := range e {
+		errs[i] = err
+	}
+	return errs
+}
+
+// pending holds the work recorded by the builder's chained methods until Resolve
+type pending struct {
+	replyUri string
+	cardUrl  string
+	images   []pendingImage
+	// reupload is set when the blobs of a copied post should be uploaded again
+	reupload BlobCopier
+	// reuploaded tracks the copied blobs that have already been uploaded again
+	reuploaded map[*lexutil.LexBlob]bool
+}
+
+// pendingImage is an image to be read from disk and uploaded
+type pendingImage struct {
+	title    string
+	path     string
+	uploaded *models.UploadedImage
+}
+
+// WithImageFromFile adds an image from the local filesystem to the post. The
+// file is read and uploaded by Resolve, using the builder's ImageUploader.
+//
+// Example:
+//
+//	builder.WithImageFromFile("A cat asleep in a box", "/path/to/cat.jpg")
+func (b *Builder) WithImageFromFile(title string, path string) *Builder {
+	if b.err != nil {
+		return b
+	}
+	if b.options.Uploader == nil {
+		b.err = errors.New("an uploader is required to add images from files")
+		return b
+	}
+	b.pending.images = append(b.pending.images, pendingImage{title: title, path: path})
+	return b
+}
+
+// WithLinkCard adds a link card for the given URL to the post. The page is
+// fetched by Resolve to fill in the card's title, description and thumbnail.
+// The thumbnail is only included when the builder has an ImageUploader, and
+// is left out if it can't be fetched.
+//
+// Example:
+//
+//	builder.WithLinkCard("https://example.com/blog/release")
+func (b *Builder) WithLinkCard(uri string) *Builder {
+	if b.err != nil {
+		return b
+	}
+	if err := validateURL(uri); err != nil {
+		b.err = err
+		return b
+	}
+	b.pending.cardUrl = uri
+	return b
+}
+
+// needsResolve reports whether the builder has work left for Resolve
+func (b *Builder) needsResolve() bool {
+	if b.pending.replyUri != "" || b.pending.cardUrl != "" || len(b.pending.images) > 0 || b.pending.reupload != nil {
+		return true
+	}
+	for _, seg := range b.segments {
+		if seg.handle != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// Resolve performs the network and file I/O recorded by the builder's chained
+// methods: resolving mentioned handles, fetching the post being replied to,
+// fetching link cards, uploading images and re-uploading copied blobs. All of the work runs concurrently
+// and stops when ctx is cancelled.
+//
+// Failures are returned together as ResolveErrors. Work that succeeded is
+// kept, so Resolve can be called again to retry only what failed. Mentions
+// that can't be resolved are left as plain text unless the UnresolvedMentions
+// option is MentionError.
+//
+// Example:
+//
+//	builder := client.NewPostBuilder().
+//	    AddText("Thanks ").
+//	    AddMention("alice.bsky.social", "").
+//	    WithReplyToUri(uri)
+//	if err := builder.Resolve(ctx); err != nil {
+//	    var errs post.ResolveErrors
+//	    if errors.As(err, &errs) {
+//	        for _, e := range errs {
+//	            log.Printf("%s %s: %v", e.Op, e.Target, e.Err)
+//	        }
+//	    }
+//	}
+//	p, err := builder.Build()
+func (b *Builder) Resolve(ctx context.Context) error {
+	if b.err != nil {
+		return b.err
+	}
+
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		errs ResolveErrors
+	)
+	run := func(op ResolveOp, segment int, target string, fn func() error) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := fn(); err != nil {
+				mu.Lock()
+				errs = append(errs, &ResolveError{Op: op, Segment: segment, Target: target, Err: err})
+				mu.Unlock()
+			}
+		}()
+	}
+
+	for i := range b.segments {
+		seg := &b.segments[i]
+		if seg.handle == "" {
+			continue
+		}
+		run(ResolveMention, i, seg.handle, func() error {
+			did, err := b.resolveMention(ctx, seg.handle)
+			if err != nil {
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
+				if b.options.UnresolvedMentions == MentionError {
+					return err
+				}
+				// Keep the mention as plain text
+				seg.handle = ""
+				return nil
+			}
+			seg.facet = &models.Facet{Type: models.FacetMention, Value: did, Text: seg.text}
+			seg.handle = ""
+			return nil
+		})
+	}
+
+	var reply *bsky.FeedPost_ReplyRef
+	if uri := b.pending.replyUri; uri != "" {
+		run(ResolveReply, -1, uri, func() (err error) {
+			reply, err = b.resolveReply(ctx, uri)
+			return err
+		})
+	}
+
+	var card *models.Link
+	if uri := b.pending.cardUrl; uri != "" {
+		run(ResolveLinkCard, -1, uri, func() (err error) {
+			card, err = b.fetchLinkCard(ctx, uri)
+			return err
+		})
+	}
+
+	for i := range b.pending.images {
+		img := &b.pending.images[i]
+		if img.uploaded != nil {
+			continue
+		}
+		run(ResolveImage, -1, img.path, func() error {
+			data, err := os.ReadFile(img.path)
+			if err != nil {
+				return fmt.Errorf("failed to read file: %w", err)
+			}
+			uploaded, err := b.options.Uploader.UploadImage(ctx, models.Image{Title: img.title, Data: data})
+			if err != nil {
+				return err
+			}
+			img.uploaded = uploaded
+			return nil
+		})
+	}
+
+	var reuploads []*lexutil.LexBlob
+	var reuploaded []bool
+	if copier := b.pending.reupload; copier != nil {
+		for _, blob := range b.sourceBlobs() {
+			if !b.pending.reuploaded[blob] {
+				reuploads = append(reuploads, blob)
+			}
+		}
+		reuploaded = make([]bool, len(reuploads))
+		for i, blob := range reuploads {
+			run(ResolveBlob, -1, blob.Ref.String(), func() error {
+				if err := b.reuploadBlob(ctx, copier, blob); err != nil {
+					return err
+				}
+				reuploaded[i] = true
+				return nil
+			})
+		}
+	}
+
+	wg.Wait()
+
+	for i, blob := range reuploads {
+		if reuploaded[i] {
+			if b.pending.reuploaded == nil {
+				b.pending.reuploaded = make(map[*lexutil.LexBlob]bool)
+			}
+			b.pending.reuploaded[blob] = true
+		}
+	}
+
+	if reply != nil {
+		b.reply = reply
+		b.pending.replyUri = ""
+	}
+	if card != nil {
+		b.embed.Link = *card
+		b.pending.cardUrl = ""
+	}
+
+	if len(errs) > 0 {
+		sort.SliceStable(errs, func(i, j int) bool {
+			return errs[i].Segment < errs[j].Segment
+		})
+		return errs
+	}
+
+	for _, img := range b.pending.images {
+		for len(b.imagePaths) < len(b.embed.Images) {
+			b.imagePaths = append(b.imagePaths, "")
+		}
+		b.imagePaths = append(b.imagePaths, img.path)
+		b.embed.Images = append(b.embed.Images, img.uploaded.Image)
+		b.embed.UploadedImages = append(b.embed.UploadedImages, *img.uploaded.LexBlob)
+	}
+	b.pending.images = nil
+	b.pending.reupload = nil
+	b.pending.reuploaded = nil
+
+	return nil
+}
+
+// resolveReply fetches the post at uri and builds a reply reference to it
+func (b *Builder) resolveReply(ctx context.Context, uri string) (*bsky.FeedPost_ReplyRef, error) {
+	repo, collection, rkey, err := ParsePostURI(uri)
+	if err != nil {
+		return nil, fmt.Errorf("invalid reply URI: %w", err)
+	}
+
+	// Fetch the parent post to get its CID and reply references
+	resp, err := atproto.RepoGetRecord(ctx, b.options.Client, "", collection, repo, rkey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch reply post: %w", err)
+	}
+
+	if resp.Cid == nil {
+		return nil, errors.New("failed to fetch reply post: missing CID")
+	}
+
+	// Prefer the URI returned by the server, as it always uses the DID
+	parentUri := uri
+	if resp.Uri != "" {
+		parentUri = resp.Uri
+	}
+
+	parent := &atproto.RepoStrongRef{
+		Cid: *resp.Cid,
+		Uri: parentUri,
+	}
+
+	root := parent
+	if resp.Value != nil {
+		if record, ok := resp.Value.Val.(*bsky.FeedPost); ok && record.Reply != nil && record.Reply.Root != nil {
+			root = record.Reply.Root
+		}
+	}
+
+	return &bsky.FeedPost_ReplyRef{
+		Parent: parent,
+		Root:   root,
+	}, nil
+}
+
+var (
+	metaTagRegex  = regexp.MustCompile(`(?is)<meta\s[^>]*>`)
+	metaAttrRegex = regexp.MustCompile(`(?is)([a-z:-]+)\s*=\s*(?:"([^"]*)"|'([^']*)')`)
+	titleTagRegex = regexp.MustCompile(`(?is)<title[^>]*>(.*?)</title>`)
+)
+
+// httpClient returns the HTTP client used to fetch link cards
+func (b *Builder) httpClient() *http.Client {
+	if b.options.HTTPClient != nil {
+		return b.options.HTTPClient
+	}
+	return &http.Client{Timeout: 30 * time.Second}
+}
+
+// fetch downloads uri, reading at most limit bytes
+func (b *Builder) fetch(ctx context.Context, uri string, limit int64) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, uri, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := b.httpClient().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > limit {
+		return nil, fmt.Errorf("response larger than %d bytes", limit)
+	}
+	return data, nil
+}
+
+// fetchLinkCard fetches the page at uri and builds a link card from its
+// OpenGraph metadata, falling back to the page title
+func (b *Builder) fetchLinkCard(ctx context.Context, uri string) (*models.Link, error) {
+	page, err := url.Parse(uri)
+	if err != nil {
+		return nil, ErrInvalidURL
+	}
+
+	body, err := b.fetch(ctx, uri, maxCardPageBytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch page: %w", err)
+	}
+
+	meta := make(map[string]string)
+	for _, tag := range metaTagRegex.FindAllString(string(body), -1) {
+		attrs := make(map[string]string)
+		for _, m := range metaAttrRegex.FindAllStringSubmatch(tag, -1) {
+			attrs[strings.ToLower(m[1])] = m[2] + m[3]
+		}
+		key := attrs["property"]
+		if key == "" {
+			key = attrs["name"]
+		}
+		key = strings.ToLower(key)
+		if _, seen := meta[key]; key != "" && !seen {
+			meta[key] = html.UnescapeString(strings.TrimSpace(attrs["content"]))
+		}
+	}
+
+	first := func(keys ...string) string {
+		for _, key := range keys {
+			if meta[key] != "" {
+				return meta[key]
+			}
+		}
+		return ""
+	}
+
+	card := &models.Link{
+		Uri:         *page,
+		Title:       first("og:title", "twitter:title"),
+		Description: first("og:description", "twitter:description", "description"),
+	}
+	if card.Title == "" {
+		if m := titleTagRegex.FindStringSubmatch(string(body)); m != nil {
+			card.Title = html.UnescapeString(strings.TrimSpace(m[1]))
+		}
+	}
+
+	if image := first("og:image", "twitter:image"); image != "" && b.options.Uploader != nil {
+		if thumb := b.fetchThumb(ctx, page, image); thumb != nil {
+			card.Thumb = *thumb
+		}
+	}
+
+	return card, nil
+}
+
+// fetchThumb downloads and uploads a link card thumbnail, returning nil if
+// that fails
+func (b *Builder) fetchThumb(ctx context.Context, page *url.URL, image string) *lexutil.LexBlob {
+	ref, err := url.Parse(image)
+	if err != nil {
+		return nil
+	}
+	data, err := b.fetch(ctx, page.ResolveReference(ref).String(), maxCardThumbBytes)
+	if err != nil {
+		return nil
+	}
+	uploaded, err := b.options.Uploader.UploadImage(ctx, models.Image{Data: data})
+	if err != nil || uploaded.LexBlob == nil {
+		return nil
+	}
+	return uploaded.LexBlob
+}
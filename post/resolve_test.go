@@ -0,0 +1,195 @@
+package post
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	lexutil "github.com/bluesky-social/indigo/lex/util"
+	"github.com/ipfs/go-cid"
+	"github.com/stretchr/testify/assert"
+	"github.com/watzon/lining/models"
+)
+
+// fakeUploader records uploads and returns a blob for each of them
+type fakeUploader struct {
+	mu      sync.Mutex
+	uploads []models.Image
+	err     error
+}
+
+func (u *fakeUploader) UploadImage(ctx context.Context, image models.Image) (*models.UploadedImage, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.err != nil {
+		return nil, u.err
+	}
+	u.uploads = append(u.uploads, image)
+	ref, _ := cid.Decode("bafkreie5737gdxlw5i64vzichcalba3z2v5n6icifvx5xytvske7mr3hpm")
+	return &models.UploadedImage{
+		LexBlob: &lexutil.LexBlob{Ref: lexutil.LexLink(ref), MimeType: "image/png", Size: int64(len(image.Data))},
+		Image:   image,
+	}, nil
+}
+
+// blockingResolver blocks until the context is cancelled
+type blockingResolver struct{}
+
+func (blockingResolver) GetDIDForHandle(ctx context.Context, handle string) (string, error) {
+	<-ctx.Done()
+	return "", ctx.Err()
+}
+
+func TestBuilderResolve(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/article":
+			w.Write([]byte(`<html><head>
+				<title>Fallback title</title>
+				<meta property="og:title" content="Release notes &amp; more">
+				<meta name="description" content="Everything that changed">
+				<meta property="og:image" content="/thumb.png">
+			</head></html>`))
+		case "/plain":
+			w.Write([]byte(`<html><head><title>Just a title</title></head></html>`))
+		case "/thumb.png":
+			w.Write([]byte("png data"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	imagePath := filepath.Join(dir, "cat.png")
+	assert.NoError(t, os.WriteFile(imagePath, []byte("cat"), 0o644))
+
+	ctx := context.Background()
+
+	t.Run("chained methods record intent only", func(t *testing.T) {
+		uploader := &fakeUploader{}
+		builder := NewBuilder(WithResolver(testResolver), WithUploader(uploader)).
+			AddMention("carol.bsky.social", "").
+			WithImageFromFile("A cat", imagePath).
+			WithLinkCard(server.URL + "/article")
+
+		assert.Empty(t, uploader.uploads)
+		assert.True(t, builder.needsResolve())
+
+		assert.NoError(t, builder.Resolve(ctx))
+		assert.False(t, builder.needsResolve())
+
+		post, err := builder.Build()
+		assert.NoError(t, err)
+		assert.Equal(t, "did:plc:carol", post.Facets[0].Features[0].RichtextFacet_Mention.Did)
+		assert.Len(t, post.Embed.EmbedImages.Images, 1)
+		assert.Equal(t, "A cat", post.Embed.EmbedImages.Images[0].Alt)
+		assert.Len(t, uploader.uploads, 2, "the image and the card thumbnail")
+	})
+
+	t.Run("link cards", func(t *testing.T) {
+		uploader := &fakeUploader{}
+		post, err := NewBuilder(WithUploader(uploader), WithHTTPClient(server.Client())).
+			AddText("New release").
+			WithLinkCard(server.URL + "/article").
+			Build()
+
+		assert.NoError(t, err)
+		external := post.Embed.EmbedExternal.External
+		assert.Equal(t, server.URL+"/article", external.Uri)
+		assert.Equal(t, "Release notes & more", external.Title)
+		assert.Equal(t, "Everything that changed", external.Description)
+		assert.NotNil(t, external.Thumb)
+		assert.Equal(t, []byte("png data"), uploader.uploads[0].Data)
+
+		post, err = NewBuilder().
+			AddText("No uploader").
+			WithLinkCard(server.URL + "/plain").
+			Build()
+
+		assert.NoError(t, err)
+		assert.Equal(t, "Just a title", post.Embed.EmbedExternal.External.Title)
+		assert.Nil(t, post.Embed.EmbedExternal.External.Thumb)
+	})
+
+	t.Run("aggregates typed errors", func(t *testing.T) {
+		err := NewBuilder(
+			WithResolver(testResolver),
+			WithUnresolvedMentions(MentionError),
+			WithUploader(&fakeUploader{}),
+		).
+			AddMention("alice", "").
+			AddText(" and ").
+			AddMention("nobody.bsky.social", "").
+			WithImageFromFile("missing", filepath.Join(dir, "missing.png")).
+			WithLinkCard(server.URL + "/gone").
+			Resolve(ctx)
+
+		var errs ResolveErrors
+		assert.True(t, errors.As(err, &errs))
+		assert.Len(t, errs, 3)
+		assert.ErrorIs(t, err, ErrUnresolvedMention)
+		assert.ErrorIs(t, err, os.ErrNotExist)
+
+		ops := map[ResolveOp]*ResolveError{}
+		for _, e := range errs {
+			ops[e.Op] = e
+		}
+		assert.Equal(t, 2, ops[ResolveMention].Segment)
+		assert.Equal(t, "nobody.bsky.social", ops[ResolveMention].Target)
+		assert.Equal(t, -1, ops[ResolveImage].Segment)
+		assert.Equal(t, server.URL+"/gone", ops[ResolveLinkCard].Target)
+		assert.Equal(t, ResolveMention, errs[len(errs)-1].Op, "sorted by segment")
+	})
+
+	t.Run("retries only what failed", func(t *testing.T) {
+		uploader := &fakeUploader{}
+		builder := NewBuilder(WithUploader(uploader)).
+			AddText("Photos").
+			WithImageFromFile("first", imagePath).
+			WithImageFromFile("second", filepath.Join(dir, "later.png"))
+
+		assert.Error(t, builder.Resolve(ctx))
+		assert.Len(t, uploader.uploads, 1)
+
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, "later.png"), []byte("later"), 0o644))
+		assert.NoError(t, builder.Resolve(ctx))
+		assert.Len(t, uploader.uploads, 2)
+
+		post, err := builder.Build()
+		assert.NoError(t, err)
+		assert.Equal(t, "first", post.Embed.EmbedImages.Images[0].Alt)
+		assert.Equal(t, "second", post.Embed.EmbedImages.Images[1].Alt)
+	})
+
+	t.Run("cancellation", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		err := NewBuilder(WithResolver(blockingResolver{})).
+			AddMention("alice", "").
+			AddText(" ").
+			AddMention("bob", "").
+			Resolve(ctx)
+
+		var errs ResolveErrors
+		assert.True(t, errors.As(err, &errs))
+		assert.Len(t, errs, 2)
+		assert.ErrorIs(t, err, context.Canceled)
+
+		_, err = NewBuilder(WithResolver(blockingResolver{}), WithUnresolvedMentions(MentionError)).
+			AddMention("alice", "").
+			BuildContext(ctx)
+		assert.ErrorIs(t, err, context.Canceled)
+	})
+
+	t.Run("requires an uploader for files", func(t *testing.T) {
+		_, err := NewBuilder().WithImageFromFile("cat", imagePath).Build()
+		assert.Error(t, err)
+	})
+}
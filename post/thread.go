@@ -0,0 +1,207 @@
+package post
+
+import (
+	"sort"
+	"time"
+
+	"github.com/bluesky-social/indigo/api/bsky"
+)
+
+// Thread is a node in a post thread. A node is either a post or a placeholder
+// for a post that was deleted or is hidden by a block; placeholders have a nil
+// Post.
+//
+// The node GetThread returns is the requested post. Its ancestors are linked
+// through Parent, and each ancestor lists the next one down the chain in its
+// Replies, so walking from Root covers the whole retrieved tree.
+type Thread struct {
+	// Uri is set for every node, including placeholders
+	Uri  string
+	Post *Post
+	// NotFound marks a post that was deleted or never existed
+	NotFound bool
+	// Blocked marks a post hidden because of a block between its author and
+	// the viewer
+	Blocked bool
+	// BlockedAuthor is the DID of the author of a blocked post
+	BlockedAuthor string
+
+	Parent  *Thread
+	Replies []*Thread
+}
+
+// threadUnion holds the members shared by the thread union types
+type threadUnion struct {
+	view     *bsky.FeedDefs_ThreadViewPost
+	notFound *bsky.FeedDefs_NotFoundPost
+	blocked  *bsky.FeedDefs_BlockedPost
+}
+
+// ThreadFromPostThread converts the thread returned by getPostThread and
+// returns the node of the requested post
+func ThreadFromPostThread(thread *bsky.FeedGetPostThread_Output_Thread) (*Thread, error) {
+	if thread == nil {
+		return nil, nil
+	}
+	return threadFromUnion(threadUnion{thread.FeedDefs_ThreadViewPost, thread.FeedDefs_NotFoundPost, thread.FeedDefs_BlockedPost}, true)
+}
+
+// threadFromUnion converts a node, its replies and, for the requested post
+// and its ancestors, its parents
+func threadFromUnion(u threadUnion, withParents bool) (*Thread, error) {
+	switch {
+	case u.notFound != nil:
+		return &Thread{Uri: u.notFound.Uri, NotFound: true}, nil
+	case u.blocked != nil:
+		node := &Thread{Uri: u.blocked.Uri, Blocked: true}
+		if u.blocked.Author != nil {
+			node.BlockedAuthor = u.blocked.Author.Did
+		}
+		return node, nil
+	case u.view == nil || u.view.Post == nil:
+		return nil, nil
+	}
+
+	p, err := PostFromFeedDefs_PostView(u.view.Post)
+	if err != nil {
+		return nil, err
+	}
+	node := &Thread{Uri: u.view.Post.Uri, Post: p}
+
+	for _, reply := range u.view.Replies {
+		if reply == nil {
+			continue
+		}
+		child, err := threadFromUnion(threadUnion{reply.FeedDefs_ThreadViewPost, reply.FeedDefs_NotFoundPost, reply.FeedDefs_BlockedPost}, false)
+		if err != nil {
+			return nil, err
+		}
+		if child != nil {
+			child.Parent = node
+			node.Replies = append(node.Replies, child)
+		}
+	}
+
+	if parent := u.view.Parent; withParents && parent != nil {
+		up, err := threadFromUnion(threadUnion{parent.FeedDefs_ThreadViewPost, parent.FeedDefs_NotFoundPost, parent.FeedDefs_BlockedPost}, true)
+		if err != nil {
+			return nil, err
+		}
+		if up != nil {
+			node.Parent = up
+			up.Replies = append(up.Replies, node)
+		}
+	}
+
+	return node, nil
+}
+
+// Root returns the topmost retrieved ancestor of the node. It's the root of
+// the thread unless the ancestors were cut off by the parent height.
+func (t *Thread) Root() *Thread {
+	root := t
+	for root.Parent != nil {
+		root = root.Parent
+	}
+	return root
+}
+
+// Depth returns how many replies deep the node is below Root. It's the
+// node's depth in the thread when Root is the thread's first post.
+func (t *Thread) Depth() int {
+	depth := 0
+	for node := t.Parent; node != nil; node = node.Parent {
+		depth++
+	}
+	return depth
+}
+
+// Walk calls fn for the node and every reply below it, depth first, with the
+// depth of each node relative to t. Returning false from fn skips the replies
+// of that node.
+//
+// Example:
+//
+//	thread.Root().Walk(func(node *post.Thread, depth int) bool {
+//	    if node.Post != nil {
+//	        fmt.Printf("%s%s: %s\n", strings.Repeat("  ", depth), node.Post.Author.Handle, node.Post.Text)
+//	    }
+//	    return true
+//	})
+func (t *Thread) Walk(fn func(node *Thread, depth int) bool) {
+	t.walk(fn, 0)
+}
+
+func (t *Thread) walk(fn func(node *Thread, depth int) bool, depth int) {
+	if !fn(t, depth) {
+		return
+	}
+	for _, reply := range t.Replies {
+		reply.walk(fn, depth+1)
+	}
+}
+
+// Flatten returns the posts of the node and every reply below it, oldest
+// first. Placeholders are left out.
+func (t *Thread) Flatten() []*Post {
+	var posts []*Post
+	t.Walk(func(node *Thread, depth int) bool {
+		if node.Post != nil {
+			posts = append(posts, node.Post)
+		}
+		return true
+	})
+	sortChronologically(posts)
+	return posts
+}
+
+// Conversation returns the exchange between two users within the node and
+// the replies below it, oldest first: every post by one of them that replies
+// to the other, together with the post it replies to. Users are given by DID.
+//
+// Example:
+//
+//	for _, p := range thread.Root().Conversation(alice, bob) {
+//	    fmt.Println(p.Author.Handle, p.Text)
+//	}
+func (t *Thread) Conversation(did1, did2 string) []*Post {
+	seen := make(map[*Post]bool)
+	var posts []*Post
+	add := func(p *Post) {
+		if !seen[p] {
+			seen[p] = true
+			posts = append(posts, p)
+		}
+	}
+
+	t.Walk(func(node *Thread, depth int) bool {
+		parent := node.Parent
+		if node.Post == nil || parent == nil || parent.Post == nil {
+			return true
+		}
+		author, replyTo := node.Post.Repo, parent.Post.Repo
+		if (author == did1 && replyTo == did2) || (author == did2 && replyTo == did1) {
+			add(parent.Post)
+			add(node.Post)
+		}
+		return true
+	})
+
+	sortChronologically(posts)
+	return posts
+}
+
+// sortChronologically sorts posts by creation time, falling back to the time
+// they were indexed when a post's createdAt can't be parsed
+func sortChronologically(posts []*Post) {
+	postTime := func(p *Post) time.Time {
+		if at, err := time.Parse(time.RFC3339, p.CreatedAt); err == nil {
+			return at
+		}
+		at, _ := time.Parse(time.RFC3339, p.IndexedAt)
+		return at
+	}
+	sort.SliceStable(posts, func(i, j int) bool {
+		return postTime(posts[i]).Before(postTime(posts[j]))
+	})
+}
@@ -0,0 +1,99 @@
+package post
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/bluesky-social/indigo/api/bsky"
+	"github.com/stretchr/testify/assert"
+)
+
+// threadPost returns a thread view of a post by did written at the given
+// minute
+func threadPost(did string, rkey string, minute int, extra string) string {
+	return fmt.Sprintf(`{
+		"$type": "app.bsky.feed.defs#threadViewPost",
+		"post": {
+			"uri": "at://%[1]s/app.bsky.feed.post/%[2]s", "cid": "cid-%[2]s",
+			"author": {"did": "%[1]s", "handle": "%[2]s.test"},
+			"record": {"$type": "app.bsky.feed.post", "text": "%[2]s", "createdAt": "2024-05-06T08:%02[3]d:00Z"},
+			"indexedAt": "2024-05-06T08:%02[3]d:00Z"
+		}%[4]s
+	}`, did, rkey, minute, extra)
+}
+
+func TestThread(t *testing.T) {
+	const alice, bob, carol = "did:plc:alice", "did:plc:bob", "did:plc:carol"
+
+	raw := threadPost(alice, "anchor", 10, `,
+		"parent": `+threadPost(bob, "parent", 5, `,
+			"parent": `+threadPost(alice, "root", 0, ""))+`,
+		"replies": [
+			`+threadPost(carol, "carol", 12, `, "replies": [`+threadPost(alice, "answer", 30, "")+`]`)+`,
+			`+threadPost(bob, "bob", 11, "")+`,
+			{"$type": "app.bsky.feed.defs#blockedPost", "uri": "at://did:plc:troll/app.bsky.feed.post/x", "blocked": true, "author": {"did": "did:plc:troll"}},
+			{"$type": "app.bsky.feed.defs#notFoundPost", "uri": "at://did:plc:gone/app.bsky.feed.post/y", "notFound": true}
+		]`)
+
+	var out bsky.FeedGetPostThread_Output_Thread
+	assert.NoError(t, json.Unmarshal([]byte(raw), &out))
+	anchor, err := ThreadFromPostThread(&out)
+	assert.NoError(t, err)
+
+	t.Run("links parents and replies", func(t *testing.T) {
+		assert.Equal(t, "anchor", anchor.Post.Text)
+		assert.Equal(t, "parent", anchor.Parent.Post.Text)
+		assert.Equal(t, "root", anchor.Root().Post.Text)
+		assert.Same(t, anchor, anchor.Parent.Replies[0])
+		assert.Len(t, anchor.Replies, 4)
+	})
+
+	t.Run("placeholders", func(t *testing.T) {
+		blocked, notFound := anchor.Replies[2], anchor.Replies[3]
+		assert.True(t, blocked.Blocked)
+		assert.Nil(t, blocked.Post)
+		assert.Equal(t, "did:plc:troll", blocked.BlockedAuthor)
+		assert.True(t, notFound.NotFound)
+		assert.Equal(t, "at://did:plc:gone/app.bsky.feed.post/y", notFound.Uri)
+	})
+
+	t.Run("depth", func(t *testing.T) {
+		assert.Equal(t, 0, anchor.Root().Depth())
+		assert.Equal(t, 2, anchor.Depth())
+		assert.Equal(t, 4, anchor.Replies[0].Replies[0].Depth())
+	})
+
+	t.Run("walk", func(t *testing.T) {
+		var visited []string
+		anchor.Root().Walk(func(node *Thread, depth int) bool {
+			if node.Post != nil {
+				visited = append(visited, fmt.Sprintf("%d:%s", depth, node.Post.Text))
+			}
+			return node.Post == nil || node.Post.Text != "carol"
+		})
+		assert.Equal(t, []string{"0:root", "1:parent", "2:anchor", "3:carol", "3:bob"}, visited)
+	})
+
+	t.Run("flatten", func(t *testing.T) {
+		var texts []string
+		for _, p := range anchor.Root().Flatten() {
+			texts = append(texts, p.Text)
+		}
+		assert.Equal(t, []string{"root", "parent", "anchor", "bob", "carol", "answer"}, texts)
+	})
+
+	t.Run("conversation", func(t *testing.T) {
+		var texts []string
+		for _, p := range anchor.Root().Conversation(alice, bob) {
+			texts = append(texts, p.Text)
+		}
+		assert.Equal(t, []string{"root", "parent", "anchor", "bob"}, texts)
+
+		texts = nil
+		for _, p := range anchor.Root().Conversation(carol, alice) {
+			texts = append(texts, p.Text)
+		}
+		assert.Equal(t, []string{"anchor", "carol", "answer"}, texts)
+	})
+}
@@ -0,0 +1,52 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCron(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skip("time zone database not available")
+	}
+	start := time.Date(2024, 3, 29, 10, 17, 30, 0, time.UTC) // a Friday
+
+	tests := []struct {
+		name string
+		expr string
+		from time.Time
+		want time.Time
+	}{
+		{name: "every minute", expr: "* * * * *", from: start, want: time.Date(2024, 3, 29, 10, 18, 0, 0, time.UTC)},
+		{name: "steps", expr: "*/15 * * * *", from: start, want: time.Date(2024, 3, 29, 10, 30, 0, 0, time.UTC)},
+		{name: "daily", expr: "0 9 * * *", from: start, want: time.Date(2024, 3, 30, 9, 0, 0, 0, time.UTC)},
+		{name: "macro", expr: "@daily", from: start, want: time.Date(2024, 3, 30, 0, 0, 0, 0, time.UTC)},
+		{name: "weekdays by name", expr: "30 8 * * mon-fri", from: start, want: time.Date(2024, 4, 1, 8, 30, 0, 0, time.UTC)},
+		{name: "sunday as 7", expr: "0 12 * * 7", from: start, want: time.Date(2024, 3, 31, 12, 0, 0, 0, time.UTC)},
+		{name: "month names", expr: "0 0 1 jun *", from: start, want: time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)},
+		{name: "day of month or week", expr: "0 0 15 * mon", from: start, want: time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC)},
+		{name: "leap day", expr: "0 0 29 2 *", from: start, want: time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{name: "never", expr: "0 0 30 2 *", from: start, want: time.Time{}},
+		{name: "time zone", expr: "0 9 * * *", from: start.In(berlin), want: time.Date(2024, 3, 30, 8, 0, 0, 0, time.UTC)},
+		{name: "across DST", expr: "0 9 * * *", from: time.Date(2024, 3, 30, 12, 0, 0, 0, berlin), want: time.Date(2024, 3, 31, 7, 0, 0, 0, time.UTC)},
+		{name: "skipped by DST", expr: "30 2 * * *", from: time.Date(2024, 3, 30, 12, 0, 0, 0, berlin), want: time.Date(2024, 4, 1, 0, 30, 0, 0, time.UTC)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cron, err := ParseCron(tt.expr)
+			assert.NoError(t, err)
+			assert.True(t, tt.want.Equal(cron.Next(tt.from)), "got %v", cron.Next(tt.from))
+		})
+	}
+
+	t.Run("invalid expressions", func(t *testing.T) {
+		for _, expr := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "* * * 13 *", "*/0 * * * *", "5-1 * * * *", "* * * * funday"} {
+			_, err := ParseCron(expr)
+			assert.ErrorIs(t, err, ErrInvalidCron, expr)
+		}
+	})
+}
@@ -0,0 +1,655 @@
+// Package scheduler publishes posts at fixed times. Jobs either post once at a
+// given time or recur on a cron schedule in a chosen time zone, and the
+// schedule is persisted to a file so it survives restarts. Runs missed while
+// the scheduler wasn't running are caught up or skipped according to each
+// job's MissedPolicy. Runs that fail with a temporary error are retried with
+// backoff under the same record key.
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"sync"
+	"time"
+
+	appbsky "github.com/bluesky-social/indigo/api/bsky"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+
+	"github.com/watzon/lining/client"
+	"github.com/watzon/lining/outbox"
+	"github.com/watzon/lining/post"
+	"github.com/watzon/lining/utils"
+)
+
+// ErrNotFound is returned when no job has the given ID
+var ErrNotFound = errors.New("scheduled job not found")
+
+// ErrInvalidJob is returned when a job can't be scheduled
+var ErrInvalidJob = errors.New("invalid job")
+
+// MissedPolicy decides what happens to runs that were due while the scheduler
+// wasn't running
+type MissedPolicy string
+
+const (
+	// MissedRunOnce publishes once for the most recent missed run
+	MissedRunOnce MissedPolicy = "run-once"
+	// MissedRunAll publishes for every missed run, up to Options.MaxCatchUp
+	MissedRunAll MissedPolicy = "run-all"
+	// MissedSkip drops missed runs and waits for the next one
+	MissedSkip MissedPolicy = "skip"
+)
+
+// Producer creates the post for a run scheduled at the given time. Returning
+// a nil post skips the run.
+type Producer func(ctx context.Context, at time.Time) (*appbsky.FeedPost, error)
+
+// Publisher publishes posts. *client.BskyClient satisfies it.
+type Publisher interface {
+	PostToFeed(ctx context.Context, p appbsky.FeedPost, opts ...client.PostOption) (string, string, error)
+}
+
+// Job is a scheduled post. Set either Post or Producer, and either At or Cron.
+type Job struct {
+	// ID identifies the job; one is generated when empty
+	ID string `json:"id"`
+
+	// Post is published as-is on every run
+	Post *appbsky.FeedPost `json:"post,omitempty"`
+	// Producer is the name of a function registered with RegisterProducer
+	// that creates the post for each run
+	Producer string `json:"producer,omitempty"`
+
+	// At is the time of a one-shot job
+	At time.Time `json:"at"`
+	// Cron is the cron expression of a recurring job
+	Cron string `json:"cron,omitempty"`
+	// TimeZone is the IANA name of the time zone Cron is evaluated in, such
+	// as "Europe/Berlin". Defaults to UTC.
+	TimeZone string `json:"timeZone,omitempty"`
+	// Missed overrides the scheduler's MissedPolicy for this job
+	Missed MissedPolicy `json:"missed,omitempty"`
+
+	// Threadgate and Postgate are created with every post
+	Threadgate *post.Threadgate `json:"threadgate,omitempty"`
+	Postgate   *post.Postgate   `json:"postgate,omitempty"`
+	// TTL, if set, is how long every post stays up before it's deleted. See
+	// client.WithTTL.
+	TTL time.Duration `json:"ttl,omitempty"`
+
+	NextRun   time.Time `json:"nextRun"`
+	LastRun   time.Time `json:"lastRun"`
+	LastUri   string    `json:"lastUri,omitempty"`
+	LastError string    `json:"lastError,omitempty"`
+	Runs      int       `json:"runs"`
+	// Done is set once a one-shot job has run
+	Done bool `json:"done,omitempty"`
+
+	// Attempts counts the failed attempts at the run scheduled at NextRun,
+	// which is retried at RetryAt
+	Attempts int       `json:"attempts,omitempty"`
+	RetryAt  time.Time `json:"retryAt"`
+}
+
+// Options configures a Scheduler
+type Options struct {
+	// MissedPolicy applies to jobs that don't set their own
+	MissedPolicy MissedPolicy
+	// Grace is how late a run may start before it counts as missed
+	Grace time.Duration
+	// MaxCatchUp caps the number of runs MissedRunAll publishes at once
+	MaxCatchUp int
+	// MaxAttempts is the number of times a run is published before its error
+	// is recorded and the job moves on. Permanent errors, such as a post the
+	// PDS rejects, aren't retried.
+	MaxAttempts int
+	// InitialBackoff is the delay before retrying a failed run; it doubles
+	// with every attempt up to MaxBackoff
+	InitialBackoff time.Duration
+	// MaxBackoff caps the delay between retries
+	MaxBackoff time.Duration
+	// OnRun is called after every attempt at a run with the published post's
+	// URI or the error that prevented it
+	OnRun func(job Job, at time.Time, uri string, err error)
+}
+
+// Option is a function that configures an Options struct
+type Option func(*Options)
+
+// WithMissedPolicy returns an Option that sets the default MissedPolicy
+func WithMissedPolicy(policy MissedPolicy) Option {
+	return func(opts *Options) {
+		opts.MissedPolicy = policy
+	}
+}
+
+// WithGrace returns an Option that sets how late a run may be before it's missed
+func WithGrace(grace time.Duration) Option {
+	return func(opts *Options) {
+		opts.Grace = grace
+	}
+}
+
+// WithMaxCatchUp returns an Option that caps the runs caught up by MissedRunAll
+func WithMaxCatchUp(n int) Option {
+	return func(opts *Options) {
+		opts.MaxCatchUp = n
+	}
+}
+
+// WithMaxAttempts returns an Option that sets the number of attempts per run
+func WithMaxAttempts(n int) Option {
+	return func(opts *Options) {
+		opts.MaxAttempts = n
+	}
+}
+
+// WithBackoff returns an Option that sets the initial and maximum retry delays
+func WithBackoff(initial, max time.Duration) Option {
+	return func(opts *Options) {
+		opts.InitialBackoff = initial
+		opts.MaxBackoff = max
+	}
+}
+
+// WithOnRun returns an Option that sets the function called after every run
+func WithOnRun(fn func(job Job, at time.Time, uri string, err error)) Option {
+	return func(opts *Options) {
+		opts.OnRun = fn
+	}
+}
+
+// DefaultOptions returns the default Options
+func DefaultOptions() Options {
+	return Options{
+		MissedPolicy:   MissedRunOnce,
+		Grace:          time.Minute,
+		MaxCatchUp:     24,
+		MaxAttempts:    5,
+		InitialBackoff: 30 * time.Second,
+		MaxBackoff:     30 * time.Minute,
+	}
+}
+
+// Scheduler publishes scheduled posts. It is safe for concurrent use.
+//
+// Example:
+//
+//	sched, err := scheduler.Open("schedule.json", client)
+//	if err != nil {
+//	    return err
+//	}
+//	sched.RegisterProducer("digest", func(ctx context.Context, at time.Time) (*appbsky.FeedPost, error) {
+//	    p, err := client.NewPostBuilder().AddText(buildDigest()).Build()
+//	    return &p, err
+//	})
+//	_, err = sched.Add(scheduler.Job{
+//	    ID:       "daily-digest",
+//	    Producer: "digest",
+//	    Cron:     "0 9 * * *",
+//	    TimeZone: "Europe/Berlin",
+//	})
+//	go sched.Run(ctx)
+type Scheduler struct {
+	options   Options
+	path      string
+	publisher Publisher
+
+	mu        sync.Mutex
+	jobs      []*Job
+	producers map[string]Producer
+	wake      chan struct{}
+	now       func() time.Time
+}
+
+// Open opens the schedule stored at path, creating it if it doesn't exist
+func Open(path string, publisher Publisher, opts ...Option) (*Scheduler, error) {
+	options := DefaultOptions()
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	s := &Scheduler{
+		options:   options,
+		path:      path,
+		publisher: publisher,
+		producers: make(map[string]Producer),
+		wake:      make(chan struct{}, 1),
+		now:       time.Now,
+	}
+
+	data, err := os.ReadFile(path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+	case err != nil:
+		return nil, fmt.Errorf("failed to read schedule: %w", err)
+	default:
+		if err := json.Unmarshal(data, &s.jobs); err != nil {
+			return nil, fmt.Errorf("failed to parse schedule: %w", err)
+		}
+	}
+
+	return s, nil
+}
+
+// RegisterProducer registers a function that creates posts for jobs whose
+// Producer is name. Producers aren't persisted, so register them every time
+// the scheduler is opened.
+func (s *Scheduler) RegisterProducer(name string, fn Producer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.producers[name] = fn
+}
+
+// Add schedules a job, replacing any job with the same ID
+func (s *Scheduler) Add(job Job) (Job, error) {
+	if (job.Post == nil) == (job.Producer == "") {
+		return Job{}, fmt.Errorf("%w: set either Post or Producer", ErrInvalidJob)
+	}
+	if job.At.IsZero() == (job.Cron == "") {
+		return Job{}, fmt.Errorf("%w: set either At or Cron", ErrInvalidJob)
+	}
+	switch job.Missed {
+	case "", MissedRunOnce, MissedRunAll, MissedSkip:
+	default:
+		return Job{}, fmt.Errorf("%w: unknown missed policy %q", ErrInvalidJob, job.Missed)
+	}
+	if job.ID == "" {
+		job.ID = utils.NewTID().String()
+	}
+	job.Runs, job.Done, job.LastRun, job.LastUri, job.LastError = 0, false, time.Time{}, "", ""
+	job.Attempts, job.RetryAt = 0, time.Time{}
+
+	if job.Cron != "" {
+		cron, loc, err := job.schedule()
+		if err != nil {
+			return Job{}, err
+		}
+		job.NextRun = cron.Next(s.now().In(loc))
+		if job.NextRun.IsZero() {
+			return Job{}, fmt.Errorf("%w: %q never matches", ErrInvalidJob, job.Cron)
+		}
+	} else {
+		job.NextRun = job.At
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if job.Producer != "" {
+		if _, ok := s.producers[job.Producer]; !ok {
+			return Job{}, fmt.Errorf("%w: no producer registered as %q", ErrInvalidJob, job.Producer)
+		}
+	}
+
+	replaced := false
+	for i, existing := range s.jobs {
+		if existing.ID == job.ID {
+			s.jobs[i] = &job
+			replaced = true
+			break
+		}
+	}
+	if !replaced {
+		s.jobs = append(s.jobs, &job)
+	}
+	if err := s.save(); err != nil {
+		return Job{}, err
+	}
+
+	s.notify()
+	return job, nil
+}
+
+// PostAt schedules a post to be published once at the given time
+//
+// Example:
+//
+//	job, err := sched.PostAt(time.Now().Add(2*time.Hour), feedPost)
+func (s *Scheduler) PostAt(at time.Time, p appbsky.FeedPost) (Job, error) {
+	return s.Add(Job{Post: &p, At: at})
+}
+
+// due returns when the job should run next: its next scheduled run, or the
+// retry of a failed one
+func (j *Job) due() time.Time {
+	if !j.RetryAt.IsZero() {
+		return j.RetryAt
+	}
+	return j.NextRun
+}
+
+// schedule parses the job's cron expression and time zone
+func (j *Job) schedule() (*Cron, *time.Location, error) {
+	cron, err := ParseCron(j.Cron)
+	if err != nil {
+		return nil, nil, err
+	}
+	loc := time.UTC
+	if j.TimeZone != "" {
+		if loc, err = time.LoadLocation(j.TimeZone); err != nil {
+			return nil, nil, fmt.Errorf("%w: unknown time zone %q", ErrInvalidJob, j.TimeZone)
+		}
+	}
+	return cron, loc, nil
+}
+
+// Remove unschedules a job
+func (s *Scheduler) Remove(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, job := range s.jobs {
+		if job.ID == id {
+			s.jobs = append(s.jobs[:i], s.jobs[i+1:]...)
+			return s.save()
+		}
+	}
+	return fmt.Errorf("%w: %s", ErrNotFound, id)
+}
+
+// Jobs returns copies of all scheduled jobs, including finished one-shot jobs
+func (s *Scheduler) Jobs() []Job {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	jobs := make([]Job, len(s.jobs))
+	for i, job := range s.jobs {
+		jobs[i] = *job
+	}
+	return jobs
+}
+
+// Get returns a copy of the job with the given ID
+func (s *Scheduler) Get(id string) (Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, job := range s.jobs {
+		if job.ID == id {
+			return *job, nil
+		}
+	}
+	return Job{}, fmt.Errorf("%w: %s", ErrNotFound, id)
+}
+
+// notify wakes up Run
+func (s *Scheduler) notify() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// save writes the schedule to disk. The caller must hold s.mu.
+func (s *Scheduler) save() error {
+	data, err := json.MarshalIndent(s.jobs, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode schedule: %w", err)
+	}
+	if err := utils.WriteFileAtomic(s.path, data, 0o600); err != nil {
+		return fmt.Errorf("failed to save schedule: %w", err)
+	}
+	return nil
+}
+
+// Run publishes posts as they become due until ctx is cancelled, and then
+// returns ctx.Err(). Runs missed before Run was called are handled according
+// to the MissedPolicy.
+func (s *Scheduler) Run(ctx context.Context) error {
+	for {
+		if err := s.RunDue(ctx); err != nil {
+			return err
+		}
+
+		wait := time.Hour
+		if next, ok := s.nextRun(); ok {
+			wait = next.Sub(s.now())
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-s.wake:
+			timer.Stop()
+		case <-timer.C:
+		}
+	}
+}
+
+// nextRun returns the earliest time a job is due
+func (s *Scheduler) nextRun() (time.Time, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var next time.Time
+	for _, job := range s.jobs {
+		if !job.Done && (next.IsZero() || job.due().Before(next)) {
+			next = job.due()
+		}
+	}
+	return next, !next.IsZero()
+}
+
+// RunDue publishes every job that is due. Publishing errors are recorded on
+// the job and passed to OnRun, and runs that failed with a temporary error are
+// retried later; RunDue only returns an error if ctx is cancelled or the
+// schedule can't be saved.
+func (s *Scheduler) RunDue(ctx context.Context) error {
+	now := s.now()
+
+	s.mu.Lock()
+	var due []Job
+	for _, job := range s.jobs {
+		if !job.Done && !job.due().After(now) {
+			due = append(due, *job)
+		}
+	}
+	s.mu.Unlock()
+
+	for _, job := range due {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := s.runJob(ctx, job, now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runJob publishes the runs of a due job and schedules its next run. A run
+// that fails with a temporary error stops the job at that run until it is
+// retried.
+func (s *Scheduler) runJob(ctx context.Context, job Job, now time.Time) error {
+	var cron *Cron
+	var loc *time.Location
+	if job.Cron != "" {
+		var err error
+		if cron, loc, err = job.schedule(); err != nil {
+			return s.finish(job, nil, nil, "", err)
+		}
+	}
+
+	runs := s.runTimes(job, cron, now)
+	if !job.RetryAt.IsZero() {
+		runs = []time.Time{job.NextRun}
+	}
+	var lastUri string
+	var lastErr error
+	for i, at := range runs {
+		uri, err := s.publish(ctx, job, at)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if s.options.OnRun != nil {
+			s.options.OnRun(job, at, uri, err)
+		}
+		if err != nil && !outbox.IsPermanent(err) && job.Attempts+1 < s.options.MaxAttempts {
+			return s.retry(job, at, runs[:i], lastUri, err)
+		}
+		lastUri, lastErr = uri, err
+	}
+
+	var next time.Time
+	if cron != nil {
+		next = cron.Next(now.In(loc))
+	}
+	return s.finish(job, &next, runs, lastUri, lastErr)
+}
+
+// runTimes returns the scheduled times to publish for a due job, applying the
+// MissedPolicy to runs that are more than Grace late
+func (s *Scheduler) runTimes(job Job, cron *Cron, now time.Time) []time.Time {
+	policy := job.Missed
+	if policy == "" {
+		policy = s.options.MissedPolicy
+	}
+	if now.Sub(job.NextRun) <= s.options.Grace {
+		return []time.Time{job.NextRun}
+	}
+
+	switch policy {
+	case MissedSkip:
+		return nil
+	case MissedRunAll:
+		if cron == nil {
+			return []time.Time{job.NextRun}
+		}
+		var times []time.Time
+		for at := job.NextRun; !at.IsZero() && !at.After(now); at = cron.Next(at) {
+			times = append(times, at)
+		}
+		if max := s.options.MaxCatchUp; max > 0 && len(times) > max {
+			times = times[len(times)-max:]
+		}
+		return times
+	default:
+		if cron == nil {
+			return []time.Time{job.NextRun}
+		}
+		latest := job.NextRun
+		for at := cron.Next(latest); !at.IsZero() && !at.After(now); at = cron.Next(at) {
+			latest = at
+		}
+		return []time.Time{latest}
+	}
+}
+
+// publish publishes the post of one run. The post's record key is derived
+// from the job and the scheduled time, so publishing the same run twice, for
+// example after a crash, rewrites the same post.
+func (s *Scheduler) publish(ctx context.Context, job Job, at time.Time) (string, error) {
+	var p appbsky.FeedPost
+	if job.Post != nil {
+		p = *job.Post
+		p.CreatedAt = s.now().Format(time.RFC3339)
+	} else {
+		s.mu.Lock()
+		producer, ok := s.producers[job.Producer]
+		s.mu.Unlock()
+		if !ok {
+			return "", fmt.Errorf("no producer registered as %q", job.Producer)
+		}
+		produced, err := producer(ctx, at)
+		if err != nil {
+			return "", fmt.Errorf("failed to produce post: %w", err)
+		}
+		if produced == nil {
+			return "", nil
+		}
+		p = *produced
+	}
+
+	opts := []client.PostOption{client.WithRkey(runRkey(job.ID, at))}
+	if job.Threadgate != nil {
+		opts = append(opts, client.WithThreadgate(*job.Threadgate))
+	}
+	if job.Postgate != nil {
+		opts = append(opts, client.WithPostgate(*job.Postgate))
+	}
+	if job.TTL > 0 {
+		opts = append(opts, client.WithTTL(job.TTL))
+	}
+	_, uri, err := s.publisher.PostToFeed(ctx, p, opts...)
+	return uri, err
+}
+
+// runRkey returns the record key of the post published for a run
+func runRkey(jobID string, at time.Time) string {
+	h := fnv.New32a()
+	h.Write([]byte(jobID))
+	return syntax.NewTIDFromTime(at, uint(h.Sum32())).String()
+}
+
+// stored returns the scheduled job that job is a copy of, or nil if it was
+// removed or rescheduled while it was running. The caller must hold s.mu.
+func (s *Scheduler) stored(job Job) *Job {
+	for _, j := range s.jobs {
+		if j.ID == job.ID {
+			if !j.NextRun.Equal(job.NextRun) || !j.RetryAt.Equal(job.RetryAt) {
+				return nil
+			}
+			return j
+		}
+	}
+	return nil
+}
+
+// record counts runs that were published or failed permanently
+func (j *Job) record(runs []time.Time, uri string) {
+	if len(runs) > 0 {
+		j.LastRun = runs[len(runs)-1]
+		j.Runs += len(runs)
+		j.LastUri = uri
+	}
+}
+
+// finish records the outcome of a job's runs and saves the schedule
+func (s *Scheduler) finish(job Job, next *time.Time, runs []time.Time, uri string, runErr error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored := s.stored(job)
+	if stored == nil {
+		return nil
+	}
+
+	stored.record(runs, uri)
+	stored.LastError = ""
+	if runErr != nil {
+		stored.LastError = runErr.Error()
+	}
+	stored.Attempts, stored.RetryAt = 0, time.Time{}
+
+	if next == nil || next.IsZero() {
+		stored.Done = true
+	} else {
+		stored.NextRun = *next
+	}
+	return s.save()
+}
+
+// retry records the runs published before the run at failed, and schedules
+// that run to be retried with backoff
+func (s *Scheduler) retry(job Job, at time.Time, published []time.Time, uri string, runErr error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored := s.stored(job)
+	if stored == nil {
+		return nil
+	}
+
+	stored.record(published, uri)
+	stored.LastError = runErr.Error()
+	stored.Attempts++
+	stored.NextRun = at
+	stored.RetryAt = s.now().Add(outbox.Backoff(stored.Attempts, s.options.InitialBackoff, s.options.MaxBackoff, runErr))
+	return s.save()
+}
@@ -0,0 +1,251 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	appbsky "github.com/bluesky-social/indigo/api/bsky"
+	"github.com/bluesky-social/indigo/xrpc"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/watzon/lining/client"
+)
+
+// fakePublisher records the posts it publishes
+type fakePublisher struct {
+	texts []string
+	rkeys []string
+	ttls  []time.Duration
+	err   error
+}
+
+func (p *fakePublisher) PostToFeed(ctx context.Context, fp appbsky.FeedPost, opts ...client.PostOption) (string, string, error) {
+	var options client.PostOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+	p.rkeys = append(p.rkeys, options.Rkey)
+	p.ttls = append(p.ttls, options.TTL)
+	if p.err != nil {
+		return "", "", p.err
+	}
+	p.texts = append(p.texts, fp.Text)
+	return "cid", "at://did:plc:test/app.bsky.feed.post/" + options.Rkey, nil
+}
+
+// openAt opens a scheduler whose clock reads *now
+func openAt(t *testing.T, path string, pub Publisher, now *time.Time, opts ...Option) *Scheduler {
+	t.Helper()
+	s, err := Open(path, pub, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.now = func() time.Time { return *now }
+	return s
+}
+
+func TestScheduler(t *testing.T) {
+	ctx := context.Background()
+	start := time.Date(2024, 5, 6, 8, 0, 0, 0, time.UTC)
+
+	t.Run("one-shot posts", func(t *testing.T) {
+		now := start
+		pub := &fakePublisher{}
+		s := openAt(t, filepath.Join(t.TempDir(), "schedule.json"), pub, &now)
+
+		job, err := s.Add(Job{Post: &appbsky.FeedPost{Text: "later"}, At: start.Add(time.Hour), TTL: 2 * time.Hour})
+		assert.NoError(t, err)
+
+		assert.NoError(t, s.RunDue(ctx))
+		assert.Empty(t, pub.texts)
+
+		now = start.Add(time.Hour)
+		assert.NoError(t, s.RunDue(ctx))
+		assert.NoError(t, s.RunDue(ctx))
+		assert.Equal(t, []string{"later"}, pub.texts)
+
+		done, err := s.Get(job.ID)
+		assert.NoError(t, err)
+		assert.True(t, done.Done)
+		assert.Equal(t, []time.Duration{2 * time.Hour}, pub.ttls)
+		assert.Equal(t, 1, done.Runs)
+		assert.Equal(t, "at://did:plc:test/app.bsky.feed.post/"+pub.rkeys[0], done.LastUri)
+	})
+
+	t.Run("cron jobs with producers", func(t *testing.T) {
+		now := start
+		pub := &fakePublisher{}
+		s := openAt(t, filepath.Join(t.TempDir(), "schedule.json"), pub, &now)
+		s.RegisterProducer("digest", func(ctx context.Context, at time.Time) (*appbsky.FeedPost, error) {
+			return &appbsky.FeedPost{Text: "digest for " + at.Format("Jan 2 15:04")}, nil
+		})
+
+		job, err := s.Add(Job{ID: "digest", Producer: "digest", Cron: "0 9 * * *"})
+		assert.NoError(t, err)
+		assert.Equal(t, time.Date(2024, 5, 6, 9, 0, 0, 0, time.UTC), job.NextRun)
+
+		now = job.NextRun.Add(10 * time.Second)
+		assert.NoError(t, s.RunDue(ctx))
+		assert.Equal(t, []string{"digest for May 6 09:00"}, pub.texts)
+
+		job, _ = s.Get("digest")
+		assert.Equal(t, time.Date(2024, 5, 7, 9, 0, 0, 0, time.UTC), job.NextRun)
+		assert.False(t, job.Done)
+	})
+
+	t.Run("unknown producers are rejected", func(t *testing.T) {
+		now := start
+		s := openAt(t, filepath.Join(t.TempDir(), "schedule.json"), &fakePublisher{}, &now)
+
+		_, err := s.Add(Job{Producer: "missing", Cron: "@hourly"})
+		assert.ErrorIs(t, err, ErrInvalidJob)
+		_, err = s.Add(Job{Post: &appbsky.FeedPost{Text: "x"}})
+		assert.ErrorIs(t, err, ErrInvalidJob)
+		_, err = s.Add(Job{Post: &appbsky.FeedPost{Text: "x"}, Cron: "@daily", TimeZone: "Mars/Olympus"})
+		assert.ErrorIs(t, err, ErrInvalidJob)
+	})
+
+	t.Run("missed runs after a restart", func(t *testing.T) {
+		tests := []struct {
+			policy MissedPolicy
+			want   []string
+		}{
+			{policy: MissedSkip, want: nil},
+			{policy: MissedRunOnce, want: []string{"18:00"}},
+			{policy: MissedRunAll, want: []string{"12:00", "18:00"}},
+		}
+
+		for _, tt := range tests {
+			t.Run(string(tt.policy), func(t *testing.T) {
+				path := filepath.Join(t.TempDir(), "schedule.json")
+				now := start
+				first := openAt(t, path, &fakePublisher{}, &now)
+				first.RegisterProducer("clock", nil)
+				_, err := first.Add(Job{ID: "clock", Producer: "clock", Cron: "0 */6 * * *", Missed: tt.policy})
+				assert.NoError(t, err)
+
+				// The process comes back at 19:30, having missed 12:00 and 18:00
+				now = time.Date(2024, 5, 6, 19, 30, 0, 0, time.UTC)
+				pub := &fakePublisher{}
+				second := openAt(t, path, pub, &now)
+				second.RegisterProducer("clock", func(ctx context.Context, at time.Time) (*appbsky.FeedPost, error) {
+					return &appbsky.FeedPost{Text: at.Format("15:04")}, nil
+				})
+
+				assert.NoError(t, second.RunDue(ctx))
+				assert.Equal(t, tt.want, pub.texts)
+
+				job, _ := second.Get("clock")
+				assert.Equal(t, time.Date(2024, 5, 7, 0, 0, 0, 0, time.UTC), job.NextRun)
+			})
+		}
+	})
+
+	t.Run("runs keep their rkey", func(t *testing.T) {
+		now := start
+		pub := &fakePublisher{err: errors.New("PDS unavailable")}
+		var errs []error
+		s := openAt(t, filepath.Join(t.TempDir(), "schedule.json"), pub, &now,
+			WithOnRun(func(job Job, at time.Time, uri string, err error) { errs = append(errs, err) }),
+		)
+
+		job, err := s.PostAt(start, appbsky.FeedPost{Text: "once"})
+		assert.NoError(t, err)
+		assert.NoError(t, s.RunDue(ctx))
+
+		job, _ = s.Get(job.ID)
+		assert.Equal(t, "PDS unavailable", job.LastError)
+		assert.Len(t, errs, 1)
+		assert.Equal(t, runRkey(job.ID, start), pub.rkeys[0])
+		assert.NotEqual(t, runRkey("other", start), pub.rkeys[0])
+	})
+
+	t.Run("failed runs are retried", func(t *testing.T) {
+		now := start
+		pub := &fakePublisher{err: errors.New("PDS unavailable")}
+		s := openAt(t, filepath.Join(t.TempDir(), "schedule.json"), pub, &now,
+			WithBackoff(time.Minute, time.Hour),
+		)
+
+		job, err := s.PostAt(start, appbsky.FeedPost{Text: "once"})
+		assert.NoError(t, err)
+		assert.NoError(t, s.RunDue(ctx))
+
+		job, _ = s.Get(job.ID)
+		assert.False(t, job.Done)
+		assert.Equal(t, 1, job.Attempts)
+		assert.Equal(t, start, job.NextRun)
+		assert.Equal(t, start.Add(time.Minute), job.RetryAt)
+
+		now = start.Add(30 * time.Second)
+		assert.NoError(t, s.RunDue(ctx))
+		assert.Len(t, pub.rkeys, 1)
+
+		now = start.Add(time.Minute)
+		assert.NoError(t, s.RunDue(ctx))
+		job, _ = s.Get(job.ID)
+		assert.Equal(t, 2, job.Attempts)
+		assert.Equal(t, now.Add(2*time.Minute), job.RetryAt)
+
+		pub.err = nil
+		now = job.RetryAt
+		assert.NoError(t, s.RunDue(ctx))
+		job, _ = s.Get(job.ID)
+		assert.True(t, job.Done)
+		assert.Equal(t, 1, job.Runs)
+		assert.Zero(t, job.Attempts)
+		assert.Empty(t, job.LastError)
+		assert.Equal(t, []string{"once"}, pub.texts)
+		assert.Equal(t, []string{pub.rkeys[0], pub.rkeys[0], pub.rkeys[0]}, pub.rkeys)
+	})
+
+	t.Run("gives up on permanent errors and after the last attempt", func(t *testing.T) {
+		now := start
+		pub := &fakePublisher{err: &xrpc.Error{StatusCode: http.StatusBadRequest}}
+		s := openAt(t, filepath.Join(t.TempDir(), "schedule.json"), pub, &now, WithMaxAttempts(2))
+
+		once, err := s.PostAt(start, appbsky.FeedPost{Text: "rejected"})
+		assert.NoError(t, err)
+		assert.NoError(t, s.RunDue(ctx))
+		once, _ = s.Get(once.ID)
+		assert.True(t, once.Done)
+		assert.NotEmpty(t, once.LastError)
+
+		pub.err = errors.New("PDS unavailable")
+		hourly, err := s.Add(Job{ID: "hourly", Post: &appbsky.FeedPost{Text: "tick"}, Cron: "@hourly"})
+		assert.NoError(t, err)
+		for i := 0; i < 2; i++ {
+			now = s.Jobs()[1].due()
+			assert.NoError(t, s.RunDue(ctx))
+		}
+		job, _ := s.Get("hourly")
+		assert.Equal(t, hourly.NextRun.Add(time.Hour), job.NextRun)
+		assert.Zero(t, job.Attempts)
+		assert.Equal(t, "PDS unavailable", job.LastError)
+	})
+
+	t.Run("run publishes until cancelled", func(t *testing.T) {
+		pub := &fakePublisher{}
+		s, err := Open(filepath.Join(t.TempDir(), "schedule.json"), pub)
+		assert.NoError(t, err)
+
+		ctx, cancel := context.WithCancel(ctx)
+		done := make(chan error)
+		go func() { done <- s.Run(ctx) }()
+
+		_, err = s.PostAt(time.Now().Add(20*time.Millisecond), appbsky.FeedPost{Text: "soon"})
+		assert.NoError(t, err)
+		assert.Eventually(t, func() bool {
+			job := s.Jobs()[0]
+			return job.Done
+		}, time.Second, 5*time.Millisecond)
+
+		cancel()
+		assert.ErrorIs(t, <-done, context.Canceled)
+		assert.Equal(t, []string{"soon"}, pub.texts)
+	})
+}
@@ -0,0 +1,74 @@
+// Package utils contains helpers shared across the library that don't belong
+// to any particular Bluesky record type.
+package utils
+
+import (
+	"github.com/rivo/uniseg"
+)
+
+// GraphemeCount returns the number of user-perceived characters in s, counted
+// as extended grapheme clusters per Unicode Standard Annex #29. This is how
+// Bluesky measures the length of a post, so an emoji such as "👩‍👩‍👧" or a
+// flag counts as a single character.
+func GraphemeCount(s string) int {
+	return uniseg.GraphemeClusterCount(s)
+}
+
+// Graphemes splits s into its extended grapheme clusters
+func Graphemes(s string) []string {
+	var clusters []string
+	var cluster string
+	state := -1
+	for s != "" {
+		cluster, s, _, state = uniseg.FirstGraphemeClusterInString(s, state)
+		clusters = append(clusters, cluster)
+	}
+	return clusters
+}
+
+// Truncate shortens s so that it has at most maxGraphemes grapheme clusters and
+// at most maxBytes bytes, without ever splitting a grapheme cluster. A limit of
+// zero or less is treated as no limit.
+//
+// Example:
+//
+//	text := utils.Truncate(summary, 300, 3000)
+func Truncate(s string, maxGraphemes, maxBytes int) string {
+	var cluster string
+	count, pos, state := 0, 0, -1
+	for rest := s; rest != ""; count++ {
+		if maxGraphemes > 0 && count >= maxGraphemes {
+			break
+		}
+		cluster, rest, _, state = uniseg.FirstGraphemeClusterInString(rest, state)
+		if maxBytes > 0 && pos+len(cluster) > maxBytes {
+			break
+		}
+		pos += len(cluster)
+	}
+	return s[:pos]
+}
+
+// TruncateWithSuffix works like Truncate, but when s has to be shortened it
+// appends suffix (for example "…") while keeping the result within both limits.
+// If s already fits, it is returned unchanged.
+func TruncateWithSuffix(s, suffix string, maxGraphemes, maxBytes int) string {
+	if Truncate(s, maxGraphemes, maxBytes) == s {
+		return s
+	}
+
+	if maxGraphemes > 0 {
+		maxGraphemes -= GraphemeCount(suffix)
+		if maxGraphemes <= 0 {
+			return Truncate(suffix, maxGraphemes+GraphemeCount(suffix), maxBytes)
+		}
+	}
+	if maxBytes > 0 {
+		maxBytes -= len(suffix)
+		if maxBytes <= 0 {
+			return Truncate(suffix, 0, maxBytes+len(suffix))
+		}
+	}
+
+	return Truncate(s, maxGraphemes, maxBytes) + suffix
+}
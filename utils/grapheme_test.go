@@ -0,0 +1,69 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGraphemeCount(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  int
+	}{
+		{name: "empty", input: "", want: 0},
+		{name: "ascii", input: "hello", want: 5},
+		{name: "CRLF", input: "a\r\nb", want: 3},
+		{name: "combining marks", input: "éä", want: 2},
+		{name: "cjk", input: "日本語", want: 3},
+		{name: "hangul jamo", input: "각", want: 1},
+		{name: "emoji with skin tone", input: "👍🏽", want: 1},
+		{name: "emoji with variation selector", input: "❤️", want: 1},
+		{name: "zwj sequence", input: "👩‍👩‍👧‍👦", want: 1},
+		{name: "flags", input: "🇺🇸🇯🇵", want: 2},
+		{name: "odd regional indicators", input: "🇺🇸🇯", want: 2},
+		// Conjuncts only form a single cluster from Unicode 15.1, which neither
+		// uniseg nor the AppView implement yet
+		{name: "devanagari conjunct", input: "क्षि", want: 2},
+		{name: "devanagari vowel sign", input: "कि", want: 1},
+		{name: "thai", input: "กำ", want: 1},
+		{name: "mixed", input: "hi 👋🏻 there!", want: 11},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, GraphemeCount(tt.input))
+			assert.Equal(t, tt.input, strings.Join(Graphemes(tt.input), ""))
+			assert.Len(t, Graphemes(tt.input), tt.want)
+		})
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	t.Run("fits", func(t *testing.T) {
+		assert.Equal(t, "hello", Truncate("hello", 10, 100))
+	})
+
+	t.Run("grapheme limit", func(t *testing.T) {
+		assert.Equal(t, "he", Truncate("hello", 2, 0))
+		assert.Equal(t, "a👩‍👩‍👧", Truncate("a👩‍👩‍👧b", 2, 0))
+	})
+
+	t.Run("byte limit never splits clusters", func(t *testing.T) {
+		// "👍🏽" is 8 bytes, so a limit of 8 only leaves room for the "a"
+		assert.Equal(t, "a", Truncate("a👍🏽b", 0, 8))
+		assert.Equal(t, "a👍🏽", Truncate("a👍🏽b", 0, 9))
+	})
+
+	t.Run("no limits", func(t *testing.T) {
+		assert.Equal(t, "hello", Truncate("hello", 0, 0))
+	})
+
+	t.Run("with suffix", func(t *testing.T) {
+		assert.Equal(t, "hello", TruncateWithSuffix("hello", "…", 5, 0))
+		assert.Equal(t, "hell…", TruncateWithSuffix("hello world", "…", 5, 0))
+		assert.Equal(t, "he…", TruncateWithSuffix("hello world", "…", 0, 5))
+	})
+}
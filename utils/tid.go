@@ -0,0 +1,22 @@
+package utils
+
+import (
+	"math/rand/v2"
+
+	"github.com/bluesky-social/indigo/atproto/syntax"
+)
+
+// tidClock generates the TIDs of this process. Its clock identifier is
+// random, so that processes writing to the same repo don't collide.
+var tidClock = syntax.NewTIDClock(uint(rand.IntN(1024)))
+
+// NewTID returns a new TID from a process-wide clock. TIDs are used as record
+// keys; they sort in the order they were created.
+//
+// Example:
+//
+//	rkey := utils.NewTID()
+//	cid, uri, err := client.PostToFeed(ctx, post, client.WithRkey(rkey.String()))
+func NewTID() syntax.TID {
+	return tidClock.Next()
+}
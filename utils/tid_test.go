@@ -0,0 +1,22 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/bluesky-social/indigo/atproto/syntax"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewTID(t *testing.T) {
+	seen := make(map[syntax.TID]bool)
+	prev := NewTID()
+	for i := 0; i < 1000; i++ {
+		tid := NewTID()
+		_, err := syntax.ParseTID(tid.String())
+		assert.NoError(t, err)
+		assert.False(t, seen[tid])
+		assert.Greater(t, tid.String(), prev.String())
+		seen[tid] = true
+		prev = tid
+	}
+}
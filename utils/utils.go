@@ -1 +1,12 @@
 package utils
+
+// MatchesAll reports whether v passes all of the filters. It backs the
+// filtered handlers of the notification and chat pollers.
+func MatchesAll[T any, F ~func(T) bool](v T, filters []F) bool {
+	for _, filter := range filters {
+		if !filter(v) {
+			return false
+		}
+	}
+	return true
+}